@@ -37,6 +37,11 @@ type ClusterImageSetAvailabilitySpec struct {
 	// the deprecated imageFilter.
 	// +optional
 	Filter ClusterFilter `json:"filter,omitempty"`
+
+	// Images are monitored whether or not a pod uses them. They are always
+	// considered in use, thus never removed from status.
+	// +optional
+	Images StaticImages `json:"images,omitempty"`
 }
 
 // MonitoredImage holds the current availability state for a single image.
@@ -76,12 +81,21 @@ type ClusterImageSetAvailabilityStatus struct {
 	// +listType=map
 	// +listMapKey=image
 	Images []MonitoredImage `json:"images,omitempty"`
+
+	// Conditions are the Ready, FilterValid and CredentialsResolved conditions.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:scope=Cluster,shortName=cisa
 // +kubebuilder:printcolumn:name="Images",type=integer,JSONPath=".status.imageCount",description="Total number of monitored images"
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // ClusterImageSetAvailability is the Schema for the clusterimagesetavailabilities API.
 type ClusterImageSetAvailability struct {
@@ -0,0 +1,16 @@
+package v1alpha1
+
+// Types of the conditions reported in the status of the kuik resources.
+const (
+	// ConditionReady is true when every other condition of the resource is true.
+	ConditionReady = "Ready"
+	// ConditionFilterValid tells whether the filters of the resource compile.
+	ConditionFilterValid = "FilterValid"
+	// ConditionCredentialsResolved tells whether the secrets referenced by the
+	// resource exist and are accepted by the registries.
+	ConditionCredentialsResolved = "CredentialsResolved"
+	// ConditionMirroringComplete tells whether every image in use is mirrored.
+	ConditionMirroringComplete = "MirroringComplete"
+	// ConditionCleanupHealthy tells whether the unused mirrors could be deleted and the capacity is met.
+	ConditionCleanupHealthy = "CleanupHealthy"
+)
@@ -0,0 +1,65 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+var weekdays = map[time.Weekday]Weekday{
+	time.Monday:    "Mon",
+	time.Tuesday:   "Tue",
+	time.Wednesday: "Wed",
+	time.Thursday:  "Thu",
+	time.Friday:    "Fri",
+	time.Saturday:  "Sat",
+	time.Sunday:    "Sun",
+}
+
+// NextWindow returns whether a copy may start at now and, if not, when the next
+// copy window opens.
+func (c *Copy) NextWindow(now time.Time) (open bool, opensAt time.Time, err error) {
+	if len(c.Windows) == 0 {
+		return true, time.Time{}, nil
+	}
+
+	location := time.UTC
+	if c.TimeZone != "" {
+		if location, err = time.LoadLocation(c.TimeZone); err != nil {
+			return false, time.Time{}, fmt.Errorf("invalid copy windows time zone: %w", err)
+		}
+	}
+	now = now.In(location)
+
+	for _, window := range c.Windows {
+		start, err := time.Parse("15:04", window.Start)
+		if err != nil {
+			return false, time.Time{}, fmt.Errorf("invalid copy window start: %w", err)
+		}
+		end, err := time.Parse("15:04", window.End)
+		if err != nil {
+			return false, time.Time{}, fmt.Errorf("invalid copy window end: %w", err)
+		}
+		duration := end.Sub(start)
+		if duration <= 0 {
+			duration += 24 * time.Hour
+		}
+
+		// Starting the day before, for the windows opened yesterday and closing today
+		for day := -1; day <= 7; day++ {
+			date := now.AddDate(0, 0, day)
+			if len(window.Days) > 0 && !slices.Contains(window.Days, weekdays[date.Weekday()]) {
+				continue
+			}
+
+			opening := time.Date(date.Year(), date.Month(), date.Day(), start.Hour(), start.Minute(), 0, 0, location)
+			if !now.Before(opening) && now.Before(opening.Add(duration)) {
+				return true, time.Time{}, nil
+			} else if opening.After(now) && (opensAt.IsZero() || opening.Before(opensAt)) {
+				opensAt = opening
+			}
+		}
+	}
+
+	return false, opensAt, nil
+}
@@ -0,0 +1,53 @@
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCopyNextWindow(t *testing.T) {
+	// A Wednesday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.June, day, hour, minute, 0, 0, time.UTC)
+	}
+	nights := CopyWindow{Start: "22:00", End: "06:00"}
+	weekends := CopyWindow{Days: []Weekday{"Sat", "Sun"}, Start: "00:00", End: "00:00"}
+
+	tests := []struct {
+		name        string
+		copy        Copy
+		now         time.Time
+		wantOpen    bool
+		wantOpensAt time.Time
+	}{
+		{name: "no window", copy: Copy{}, now: at(10, 12, 0), wantOpen: true},
+		{name: "before opening", copy: Copy{Windows: []CopyWindow{nights}}, now: at(10, 12, 0), wantOpensAt: at(10, 22, 0)},
+		{name: "at opening", copy: Copy{Windows: []CopyWindow{nights}}, now: at(10, 22, 0), wantOpen: true},
+		{name: "after midnight", copy: Copy{Windows: []CopyWindow{nights}}, now: at(11, 5, 59), wantOpen: true},
+		{name: "at closing", copy: Copy{Windows: []CopyWindow{nights}}, now: at(11, 6, 0), wantOpensAt: at(11, 22, 0)},
+		{name: "next matching day", copy: Copy{Windows: []CopyWindow{weekends}}, now: at(10, 12, 0), wantOpensAt: at(13, 0, 0)},
+		{name: "whole day", copy: Copy{Windows: []CopyWindow{weekends}}, now: at(14, 23, 59), wantOpen: true},
+		{name: "earliest window", copy: Copy{Windows: []CopyWindow{weekends, nights}}, now: at(10, 12, 0), wantOpensAt: at(10, 22, 0)},
+		{
+			name:        "time zone",
+			copy:        Copy{Windows: []CopyWindow{nights}, TimeZone: "Europe/Paris"},
+			now:         at(10, 12, 0),
+			wantOpensAt: at(10, 20, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			open, opensAt, err := tt.copy.NextWindow(tt.now)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(open).To(Equal(tt.wantOpen))
+			g.Expect(opensAt.Equal(tt.wantOpensAt)).To(BeTrue(), "opens at %v", opensAt)
+		})
+	}
+
+	_, _, err := (&Copy{Windows: []CopyWindow{nights}, TimeZone: "Nowhere/Somewhere"}).NextWindow(at(10, 12, 0))
+	NewWithT(t).Expect(err).To(HaveOccurred())
+}
@@ -2,9 +2,15 @@ package v1alpha1
 
 import (
 	"path"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/distribution/reference"
 	"github.com/enix/kube-image-keeper/internal/filter"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -23,7 +29,40 @@ type ImageSetMirrorBase struct {
 	// +optional
 	ImageFilter ImageFilterDefinition `json:"imageFilter,omitempty"`
 	Cleanup     Cleanup               `json:"cleanup,omitempty"`
-	Mirrors     Mirrors               `json:"mirrors,omitempty"`
+	// DeletionPolicy is either Delete (default), Retain or RetainInUse. It controls which mirrored images are deleted
+	// from the mirrors when this resource is deleted.
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+	Mirrors        Mirrors        `json:"mirrors,omitempty"`
+	// MinReplicas is the number of mirrors an image must be copied to for it to be protected. Once an image is
+	// protected, the copies to its other mirrors are best effort: their failures are retried with a backoff and do not
+	// fail this resource. Defaults to 0, every mirror is required.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MinReplicas int32 `json:"minReplicas,omitempty"`
+	// Capacity bounds the images mirrored by this resource, across all of its mirrors. When it is exceeded, the
+	// least recently used unused images are deleted first.
+	// +optional
+	Capacity Capacity `json:"capacity,omitempty"`
+	// Resync controls whether mirrored tags are checked for drift against their source and copied again.
+	// +optional
+	Resync Resync `json:"resync,omitempty"`
+	// Prefetch mirrors ahead of their use the newest tags following the tag of each matching image.
+	// +optional
+	Prefetch Prefetch `json:"prefetch,omitempty"`
+	// Copy controls where the images are copied to the mirrors, in the manager or in Jobs, and when.
+	// +optional
+	Copy Copy `json:"copy,omitempty"`
+	// OrphanSweep deletes from the mirrors the images copied by this resource that its status does not track anymore.
+	// +optional
+	OrphanSweep OrphanSweep `json:"orphanSweep,omitempty"`
+	// Images are mirrored whether or not a pod uses them. They are always considered in use, thus never cleaned up.
+	// +optional
+	Images StaticImages `json:"images,omitempty"`
+	// SourceCredentials are secrets used to pull matching images from their source registry.
+	// They are tried before the imagePullSecrets of the pods and ServiceAccounts using the images.
+	// +optional
+	SourceCredentials SourceCredentials `json:"sourceCredentials,omitempty"`
 }
 
 // ImageSetMirrorSpec defines the desired state of ImageSetMirror.
@@ -42,11 +81,30 @@ type ImageSetMirrorStatus struct {
 	// +listType=map
 	// +listMapKey=image
 	MatchingImages []MatchingImage `json:"matchingImages,omitempty"`
+	// PrefetchedImages are the images mirrored ahead of their use by the prefetch policy.
+	// +listType=map
+	// +listMapKey=image
+	// +optional
+	PrefetchedImages []PrefetchedImage `json:"prefetchedImages,omitempty"`
+	// Conditions are the Ready, FilterValid, CredentialsResolved, MirroringComplete and CleanupHealthy conditions.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// CleanupReport lists the mirrored images that the cleanup would delete, and when, in dry run mode.
+	// +optional
+	CleanupReport *CleanupReport `json:"cleanupReport,omitempty"`
+	// OrphanSweep is the outcome of the last orphan sweep.
+	// +optional
+	OrphanSweep *OrphanSweepStatus `json:"orphanSweep,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:shortName=ism
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // ImageSetMirror is the Schema for the imagesetmirrors API.
 type ImageSetMirror struct {
@@ -73,6 +131,287 @@ type ImageFilterDefinition IncludeExcludeFilterDefinition
 type Cleanup struct {
 	Enabled   bool            `json:"enabled,omitempty"`
 	Retention metav1.Duration `json:"retention,omitempty"`
+	// DryRun evaluates the retention and the capacity, whether or not cleanup is enabled, and reports the images that
+	// would be deleted in status.cleanupReport without deleting any of them.
+	// +optional
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// CleanupReason is why a mirrored image is deleted by the cleanup.
+type CleanupReason string
+
+const (
+	// CleanupReasonRetention deletes the images unused for more than the retention duration.
+	CleanupReasonRetention CleanupReason = "Retention"
+	// CleanupReasonCapacity evicts the least recently used unused images over the capacity.
+	CleanupReasonCapacity CleanupReason = "Capacity"
+)
+
+// MaxPlannedDeletions is the maximum number of planned deletions recorded in a cleanup report.
+const MaxPlannedDeletions = 100
+
+// CleanupReport lists the mirrored images that the cleanup would delete, in dry run mode
+type CleanupReport struct {
+	// EvaluatedAt is the last time the cleanup was evaluated.
+	EvaluatedAt metav1.Time `json:"evaluatedAt"`
+	// DeletionCount is the number of planned deletions, including those not listed in deletions.
+	// +optional
+	DeletionCount int `json:"deletionCount,omitempty"`
+	// Deletions are the planned deletions, soonest first.
+	// +listType=map
+	// +listMapKey=image
+	// +kubebuilder:validation:MaxItems=100
+	// +optional
+	Deletions []PlannedDeletion `json:"deletions,omitempty"`
+}
+
+// PlannedDeletion is a mirrored image that the cleanup would delete.
+type PlannedDeletion struct {
+	// Image is the mirrored image.
+	Image string `json:"image"`
+	// Reason is either Retention or Capacity.
+	Reason CleanupReason `json:"reason"`
+	// DeleteAt is when the image would be deleted. It is in the past for the images that would already be deleted.
+	DeleteAt metav1.Time `json:"deleteAt"`
+}
+
+// DeletionPolicy defines what happens to the mirrored images of a mirror resource when it is deleted.
+// +kubebuilder:validation:Enum=Delete;Retain;RetainInUse
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete deletes every mirrored image.
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyRetain keeps every mirrored image.
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+	// DeletionPolicyRetainInUse keeps the mirrored images in use and deletes the other ones.
+	DeletionPolicyRetainInUse DeletionPolicy = "RetainInUse"
+)
+
+// Retains reports whether a mirrored image, in use or not, is kept when its
+// mirror resource is deleted.
+func (p DeletionPolicy) Retains(inUse bool) bool {
+	switch p {
+	case DeletionPolicyRetain:
+		return true
+	case DeletionPolicyRetainInUse:
+		return inUse
+	default:
+		return false
+	}
+}
+
+// Capacity bounds the number and the total size of mirrored images. Zero values mean no limit.
+type Capacity struct {
+	// MaxImages is the maximum number of mirrored images.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxImages int32 `json:"maxImages,omitempty"`
+	// MaxSize is the maximum total size of the mirrored images, computed from their recorded size.
+	// +optional
+	MaxSize *resource.Quantity `json:"maxSize,omitempty"`
+}
+
+// IsLimited reports whether c sets any limit.
+func (c *Capacity) IsLimited() bool {
+	return c != nil && (c.MaxImages > 0 || (c.MaxSize != nil && !c.MaxSize.IsZero()))
+}
+
+// ResyncPolicy defines which mirrored images are checked for drift.
+// +kubebuilder:validation:Enum=Never;Interval;MatchingTags
+type ResyncPolicy string
+
+const (
+	// ResyncPolicyNever never checks mirrored images once copied.
+	ResyncPolicyNever ResyncPolicy = "Never"
+	// ResyncPolicyInterval checks every mirrored image on an interval.
+	ResyncPolicyInterval ResyncPolicy = "Interval"
+	// ResyncPolicyMatchingTags checks on an interval the mirrored images whose tag matches Tags.
+	ResyncPolicyMatchingTags ResyncPolicy = "MatchingTags"
+)
+
+// DefaultResyncInterval is the interval used when Resync.Interval is not set.
+const DefaultResyncInterval = time.Hour
+
+// Resync defines a resync strategy for mutable tags
+// +kubebuilder:validation:XValidation:rule="!has(self.policy) || self.policy != 'MatchingTags' || has(self.tags)",message="tags is required when policy is MatchingTags"
+type Resync struct {
+	// Policy is either Never (default), Interval or MatchingTags.
+	// +optional
+	Policy ResyncPolicy `json:"policy,omitempty"`
+	// Interval between two drift checks of a mirrored image. Defaults to 1h.
+	// +optional
+	Interval metav1.Duration `json:"interval,omitempty"`
+	// Tags is a regular expression matched against the whole tag of the images to check with the MatchingTags policy.
+	// +kubebuilder:validation:MaxLength=128
+	// +kubebuilder:validation:XValidation:rule="''.matches(self) ? true : true",message="tags contains an invalid regular expression"
+	// +optional
+	Tags string `json:"tags,omitempty"`
+}
+
+// PrefetchConstraint restricts the tags prefetched for an image relative to its tag.
+// +kubebuilder:validation:Enum=SameMinor;SameMajor
+type PrefetchConstraint string
+
+const (
+	// PrefetchConstraintSameMinor prefetches the newer patch versions of the tag.
+	PrefetchConstraintSameMinor PrefetchConstraint = "SameMinor"
+	// PrefetchConstraintSameMajor prefetches the newer minor and patch versions of the tag.
+	PrefetchConstraintSameMajor PrefetchConstraint = "SameMajor"
+)
+
+// DefaultPrefetchCount is the number of tags prefetched when Prefetch.Count is not set.
+const DefaultPrefetchCount = 1
+
+// Prefetch defines a prefetch strategy for the tags following the tags in use
+type Prefetch struct {
+	// Enabled mirrors the newest tags following the tag of each matching image ahead of their use. Prefetched images
+	// are only deleted once unused when cleanup is enabled.
+	Enabled bool `json:"enabled,omitempty"`
+	// Constraint is either SameMinor (default) or SameMajor.
+	// +optional
+	Constraint PrefetchConstraint `json:"constraint,omitempty"`
+	// Count is the number of newest tags to prefetch for each matching image. Defaults to 1.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=10
+	// +optional
+	Count int `json:"count,omitempty"`
+	// Retention is how long a prefetched image is kept once it is not among the tags to prefetch anymore, when cleanup
+	// is enabled. Defaults to 0, deleting it right away.
+	// +optional
+	Retention metav1.Duration `json:"retention,omitempty"`
+}
+
+// CopyMode defines where the images are copied.
+// +kubebuilder:validation:Enum=InProcess;Job
+type CopyMode string
+
+const (
+	// CopyModeInProcess copies the images in the manager.
+	CopyModeInProcess CopyMode = "InProcess"
+	// CopyModeJob copies each image in a short-lived Job.
+	CopyModeJob CopyMode = "Job"
+)
+
+// DefaultCopyJobTTLSecondsAfterFinished is how long a finished copy Job is kept
+// when CopyJob.TTLSecondsAfterFinished is not set.
+const DefaultCopyJobTTLSecondsAfterFinished = int32(600)
+
+// Copy defines where and when the images are copied
+type Copy struct {
+	// Mode is either InProcess (default) or Job.
+	// +optional
+	Mode CopyMode `json:"mode,omitempty"`
+	// Job configures the Jobs copying the images with the Job mode.
+	// +optional
+	Job CopyJob `json:"job,omitempty"`
+	// Windows are the time ranges during which new copies may start. Outside of them, new copies are deferred to the
+	// opening of the next window while the running ones go on. Copies may start at any time when no window is set.
+	// +kubebuilder:validation:MaxItems=16
+	// +optional
+	Windows []CopyWindow `json:"windows,omitempty"`
+	// TimeZone of the windows, as an IANA time zone name such as "Europe/Paris". Defaults to UTC.
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+	// Referrers also copies the artifacts attached to the source manifest and to the copied per-platform manifests:
+	// their OCI referrers, such as signatures, SBOMs and attestations, and the signatures, attestations and SBOMs
+	// tagged by cosign as sha256-<digest>.sig, .att and .sbom.
+	// +optional
+	Referrers bool `json:"referrers,omitempty"`
+}
+
+// Weekday is a day of the week.
+// +kubebuilder:validation:Enum=Mon;Tue;Wed;Thu;Fri;Sat;Sun
+type Weekday string
+
+// CopyWindow is a time range, repeated on some days of the week, during which
+// new copies may start.
+type CopyWindow struct {
+	// Days of the week the window opens. Defaults to every day.
+	// +kubebuilder:validation:MaxItems=7
+	// +optional
+	Days []Weekday `json:"days,omitempty"`
+	// Start is the time the window opens, as HH:MM.
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	Start string `json:"start"`
+	// End is the time the window closes, as HH:MM. A window ending at or before its start closes the next day.
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	End string `json:"end"`
+}
+
+// CopyJob configures the Jobs copying the images
+type CopyJob struct {
+	// Resources of the copier container.
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+	// NodeSelector of the copier pods.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Tolerations of the copier pods.
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// ActiveDeadlineSeconds bounds the duration of a copy, after which it is considered as failed.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+	// TTLSecondsAfterFinished is how long a finished Job is kept before being deleted. Defaults to 600.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+}
+
+// DefaultOrphanSweepInterval is the interval used when OrphanSweep.Interval is not set.
+const DefaultOrphanSweepInterval = 24 * time.Hour
+
+// DefaultOrphanSweepGracePeriod is the grace period used when OrphanSweep.GracePeriod is not set.
+const DefaultOrphanSweepGracePeriod = 24 * time.Hour
+
+// OrphanSweep defines a sweep of the images left in the mirrors by this resource
+type OrphanSweep struct {
+	// Enabled marks the images copied from now on and sweeps the marked images that are not tracked anymore. Images
+	// copied while the sweep is disabled are never swept.
+	Enabled bool `json:"enabled,omitempty"`
+	// Interval between two sweeps. Defaults to 24h.
+	// +optional
+	Interval metav1.Duration `json:"interval,omitempty"`
+	// GracePeriod is how long an orphaned image is kept once found. Defaults to 24h.
+	// +optional
+	GracePeriod metav1.Duration `json:"gracePeriod,omitempty"`
+	// DryRun reports the orphaned images in the status and in events without deleting them.
+	// +optional
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// MaxOrphans is the maximum number of orphaned images recorded in the status.
+const MaxOrphans = 100
+
+// OrphanSweepStatus is the outcome of an orphan sweep
+type OrphanSweepStatus struct {
+	// LastSweepTime is the last time the mirrors were swept.
+	// +optional
+	LastSweepTime *metav1.Time `json:"lastSweepTime,omitempty"`
+	// LastError is the error of the last sweep, if any.
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+	// OrphanCount is the number of orphaned images found by the last sweep, including those not listed in orphans.
+	// +optional
+	OrphanCount int `json:"orphanCount,omitempty"`
+	// Orphans are the orphaned images waiting for the end of their grace period, or found in dry run mode.
+	// +listType=map
+	// +listMapKey=image
+	// +kubebuilder:validation:MaxItems=100
+	// +optional
+	Orphans []Orphan `json:"orphans,omitempty"`
+}
+
+// Orphan is an image copied by kuik to a mirror that no status tracks.
+type Orphan struct {
+	Image string `json:"image"`
+	// Digest of the orphaned image when it was found.
+	// +optional
+	Digest string `json:"digest,omitempty"`
+	// FoundAt is when the image was first found orphaned.
+	FoundAt metav1.Time `json:"foundAt"`
 }
 
 type Mirror struct {
@@ -85,10 +424,46 @@ type Mirror struct {
 	Path             string            `json:"path,omitempty"`
 	CredentialSecret *CredentialSecret `json:"credentialSecret,omitempty"`
 	Cleanup          *Cleanup          `json:"cleanup,omitempty"`
+	// Capacity bounds the images mirrored by this resource to this mirror.
+	// +optional
+	Capacity *Capacity `json:"capacity,omitempty"`
 }
 
 type Mirrors []Mirror
 
+// StaticImage is an image, or a set of tags of an image repository, that is
+// always considered in use, whether or not a pod uses it.
+type StaticImage struct {
+	// Image is the image reference, e.g. "docker.io/library/busybox:1.36". When tags is set, it is the
+	// repository whose tags are listed instead, e.g. "docker.io/library/busybox", and must not include a tag.
+	// It may also be an OCI artifact such as a Helm chart, with or without the oci:// scheme.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=256
+	Image string `json:"image"`
+	// Tags is a regular expression matched against the whole tags of the image repository. Every matching tag is
+	// considered in use.
+	// +kubebuilder:validation:MaxLength=128
+	// +kubebuilder:validation:XValidation:rule="''.matches(self) ? true : true",message="tags contains an invalid regular expression"
+	// +optional
+	Tags string `json:"tags,omitempty"`
+}
+
+// +kubebuilder:validation:MaxItems=64
+type StaticImages []StaticImage
+
+// SourceCredential is a secret used to pull images from a source registry prefix.
+type SourceCredential struct {
+	// Registry is the registry of the source images (e.g. docker.io).
+	// +kubebuilder:validation:MinLength=1
+	Registry string `json:"registry"`
+	// Path restricts the secret to the images under this path in the registry.
+	// +optional
+	Path             string           `json:"path,omitempty"`
+	CredentialSecret CredentialSecret `json:"credentialSecret"`
+}
+
+type SourceCredentials []SourceCredential
+
 type CredentialSecret struct {
 	// Name is the name of the secret
 	Name string `json:"name,omitempty"`
@@ -103,12 +478,78 @@ type MatchingImage struct {
 	// +listMapKey=image
 	Mirrors     []MirrorStatus `json:"mirrors,omitempty"`
 	UnusedSince *metav1.Time   `json:"unusedSince,omitempty"`
+	// Replicas is the number of mirrors the image is copied to.
+	// +optional
+	Replicas int `json:"replicas,omitempty"`
+}
+
+type PrefetchedImage struct {
+	Image string `json:"image"`
+	// For is the matching image the image was prefetched for.
+	For string `json:"for,omitempty"`
+	// +listType=map
+	// +listMapKey=image
+	Mirrors     []MirrorStatus `json:"mirrors,omitempty"`
+	UnusedSince *metav1.Time   `json:"unusedSince,omitempty"`
+	// Replicas is the number of mirrors the image is copied to.
+	// +optional
+	Replicas int `json:"replicas,omitempty"`
 }
 
 type MirrorStatus struct {
 	Image      string       `json:"image"`
 	MirroredAt *metav1.Time `json:"mirroredAt,omitempty"`
 	LastError  string       `json:"lastError,omitempty"`
+	// SourceDigest is the digest of the source image that was mirrored, resolved from the
+	// image the pods are actually running when available.
+	SourceDigest string `json:"sourceDigest,omitempty"`
+	// DestinationDigest is the digest of the mirrored image in the destination registry.
+	DestinationDigest string `json:"destinationDigest,omitempty"`
+	// CopiedFrom is the alternative the last copy was made from, pinned to its digest, when the original image was
+	// not available.
+	// +optional
+	CopiedFrom string `json:"copiedFrom,omitempty"`
+	// LastSyncedAt is the last time the mirror was found in sync with its source.
+	LastSyncedAt *metav1.Time `json:"lastSyncedAt,omitempty"`
+	// Size is the total size in bytes of the manifests, configs and layers of the mirrored image.
+	// +optional
+	Size int64 `json:"size,omitempty"`
+	// Layers is the number of distinct layers of the mirrored image.
+	// +optional
+	Layers int `json:"layers,omitempty"`
+	// CopiedBytes is the number of bytes uploaded by the last copy. It is lower than size when some blobs were
+	// already in the destination registry.
+	// +optional
+	CopiedBytes int64 `json:"copiedBytes,omitempty"`
+	// Referrers is the number of artifacts attached to the image copied along with it by the last copy, when the copy
+	// of the referrers is enabled.
+	// +optional
+	Referrers int `json:"referrers,omitempty"`
+	// CopyDuration is how long the last copy took.
+	// +optional
+	CopyDuration *metav1.Duration `json:"copyDuration,omitempty"`
+	// Attempts is the number of consecutive failed copies or resyncs of the image.
+	// +optional
+	Attempts int `json:"attempts,omitempty"`
+	// LastAttemptAt is the last time the image was copied or resynced, successfully or not.
+	// +optional
+	LastAttemptAt *metav1.Time `json:"lastAttemptAt,omitempty"`
+	// NextAttemptAt is when the image is copied or resynced again after a transient failure, with an exponential
+	// backoff.
+	// +optional
+	NextAttemptAt *metav1.Time `json:"nextAttemptAt,omitempty"`
+	// ParkedAtGeneration is the generation of the resource at which the copy or resync of the image failed
+	// permanently, because the source image was not found or provides none of the configured platforms. It is not
+	// attempted again until the spec of the resource changes.
+	// +optional
+	ParkedAtGeneration int64 `json:"parkedAtGeneration,omitempty"`
+	// WaitingForWindowUntil is set while the copy of the image is deferred to the opening of the next copy window.
+	// +optional
+	WaitingForWindowUntil *metav1.Time `json:"waitingForWindowUntil,omitempty"`
+	// UsageRecordedAt is the last time the use of the image by this cluster was recorded in the mirror registry, when
+	// the usage ledger is enabled.
+	// +optional
+	UsageRecordedAt *metav1.Time `json:"usageRecordedAt,omitempty"`
 }
 
 func init() {
@@ -127,6 +568,31 @@ func (m Mirrors) GetCredentialSecretForImage(image string) (cred *CredentialSecr
 	return
 }
 
+// GetCredentialSecretsForImage returns the secrets of every source credential
+// whose prefix matches image, longest prefix first, in declaration order for
+// prefixes of the same length.
+func (s SourceCredentials) GetCredentialSecretsForImage(image string) []CredentialSecret {
+	matching := []SourceCredential{}
+	for _, source := range s {
+		if strings.HasPrefix(image, source.Prefix()) {
+			matching = append(matching, source)
+		}
+	}
+	slices.SortStableFunc(matching, func(a, b SourceCredential) int {
+		return len(b.Prefix()) - len(a.Prefix())
+	})
+
+	creds := make([]CredentialSecret, len(matching))
+	for i := range matching {
+		creds[i] = matching[i].CredentialSecret
+	}
+	return creds
+}
+
+func (s *SourceCredential) Prefix() string {
+	return path.Join(s.Registry, s.Path)
+}
+
 func (i ImageFilterDefinition) Build() (filter.Filter, error) {
 	include := i.Include
 	if len(i.Include) == 0 && len(i.Exclude) > 0 {
@@ -155,6 +621,63 @@ func (i ImageFilterDefinition) MustBuildWithRegistry(registry string) filter.Fil
 	return f
 }
 
+// Matches returns whether image must be checked for drift according to the
+// resync policy.
+func (r *Resync) Matches(image string) (bool, error) {
+	switch r.Policy {
+	case ResyncPolicyInterval:
+		return true, nil
+	case ResyncPolicyMatchingTags:
+		named, err := reference.ParseNormalizedNamed(image)
+		if err != nil {
+			return false, err
+		}
+		tagged, ok := named.(reference.Tagged)
+		if !ok {
+			return false, nil
+		}
+		re, err := regexp.Compile("^(?:" + r.Tags + ")$")
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(tagged.Tag()), nil
+	default:
+		return false, nil
+	}
+}
+
+// GetInterval returns the interval between two drift checks.
+func (r *Resync) GetInterval() time.Duration {
+	if r.Interval.Duration <= 0 {
+		return DefaultResyncInterval
+	}
+	return r.Interval.Duration
+}
+
+// GetInterval returns the interval between two sweeps.
+func (o *OrphanSweep) GetInterval() time.Duration {
+	if o.Interval.Duration <= 0 {
+		return DefaultOrphanSweepInterval
+	}
+	return o.Interval.Duration
+}
+
+// GetGracePeriod returns how long an orphaned image is kept once found.
+func (o *OrphanSweep) GetGracePeriod() time.Duration {
+	if o.GracePeriod.Duration <= 0 {
+		return DefaultOrphanSweepGracePeriod
+	}
+	return o.GracePeriod.Duration
+}
+
+// GetTTLSecondsAfterFinished returns how long a finished copy Job is kept.
+func (j *CopyJob) GetTTLSecondsAfterFinished() int32 {
+	if j.TTLSecondsAfterFinished == nil {
+		return DefaultCopyJobTTLSecondsAfterFinished
+	}
+	return *j.TTLSecondsAfterFinished
+}
+
 func (m *Mirror) Prefix() string {
 	return path.Join(m.Registry, m.Path)
 }
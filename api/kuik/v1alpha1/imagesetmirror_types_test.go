@@ -0,0 +1,72 @@
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSourceCredentialsGetCredentialSecretsForImage(t *testing.T) {
+	g := NewWithT(t)
+
+	sourceCredentials := SourceCredentials{
+		{Registry: "docker.io", CredentialSecret: CredentialSecret{Name: "dockerhub"}},
+		{Registry: "docker.io", Path: "/enix", CredentialSecret: CredentialSecret{Name: "enix"}},
+		{Registry: "quay.io", CredentialSecret: CredentialSecret{Name: "quay"}},
+		{Registry: "docker.io", CredentialSecret: CredentialSecret{Name: "dockerhub-fallback"}},
+	}
+
+	names := func(creds []CredentialSecret) []string {
+		names := []string{}
+		for _, cred := range creds {
+			names = append(names, cred.Name)
+		}
+		return names
+	}
+
+	g.Expect(names(sourceCredentials.GetCredentialSecretsForImage("docker.io/enix/x509-certificate-exporter:3.19.1"))).
+		To(Equal([]string{"enix", "dockerhub", "dockerhub-fallback"}))
+	g.Expect(names(sourceCredentials.GetCredentialSecretsForImage("docker.io/library/nginx:1.25"))).
+		To(Equal([]string{"dockerhub", "dockerhub-fallback"}))
+	g.Expect(sourceCredentials.GetCredentialSecretsForImage("ghcr.io/enix/kube-image-keeper:2.0.0")).To(BeEmpty())
+	g.Expect(SourceCredentials(nil).GetCredentialSecretsForImage("docker.io/library/nginx:1.25")).To(BeEmpty())
+}
+
+func TestResyncMatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		resync  Resync
+		image   string
+		want    bool
+		wantErr bool
+	}{
+		{name: "never by default", resync: Resync{}, image: "docker.io/library/nginx:latest", want: false},
+		{name: "never", resync: Resync{Policy: ResyncPolicyNever}, image: "docker.io/library/nginx:latest", want: false},
+		{name: "interval", resync: Resync{Policy: ResyncPolicyInterval}, image: "docker.io/library/nginx:1.25.3", want: true},
+		{name: "matching tag", resync: Resync{Policy: ResyncPolicyMatchingTags, Tags: `latest|[0-9]+\.[0-9]+`}, image: "docker.io/library/nginx:1.25", want: true},
+		{name: "tag is matched as a whole", resync: Resync{Policy: ResyncPolicyMatchingTags, Tags: `latest|[0-9]+\.[0-9]+`}, image: "docker.io/library/nginx:1.25.3", want: false},
+		{name: "invalid tags", resync: Resync{Policy: ResyncPolicyMatchingTags, Tags: "["}, image: "docker.io/library/nginx:latest", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			match, err := tt.resync.Matches(tt.image)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(match).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestResyncGetInterval(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect((&Resync{}).GetInterval()).To(Equal(DefaultResyncInterval))
+	g.Expect((&Resync{Interval: metav1.Duration{Duration: 10 * time.Minute}}).GetInterval()).To(Equal(10 * time.Minute))
+}
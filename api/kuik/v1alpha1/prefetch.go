@@ -0,0 +1,94 @@
+package v1alpha1
+
+import (
+	"cmp"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+// versionTagRegexp matches tags made of a version with two or three numeric
+// components, optionally prefixed by "v" and followed by a suffix, such as
+// "1.27", "v1.27.1" or "1.27.1-alpine".
+var versionTagRegexp = regexp.MustCompile(`^(v?)([0-9]+)\.([0-9]+)(?:\.([0-9]+))?(.*)$`)
+
+type versionTag struct {
+	tag string
+	// format holds the prefix, the number of components and the suffix of the
+	// tag: only tags of the same format are comparable.
+	format  string
+	numbers [3]int
+}
+
+func parseVersionTag(tag string) (versionTag, bool) {
+	m := versionTagRegexp.FindStringSubmatch(tag)
+	if m == nil {
+		return versionTag{}, false
+	}
+
+	v := versionTag{tag: tag, format: m[1] + "|2|" + m[5]}
+	if m[4] != "" {
+		v.format = m[1] + "|3|" + m[5]
+	}
+	for i, number := range m[2:5] {
+		if number == "" {
+			continue
+		}
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return versionTag{}, false
+		}
+		v.numbers[i] = n
+	}
+	return v, true
+}
+
+func (v versionTag) compare(other versionTag) int {
+	return slices.Compare(v.numbers[:], other.numbers[:])
+}
+
+// GetCount returns the number of tags to prefetch for each matching image.
+func (p *Prefetch) GetCount() int {
+	if p.Count <= 0 {
+		return DefaultPrefetchCount
+	}
+	return p.Count
+}
+
+// Tags returns the tags to prefetch for tag among tags: the newest tags greater
+// than tag, of the same format and satisfying the constraint, newest first. It
+// returns nothing when tag is not a version.
+func (p *Prefetch) Tags(tag string, tags []string) []string {
+	current, ok := parseVersionTag(tag)
+	if !ok {
+		return nil
+	}
+
+	// Number of leading version numbers that must be equal to the ones of tag
+	fixed := 2
+	if p.Constraint == PrefetchConstraintSameMajor {
+		fixed = 1
+	}
+
+	candidates := []versionTag{}
+	for _, t := range tags {
+		candidate, ok := parseVersionTag(t)
+		if !ok || candidate.format != current.format || candidate.compare(current) <= 0 {
+			continue
+		}
+		if !slices.Equal(candidate.numbers[:fixed], current.numbers[:fixed]) {
+			continue
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	slices.SortFunc(candidates, func(a, b versionTag) int {
+		return cmp.Or(b.compare(a), cmp.Compare(a.tag, b.tag))
+	})
+
+	prefetched := []string{}
+	for _, candidate := range candidates[:min(len(candidates), p.GetCount())] {
+		prefetched = append(prefetched, candidate.tag)
+	}
+	return prefetched
+}
@@ -0,0 +1,34 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestPrefetchTags(t *testing.T) {
+	tags := []string{"1.26.0", "1.27.0", "1.27.1", "1.27.2", "1.27.10", "1.28.0", "1.28.1", "2.0.0", "1.27.3-alpine", "1.27", "1.28", "v1.27.5", "latest"}
+
+	tests := []struct {
+		name     string
+		prefetch Prefetch
+		tag      string
+		want     []string
+	}{
+		{name: "same minor by default", prefetch: Prefetch{}, tag: "1.27.1", want: []string{"1.27.10"}},
+		{name: "newest first", prefetch: Prefetch{Count: 3}, tag: "1.27.0", want: []string{"1.27.10", "1.27.2", "1.27.1"}},
+		{name: "same major", prefetch: Prefetch{Constraint: PrefetchConstraintSameMajor, Count: 2}, tag: "1.27.1", want: []string{"1.28.1", "1.28.0"}},
+		{name: "same suffix", prefetch: Prefetch{Count: 2}, tag: "1.27.1-alpine", want: []string{"1.27.3-alpine"}},
+		{name: "same prefix", prefetch: Prefetch{Count: 2}, tag: "v1.27.1", want: []string{"v1.27.5"}},
+		{name: "same number of components", prefetch: Prefetch{Constraint: PrefetchConstraintSameMajor}, tag: "1.27", want: []string{"1.28"}},
+		{name: "already newest", prefetch: Prefetch{}, tag: "1.28.1", want: []string{}},
+		{name: "not a version", prefetch: Prefetch{}, tag: "latest", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(tt.prefetch.Tags(tt.tag, tags)).To(Equal(tt.want))
+		})
+	}
+}
@@ -6,12 +6,26 @@ import (
 
 // --- ReplicatedImageSet (namespaced) ---
 
+func (r *ReplicatedImageSet) ReplicatedSpec() *ReplicatedImageSetBase {
+	return &r.Spec.ReplicatedImageSetBase
+}
+
+func (r *ReplicatedImageSet) ReplicatedStatus() *ReplicatedImageSetStatus { return &r.Status }
+
 func (r *ReplicatedImageSet) PodMatcher() (func(pod *corev1.Pod) bool, error) {
 	return podMatcher(r.Spec.Filter)
 }
 
 // --- ClusterReplicatedImageSet (cluster-scoped) ---
 
+func (c *ClusterReplicatedImageSet) ReplicatedSpec() *ReplicatedImageSetBase {
+	return &c.Spec.ReplicatedImageSetBase
+}
+
+func (c *ClusterReplicatedImageSet) ReplicatedStatus() *ReplicatedImageSetStatus {
+	return (*ReplicatedImageSetStatus)(&c.Status)
+}
+
 func (c *ClusterReplicatedImageSet) PodMatcher() (func(pod *corev1.Pod) bool, error) {
 	return podMatcher(c.Spec.Filter)
 }
@@ -32,11 +32,63 @@ type ReplicatedImageSetSpec struct {
 }
 
 // ReplicatedImageSetStatus defines the observed state of ReplicatedImageSet.
-type ReplicatedImageSetStatus struct{}
+type ReplicatedImageSetStatus struct {
+	// Conditions are the Ready, FilterValid and CredentialsResolved conditions.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Upstreams is the observed state of spec.upstreams, in the same order.
+	// +kubebuilder:validation:MaxItems=32
+	// +optional
+	Upstreams []UpstreamStatus `json:"upstreams,omitempty"`
+}
+
+// UpstreamStatus is the observed state of an upstream of a ReplicatedImageSet.
+type UpstreamStatus struct {
+	Registry string `json:"registry"`
+	Path     string `json:"path,omitempty"`
+	// Error tells why the image filter or the rewrite rule of the upstream is invalid.
+	// An invalid upstream is ignored when routing images.
+	// +optional
+	Error string `json:"error,omitempty"`
+	// CredentialSecretError tells why the credential secret of the upstream could not be read.
+	// +optional
+	CredentialSecretError string `json:"credentialSecretError,omitempty"`
+	// Reachable tells whether the registry answered the last probe. It is not set until the
+	// registry is probed, and upstreams discarding their alternative are not probed.
+	// +optional
+	Reachable *bool `json:"reachable,omitempty"`
+	// LastProbe is the time of the last probe of the registry.
+	// +optional
+	LastProbe *metav1.Time `json:"lastProbe,omitempty"`
+	// ProbeError is the error of the last probe of the registry.
+	// +optional
+	ProbeError string `json:"probeError,omitempty"`
+	// RoutedImages is the number of distinct images, used by the pods matching the resource,
+	// that are currently pulled from this upstream.
+	// +optional
+	RoutedImages int `json:"routedImages,omitempty"`
+	// SyncedImages are the images copied to this upstream from the other ones, when sync is enabled.
+	// +listType=map
+	// +listMapKey=image
+	// +optional
+	SyncedImages []SyncedImage `json:"syncedImages,omitempty"`
+}
+
+// SyncedImage is an image of an upstream kept in sync with its equivalent in another upstream.
+type SyncedImage struct {
+	// From is the image the upstream image is copied from.
+	From         string `json:"from"`
+	MirrorStatus `json:",inline"`
+}
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:shortName=ris
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // ReplicatedImageSet is the Schema for the replicatedimagesets API.
 type ReplicatedImageSet struct {
@@ -73,6 +125,35 @@ type ReplicatedUpstream struct {
 	ImageFilter ImageFilterDefinition `json:"imageFilter"`
 	// CredentialSecret is a reference to the secret used to pull matching images.
 	CredentialSecret *CredentialSecret `json:"credentialSecret,omitempty"`
+	// Sync makes kuik copy to this upstream the images in use that are pulled from the other upstreams
+	// of the resource, when they are missing from it or differ. The credentialSecret of the upstream
+	// must allow to push to it.
+	// +optional
+	Sync bool `json:"sync,omitempty"`
+	// Rewrite declares how images of this upstream map to the other upstreams when the
+	// equivalence is not a plain registry/path prefix swap (renamed repositories, different tag schemes).
+	// +optional
+	Rewrite *UpstreamRewrite `json:"rewrite,omitempty"`
+}
+
+// UpstreamRewrite is a regular expression based equivalence rule. The upstream an image
+// matched captures named groups with Match, and every other upstream builds its own
+// reference from those groups with Replacement. Upstreams without a rewrite rule expose
+// (and expect) the "repository" and "tag" groups, so both kinds can be mixed in one CR.
+type UpstreamRewrite struct {
+	// Match is a regular expression matched against the whole image reference relative to
+	// the upstream registry and path, e.g. "postgres:16.2" for "docker.io/library/postgres:16.2"
+	// with path "/library". Named capture groups ((?P<name>...)) are exposed to the replacement
+	// of the other upstreams.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=256
+	// +kubebuilder:validation:XValidation:rule="''.matches(self) ? true : true",message="match is not a valid regular expression"
+	Match string `json:"match"`
+	// Replacement builds the image reference of this upstream, relative to its registry and path,
+	// from the groups captured by the upstream the image matched. Groups are referenced as ${name}.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=256
+	Replacement string `json:"replacement"`
 }
 
 func init() {
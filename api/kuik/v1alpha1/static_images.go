@@ -0,0 +1,124 @@
+package v1alpha1
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/distribution/reference"
+)
+
+// ociScheme is the scheme prefixing the references of OCI artifacts in some
+// tools, such as Helm.
+const ociScheme = "oci://"
+
+// Repository returns the normalized image reference, or the normalized
+// repository when tags is set. The oci:// scheme of the references of Helm
+// charts is ignored.
+func (s *StaticImage) Repository() (reference.Named, error) {
+	named, err := reference.ParseNormalizedNamed(strings.TrimPrefix(s.Image, ociScheme))
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := named.(reference.Digested); ok {
+		return nil, fmt.Errorf("image %q must not be pinned to a digest", s.Image)
+	}
+	if _, ok := named.(reference.Tagged); ok && s.Tags != "" {
+		return nil, fmt.Errorf("image %q must not include a tag when tags is set", s.Image)
+	}
+	return named, nil
+}
+
+// Matches returns whether image, a normalized image reference, is one of the
+// images selected by the static image.
+func (s *StaticImage) Matches(image string) bool {
+	repository, err := s.Repository()
+	if err != nil {
+		return false
+	}
+	if s.Tags == "" {
+		return repository.String() == image
+	}
+
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil || named.Name() != repository.Name() {
+		return false
+	}
+	tagged, ok := named.(reference.Tagged)
+	if !ok {
+		return false
+	}
+	re, err := s.compileTags()
+	return err == nil && re.MatchString(tagged.Tag())
+}
+
+// Resolve returns the normalized references of the images selected by the
+// static image. listTags is only called when tags is set, to list the tags of
+// the repository.
+func (s *StaticImage) Resolve(listTags func(repository string) ([]string, error)) ([]string, error) {
+	repository, err := s.Repository()
+	if err != nil {
+		return nil, err
+	}
+	if s.Tags == "" {
+		return []string{repository.String()}, nil
+	}
+
+	re, err := s.compileTags()
+	if err != nil {
+		return nil, err
+	}
+	tags, err := listTags(repository.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	images := []string{}
+	for _, tag := range tags {
+		if !re.MatchString(tag) {
+			continue
+		}
+		tagged, err := reference.WithTag(repository, tag)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, tagged.String())
+	}
+	return images, nil
+}
+
+func (s *StaticImage) compileTags() (*regexp.Regexp, error) {
+	re, err := regexp.Compile("^(?:" + s.Tags + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid tags: %w", err)
+	}
+	return re, nil
+}
+
+// Matches returns whether image is selected by any of the static images.
+func (s StaticImages) Matches(image string) bool {
+	for i := range s {
+		if s[i].Matches(image) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the normalized references of the images selected by all the
+// static images. Static images that cannot be resolved are skipped and their
+// errors joined.
+func (s StaticImages) Resolve(listTags func(repository string) ([]string, error)) ([]string, error) {
+	images := []string{}
+	errs := []error{}
+	for i := range s {
+		resolved, err := s[i].Resolve(listTags)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("images[%d]: %w", i, err))
+			continue
+		}
+		images = append(images, resolved...)
+	}
+	return images, errors.Join(errs...)
+}
@@ -0,0 +1,69 @@
+package v1alpha1
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestStaticImagesMatches(t *testing.T) {
+	staticImages := StaticImages{
+		{Image: "busybox:1.36"},
+		{Image: "ghcr.io/enix/kube-image-keeper", Tags: `2\.[0-9]+\.[0-9]+`},
+		{Image: "oci://ghcr.io/enix/charts/kube-image-keeper:2.0.0"},
+	}
+
+	tests := []struct {
+		name  string
+		image string
+		want  bool
+	}{
+		{name: "normalized image", image: "docker.io/library/busybox:1.36", want: true},
+		{name: "other tag", image: "docker.io/library/busybox:1.37", want: false},
+		{name: "matching tag", image: "ghcr.io/enix/kube-image-keeper:2.1.0", want: true},
+		{name: "tag is matched as a whole", image: "ghcr.io/enix/kube-image-keeper:2.1.0-rc1", want: false},
+		{name: "other repository", image: "ghcr.io/enix/x509-certificate-exporter:2.1.0", want: false},
+		{name: "helm chart without its scheme", image: "ghcr.io/enix/charts/kube-image-keeper:2.0.0", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(staticImages.Matches(tt.image)).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestStaticImagesResolve(t *testing.T) {
+	g := NewWithT(t)
+
+	listed := []string{}
+	listTags := func(repository string) ([]string, error) {
+		listed = append(listed, repository)
+		if repository == "quay.io/unreachable" {
+			return nil, errors.New("unreachable")
+		}
+		return []string{"1.0.0", "1.1.0", "latest"}, nil
+	}
+
+	images, err := StaticImages{
+		{Image: "busybox"},
+		{Image: "ghcr.io/enix/kube-image-keeper", Tags: `1\..*`},
+		{Image: "quay.io/unreachable", Tags: ".*"},
+		{Image: "nginx:1.25", Tags: ".*"},
+		{Image: "nginx@sha256:0000000000000000000000000000000000000000000000000000000000000000"},
+		{Image: "oci://ghcr.io/enix/charts/kube-image-keeper", Tags: `1\.1\..*`},
+	}.Resolve(listTags)
+
+	g.Expect(images).To(Equal([]string{
+		"docker.io/library/busybox",
+		"ghcr.io/enix/kube-image-keeper:1.0.0",
+		"ghcr.io/enix/kube-image-keeper:1.1.0",
+		"ghcr.io/enix/charts/kube-image-keeper:1.1.0",
+	}))
+	g.Expect(listed).To(Equal([]string{"ghcr.io/enix/kube-image-keeper", "quay.io/unreachable", "ghcr.io/enix/charts/kube-image-keeper"}))
+	g.Expect(err).To(MatchError(ContainSubstring("images[2]: unreachable")))
+	g.Expect(err).To(MatchError(ContainSubstring("images[3]")))
+	g.Expect(err).To(MatchError(ContainSubstring("images[4]")))
+}
@@ -0,0 +1,203 @@
+package v1alpha1
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/distribution/reference"
+)
+
+// Groups captured by, and expected from, upstreams without a rewrite rule.
+const (
+	RewriteRepositoryGroup = "repository"
+	RewriteTagGroup        = "tag"
+)
+
+var (
+	replacementPlaceholder = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+	prefixGroups           = []string{RewriteRepositoryGroup, RewriteTagGroup}
+)
+
+// Prefix returns the registry and path joined, the part of an image reference
+// that is swapped between upstreams that do not declare a rewrite rule.
+func (u *ReplicatedUpstream) Prefix() string {
+	return path.Join(u.Registry, u.Path)
+}
+
+// MatchesRewrite reports whether image can be captured by the upstream rewrite
+// rule. It is always true for upstreams without a rewrite rule.
+func (u *ReplicatedUpstream) MatchesRewrite(image string) bool {
+	if u.Rewrite == nil {
+		return true
+	}
+	_, ok, err := u.capture(image)
+	return ok && err == nil
+}
+
+// Translate returns the equivalent on this upstream of image, which matched the
+// from upstream. When neither upstream declares a rewrite rule, the from prefix
+// is swapped for this upstream prefix, otherwise the groups captured by from are
+// expanded into this upstream replacement.
+func (u *ReplicatedUpstream) Translate(from *ReplicatedUpstream, image string) (string, error) {
+	if from.Rewrite == nil && u.Rewrite == nil {
+		return u.Prefix() + strings.TrimPrefix(image, from.Prefix()), nil
+	}
+
+	groups, ok, err := from.capture(image)
+	if err != nil {
+		return "", err
+	} else if !ok {
+		return "", fmt.Errorf("image %q is not matched by the rewrite rule of upstream %q", image, from.Prefix())
+	}
+
+	var relative string
+	if u.Rewrite == nil {
+		relative = groups[RewriteRepositoryGroup]
+		if tag := groups[RewriteTagGroup]; tag != "" {
+			relative += ":" + tag
+		}
+	} else if relative, err = expandReplacement(u.Rewrite.Replacement, groups); err != nil {
+		return "", err
+	}
+
+	translated := path.Join(u.Prefix(), relative)
+	if _, err := reference.ParseNormalizedNamed(translated); err != nil {
+		return "", fmt.Errorf("rewritten image %q is not a valid reference: %w", translated, err)
+	}
+
+	return translated, nil
+}
+
+// ValidateRewrites checks that every upstream rewrite rule compiles and that
+// each upstream can build its reference from the groups captured by every other
+// upstream.
+func (b *ReplicatedImageSetBase) ValidateRewrites() error {
+	provided := make([][]string, len(b.Upstreams))
+	errs := []error{}
+	for i := range b.Upstreams {
+		groups, err := b.Upstreams[i].Rewrite.groups()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("upstreams[%d]: %w", i, err))
+		}
+		provided[i] = groups
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	for i := range b.Upstreams {
+		required := b.Upstreams[i].Rewrite.placeholders()
+		for j := range b.Upstreams {
+			if i == j {
+				continue
+			}
+			for _, group := range required {
+				if !slices.Contains(provided[j], group) {
+					errs = append(errs, fmt.Errorf("upstreams[%d] needs group %q which is not captured by upstreams[%d]", i, group, j))
+				}
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Validate compiles the rewrite rule. A nil rule is valid.
+func (r *UpstreamRewrite) Validate() error {
+	_, err := r.groups()
+	return err
+}
+
+func (r *UpstreamRewrite) compile() (*regexp.Regexp, error) {
+	re, err := regexp.Compile("^(?:" + r.Match + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid rewrite match: %w", err)
+	}
+	return re, nil
+}
+
+// groups returns the named groups captured by the rule, or the implicit
+// repository and tag groups when there is no rule.
+func (r *UpstreamRewrite) groups() ([]string, error) {
+	if r == nil {
+		return prefixGroups, nil
+	}
+	re, err := r.compile()
+	if err != nil {
+		return nil, err
+	}
+	groups := []string{}
+	for _, name := range re.SubexpNames() {
+		if name != "" {
+			groups = append(groups, name)
+		}
+	}
+	return groups, nil
+}
+
+// placeholders returns the groups referenced by the replacement, or the
+// implicit repository and tag groups when there is no rule.
+func (r *UpstreamRewrite) placeholders() []string {
+	if r == nil {
+		return prefixGroups
+	}
+	placeholders := []string{}
+	for _, match := range replacementPlaceholder.FindAllStringSubmatch(r.Replacement, -1) {
+		placeholders = append(placeholders, match[1])
+	}
+	return placeholders
+}
+
+// capture extracts the rewrite groups from image. Upstreams without a rewrite
+// rule split the part following their prefix into repository and tag.
+func (u *ReplicatedUpstream) capture(image string) (map[string]string, bool, error) {
+	prefix := u.Prefix()
+	if !strings.HasPrefix(image, prefix) {
+		return nil, false, nil
+	}
+	relative := strings.TrimPrefix(strings.TrimPrefix(image, prefix), "/")
+
+	if u.Rewrite == nil {
+		repository, tag := relative, ""
+		if i := strings.LastIndex(relative, ":"); i >= 0 && !strings.Contains(relative[i:], "/") {
+			repository, tag = relative[:i], relative[i+1:]
+		}
+		return map[string]string{RewriteRepositoryGroup: repository, RewriteTagGroup: tag}, true, nil
+	}
+
+	re, err := u.Rewrite.compile()
+	if err != nil {
+		return nil, false, err
+	}
+	match := re.FindStringSubmatch(relative)
+	if match == nil {
+		return nil, false, nil
+	}
+	groups := map[string]string{}
+	for i, name := range re.SubexpNames() {
+		if name != "" {
+			groups[name] = match[i]
+		}
+	}
+	return groups, true, nil
+}
+
+func expandReplacement(replacement string, groups map[string]string) (string, error) {
+	var missing []string
+	expanded := replacementPlaceholder.ReplaceAllStringFunc(replacement, func(placeholder string) string {
+		name := replacementPlaceholder.FindStringSubmatch(placeholder)[1]
+		value, ok := groups[name]
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("replacement %q references uncaptured group(s): %s", replacement, strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
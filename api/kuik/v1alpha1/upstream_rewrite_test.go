@@ -0,0 +1,142 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestUpstreamTranslate(t *testing.T) {
+	dockerHub := ReplicatedUpstream{ImageReference: ImageReference{Registry: "docker.io", Path: "/library"}}
+	corp := ReplicatedUpstream{
+		ImageReference: ImageReference{Registry: "registry.corp", Path: "/dockerhub"},
+		Rewrite: &UpstreamRewrite{
+			Match:       `(?P<repository>[^:]+):(?P<tag>.+)-corp`,
+			Replacement: "${repository}:${tag}-corp",
+		},
+	}
+	bitnami := ReplicatedUpstream{
+		ImageReference: ImageReference{Registry: "docker.io", Path: "/bitnami"},
+		Rewrite: &UpstreamRewrite{
+			Match:       `postgresql:(?P<version>[0-9.]+)-debian`,
+			Replacement: "postgresql:${version}-debian",
+		},
+	}
+	plainMirror := ReplicatedUpstream{ImageReference: ImageReference{Registry: "mirror.example.com", Path: "/hub"}}
+
+	tests := []struct {
+		name     string
+		from, to ReplicatedUpstream
+		image    string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "prefix swap when neither upstream rewrites",
+			from:     dockerHub,
+			to:       plainMirror,
+			image:    "docker.io/library/postgres:16.2",
+			expected: "mirror.example.com/hub/postgres:16.2",
+		},
+		{
+			name:     "prefix upstream feeds repository and tag into a rewrite",
+			from:     dockerHub,
+			to:       corp,
+			image:    "docker.io/library/postgres:16.2",
+			expected: "registry.corp/dockerhub/postgres:16.2-corp",
+		},
+		{
+			name:     "rewrite upstream feeds repository and tag into a prefix upstream",
+			from:     corp,
+			to:       dockerHub,
+			image:    "registry.corp/dockerhub/postgres:16.2-corp",
+			expected: "docker.io/library/postgres:16.2",
+		},
+		{
+			name:     "rewrite upstream feeds another prefix upstream",
+			from:     corp,
+			to:       plainMirror,
+			image:    "registry.corp/dockerhub/postgres:16.2-corp",
+			expected: "mirror.example.com/hub/postgres:16.2",
+		},
+		{
+			name:    "image not matched by the rewrite rule",
+			from:    corp,
+			to:      dockerHub,
+			image:   "registry.corp/dockerhub/postgres:16.2",
+			wantErr: true,
+		},
+		{
+			name:    "replacement references a group the source does not capture",
+			from:    dockerHub,
+			to:      bitnami,
+			image:   "docker.io/library/postgres:16.2",
+			wantErr: true,
+		},
+		{
+			name:    "rewritten reference is invalid",
+			from:    ReplicatedUpstream{ImageReference: ImageReference{Registry: "docker.io", Path: "/library"}},
+			to:      ReplicatedUpstream{ImageReference: ImageReference{Registry: "registry.corp"}, Rewrite: &UpstreamRewrite{Match: ".*", Replacement: "${repository}::${tag}"}},
+			image:   "docker.io/library/postgres:16.2",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			translated, err := tt.to.Translate(&tt.from, tt.image)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(translated).To(Equal(tt.expected))
+		})
+	}
+}
+
+func TestUpstreamMatchesRewrite(t *testing.T) {
+	g := NewWithT(t)
+
+	upstream := ReplicatedUpstream{
+		ImageReference: ImageReference{Registry: "registry.corp", Path: "/dockerhub"},
+		Rewrite:        &UpstreamRewrite{Match: `(?P<repository>[^:]+):(?P<tag>.+)-corp`, Replacement: "${repository}:${tag}-corp"},
+	}
+
+	g.Expect(upstream.MatchesRewrite("registry.corp/dockerhub/postgres:16.2-corp")).To(BeTrue())
+	g.Expect(upstream.MatchesRewrite("registry.corp/dockerhub/postgres:16.2")).To(BeFalse())
+	g.Expect(upstream.MatchesRewrite("docker.io/library/postgres:16.2-corp")).To(BeFalse())
+
+	upstream.Rewrite = nil
+	g.Expect(upstream.MatchesRewrite("docker.io/library/postgres:16.2")).To(BeTrue())
+}
+
+func TestValidateRewrites(t *testing.T) {
+	g := NewWithT(t)
+
+	base := ReplicatedImageSetBase{Upstreams: []ReplicatedUpstream{
+		{ImageReference: ImageReference{Registry: "docker.io", Path: "/library"}},
+		{
+			ImageReference: ImageReference{Registry: "registry.corp", Path: "/dockerhub"},
+			Rewrite:        &UpstreamRewrite{Match: `(?P<repository>[^:]+):(?P<tag>.+)-corp`, Replacement: "${repository}:${tag}-corp"},
+		},
+	}}
+	g.Expect(base.ValidateRewrites()).To(Succeed())
+
+	withRewrite := func(match, replacement string) ReplicatedImageSetBase {
+		invalid := *base.DeepCopy()
+		invalid.Upstreams[1].Rewrite = &UpstreamRewrite{Match: match, Replacement: replacement}
+		return invalid
+	}
+
+	invalid := withRewrite("(", "${repository}")
+	g.Expect(invalid.ValidateRewrites()).To(MatchError(ContainSubstring("upstreams[1]: invalid rewrite match")))
+
+	// The prefix upstream needs repository and tag from the rewrite upstream.
+	invalid = withRewrite(`(?P<name>[^:]+):(?P<tag>.+)`, "${name}:${tag}")
+	g.Expect(invalid.ValidateRewrites()).To(MatchError(ContainSubstring(`upstreams[0] needs group "repository" which is not captured by upstreams[1]`)))
+	g.Expect(invalid.ValidateRewrites()).To(MatchError(ContainSubstring(`upstreams[1] needs group "name" which is not captured by upstreams[0]`)))
+
+	g.Expect((*UpstreamRewrite)(nil).Validate()).To(Succeed())
+}
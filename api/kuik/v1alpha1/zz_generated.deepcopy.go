@@ -5,9 +5,31 @@
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Capacity) DeepCopyInto(out *Capacity) {
+	*out = *in
+	if in.MaxSize != nil {
+		in, out := &in.MaxSize, &out.MaxSize
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Capacity.
+func (in *Capacity) DeepCopy() *Capacity {
+	if in == nil {
+		return nil
+	}
+	out := new(Capacity)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Cleanup) DeepCopyInto(out *Cleanup) {
 	*out = *in
@@ -24,6 +46,29 @@ func (in *Cleanup) DeepCopy() *Cleanup {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CleanupReport) DeepCopyInto(out *CleanupReport) {
+	*out = *in
+	in.EvaluatedAt.DeepCopyInto(&out.EvaluatedAt)
+	if in.Deletions != nil {
+		in, out := &in.Deletions, &out.Deletions
+		*out = make([]PlannedDeletion, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CleanupReport.
+func (in *CleanupReport) DeepCopy() *CleanupReport {
+	if in == nil {
+		return nil
+	}
+	out := new(CleanupReport)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterFilter) DeepCopyInto(out *ClusterFilter) {
 	*out = *in
@@ -130,6 +175,11 @@ func (in *ClusterImageSetAvailabilitySpec) DeepCopyInto(out *ClusterImageSetAvai
 	out.UnusedImageExpiry = in.UnusedImageExpiry
 	in.ImageFilter.DeepCopyInto(&out.ImageFilter)
 	in.Filter.DeepCopyInto(&out.Filter)
+	if in.Images != nil {
+		in, out := &in.Images, &out.Images
+		*out = make(StaticImages, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterImageSetAvailabilitySpec.
@@ -152,6 +202,13 @@ func (in *ClusterImageSetAvailabilityStatus) DeepCopyInto(out *ClusterImageSetAv
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterImageSetAvailabilityStatus.
@@ -250,6 +307,30 @@ func (in *ClusterImageSetMirrorStatus) DeepCopyInto(out *ClusterImageSetMirrorSt
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.PrefetchedImages != nil {
+		in, out := &in.PrefetchedImages, &out.PrefetchedImages
+		*out = make([]PrefetchedImage, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.CleanupReport != nil {
+		in, out := &in.CleanupReport, &out.CleanupReport
+		*out = new(CleanupReport)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OrphanSweep != nil {
+		in, out := &in.OrphanSweep, &out.OrphanSweep
+		*out = new(OrphanSweepStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterImageSetMirrorStatus.
@@ -268,7 +349,7 @@ func (in *ClusterReplicatedImageSet) DeepCopyInto(out *ClusterReplicatedImageSet
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterReplicatedImageSet.
@@ -341,6 +422,20 @@ func (in *ClusterReplicatedImageSetSpec) DeepCopy() *ClusterReplicatedImageSetSp
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterReplicatedImageSetStatus) DeepCopyInto(out *ClusterReplicatedImageSetStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Upstreams != nil {
+		in, out := &in.Upstreams, &out.Upstreams
+		*out = make([]UpstreamStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterReplicatedImageSetStatus.
@@ -353,6 +448,89 @@ func (in *ClusterReplicatedImageSetStatus) DeepCopy() *ClusterReplicatedImageSet
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Copy) DeepCopyInto(out *Copy) {
+	*out = *in
+	in.Job.DeepCopyInto(&out.Job)
+	if in.Windows != nil {
+		in, out := &in.Windows, &out.Windows
+		*out = make([]CopyWindow, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Copy.
+func (in *Copy) DeepCopy() *Copy {
+	if in == nil {
+		return nil
+	}
+	out := new(Copy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CopyJob) DeepCopyInto(out *CopyJob) {
+	*out = *in
+	in.Resources.DeepCopyInto(&out.Resources)
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]corev1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ActiveDeadlineSeconds != nil {
+		in, out := &in.ActiveDeadlineSeconds, &out.ActiveDeadlineSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.TTLSecondsAfterFinished != nil {
+		in, out := &in.TTLSecondsAfterFinished, &out.TTLSecondsAfterFinished
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CopyJob.
+func (in *CopyJob) DeepCopy() *CopyJob {
+	if in == nil {
+		return nil
+	}
+	out := new(CopyJob)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CopyWindow) DeepCopyInto(out *CopyWindow) {
+	*out = *in
+	if in.Days != nil {
+		in, out := &in.Days, &out.Days
+		*out = make([]Weekday, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CopyWindow.
+func (in *CopyWindow) DeepCopy() *CopyWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(CopyWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CredentialSecret) DeepCopyInto(out *CredentialSecret) {
 	*out = *in
@@ -487,6 +665,21 @@ func (in *ImageSetMirrorBase) DeepCopyInto(out *ImageSetMirrorBase) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	in.Capacity.DeepCopyInto(&out.Capacity)
+	out.Resync = in.Resync
+	out.Prefetch = in.Prefetch
+	in.Copy.DeepCopyInto(&out.Copy)
+	out.OrphanSweep = in.OrphanSweep
+	if in.Images != nil {
+		in, out := &in.Images, &out.Images
+		*out = make(StaticImages, len(*in))
+		copy(*out, *in)
+	}
+	if in.SourceCredentials != nil {
+		in, out := &in.SourceCredentials, &out.SourceCredentials
+		*out = make(SourceCredentials, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageSetMirrorBase.
@@ -558,6 +751,30 @@ func (in *ImageSetMirrorStatus) DeepCopyInto(out *ImageSetMirrorStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.PrefetchedImages != nil {
+		in, out := &in.PrefetchedImages, &out.PrefetchedImages
+		*out = make([]PrefetchedImage, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.CleanupReport != nil {
+		in, out := &in.CleanupReport, &out.CleanupReport
+		*out = new(CleanupReport)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OrphanSweep != nil {
+		in, out := &in.OrphanSweep, &out.OrphanSweep
+		*out = new(OrphanSweepStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageSetMirrorStatus.
@@ -634,6 +851,11 @@ func (in *Mirror) DeepCopyInto(out *Mirror) {
 		*out = new(Cleanup)
 		**out = **in
 	}
+	if in.Capacity != nil {
+		in, out := &in.Capacity, &out.Capacity
+		*out = new(Capacity)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Mirror.
@@ -653,6 +875,31 @@ func (in *MirrorStatus) DeepCopyInto(out *MirrorStatus) {
 		in, out := &in.MirroredAt, &out.MirroredAt
 		*out = (*in).DeepCopy()
 	}
+	if in.LastSyncedAt != nil {
+		in, out := &in.LastSyncedAt, &out.LastSyncedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.CopyDuration != nil {
+		in, out := &in.CopyDuration, &out.CopyDuration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.LastAttemptAt != nil {
+		in, out := &in.LastAttemptAt, &out.LastAttemptAt
+		*out = (*in).DeepCopy()
+	}
+	if in.NextAttemptAt != nil {
+		in, out := &in.NextAttemptAt, &out.NextAttemptAt
+		*out = (*in).DeepCopy()
+	}
+	if in.WaitingForWindowUntil != nil {
+		in, out := &in.WaitingForWindowUntil, &out.WaitingForWindowUntil
+		*out = (*in).DeepCopy()
+	}
+	if in.UsageRecordedAt != nil {
+		in, out := &in.UsageRecordedAt, &out.UsageRecordedAt
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MirrorStatus.
@@ -709,13 +956,130 @@ func (in *MonitoredImage) DeepCopy() *MonitoredImage {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Orphan) DeepCopyInto(out *Orphan) {
+	*out = *in
+	in.FoundAt.DeepCopyInto(&out.FoundAt)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Orphan.
+func (in *Orphan) DeepCopy() *Orphan {
+	if in == nil {
+		return nil
+	}
+	out := new(Orphan)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OrphanSweep) DeepCopyInto(out *OrphanSweep) {
+	*out = *in
+	out.Interval = in.Interval
+	out.GracePeriod = in.GracePeriod
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OrphanSweep.
+func (in *OrphanSweep) DeepCopy() *OrphanSweep {
+	if in == nil {
+		return nil
+	}
+	out := new(OrphanSweep)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OrphanSweepStatus) DeepCopyInto(out *OrphanSweepStatus) {
+	*out = *in
+	if in.LastSweepTime != nil {
+		in, out := &in.LastSweepTime, &out.LastSweepTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Orphans != nil {
+		in, out := &in.Orphans, &out.Orphans
+		*out = make([]Orphan, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OrphanSweepStatus.
+func (in *OrphanSweepStatus) DeepCopy() *OrphanSweepStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(OrphanSweepStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlannedDeletion) DeepCopyInto(out *PlannedDeletion) {
+	*out = *in
+	in.DeleteAt.DeepCopyInto(&out.DeleteAt)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlannedDeletion.
+func (in *PlannedDeletion) DeepCopy() *PlannedDeletion {
+	if in == nil {
+		return nil
+	}
+	out := new(PlannedDeletion)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Prefetch) DeepCopyInto(out *Prefetch) {
+	*out = *in
+	out.Retention = in.Retention
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Prefetch.
+func (in *Prefetch) DeepCopy() *Prefetch {
+	if in == nil {
+		return nil
+	}
+	out := new(Prefetch)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrefetchedImage) DeepCopyInto(out *PrefetchedImage) {
+	*out = *in
+	if in.Mirrors != nil {
+		in, out := &in.Mirrors, &out.Mirrors
+		*out = make([]MirrorStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.UnusedSince != nil {
+		in, out := &in.UnusedSince, &out.UnusedSince
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrefetchedImage.
+func (in *PrefetchedImage) DeepCopy() *PrefetchedImage {
+	if in == nil {
+		return nil
+	}
+	out := new(PrefetchedImage)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ReplicatedImageSet) DeepCopyInto(out *ReplicatedImageSet) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReplicatedImageSet.
@@ -810,6 +1174,20 @@ func (in *ReplicatedImageSetSpec) DeepCopy() *ReplicatedImageSetSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ReplicatedImageSetStatus) DeepCopyInto(out *ReplicatedImageSetStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Upstreams != nil {
+		in, out := &in.Upstreams, &out.Upstreams
+		*out = make([]UpstreamStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReplicatedImageSetStatus.
@@ -832,6 +1210,11 @@ func (in *ReplicatedUpstream) DeepCopyInto(out *ReplicatedUpstream) {
 		*out = new(CredentialSecret)
 		**out = **in
 	}
+	if in.Rewrite != nil {
+		in, out := &in.Rewrite, &out.Rewrite
+		*out = new(UpstreamRewrite)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReplicatedUpstream.
@@ -843,3 +1226,150 @@ func (in *ReplicatedUpstream) DeepCopy() *ReplicatedUpstream {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Resync) DeepCopyInto(out *Resync) {
+	*out = *in
+	out.Interval = in.Interval
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Resync.
+func (in *Resync) DeepCopy() *Resync {
+	if in == nil {
+		return nil
+	}
+	out := new(Resync)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SourceCredential) DeepCopyInto(out *SourceCredential) {
+	*out = *in
+	out.CredentialSecret = in.CredentialSecret
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SourceCredential.
+func (in *SourceCredential) DeepCopy() *SourceCredential {
+	if in == nil {
+		return nil
+	}
+	out := new(SourceCredential)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in SourceCredentials) DeepCopyInto(out *SourceCredentials) {
+	{
+		in := &in
+		*out = make(SourceCredentials, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SourceCredentials.
+func (in SourceCredentials) DeepCopy() SourceCredentials {
+	if in == nil {
+		return nil
+	}
+	out := new(SourceCredentials)
+	in.DeepCopyInto(out)
+	return *out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StaticImage) DeepCopyInto(out *StaticImage) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StaticImage.
+func (in *StaticImage) DeepCopy() *StaticImage {
+	if in == nil {
+		return nil
+	}
+	out := new(StaticImage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in StaticImages) DeepCopyInto(out *StaticImages) {
+	{
+		in := &in
+		*out = make(StaticImages, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StaticImages.
+func (in StaticImages) DeepCopy() StaticImages {
+	if in == nil {
+		return nil
+	}
+	out := new(StaticImages)
+	in.DeepCopyInto(out)
+	return *out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SyncedImage) DeepCopyInto(out *SyncedImage) {
+	*out = *in
+	in.MirrorStatus.DeepCopyInto(&out.MirrorStatus)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SyncedImage.
+func (in *SyncedImage) DeepCopy() *SyncedImage {
+	if in == nil {
+		return nil
+	}
+	out := new(SyncedImage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UpstreamRewrite) DeepCopyInto(out *UpstreamRewrite) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UpstreamRewrite.
+func (in *UpstreamRewrite) DeepCopy() *UpstreamRewrite {
+	if in == nil {
+		return nil
+	}
+	out := new(UpstreamRewrite)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UpstreamStatus) DeepCopyInto(out *UpstreamStatus) {
+	*out = *in
+	if in.Reachable != nil {
+		in, out := &in.Reachable, &out.Reachable
+		*out = new(bool)
+		**out = **in
+	}
+	if in.LastProbe != nil {
+		in, out := &in.LastProbe, &out.LastProbe
+		*out = (*in).DeepCopy()
+	}
+	if in.SyncedImages != nil {
+		in, out := &in.SyncedImages, &out.SyncedImages
+		*out = make([]SyncedImage, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UpstreamStatus.
+func (in *UpstreamStatus) DeepCopy() *UpstreamStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(UpstreamStatus)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"crypto/tls"
 	"flag"
+	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -30,7 +31,9 @@ import (
 	"github.com/enix/kube-image-keeper/internal/config"
 	"github.com/enix/kube-image-keeper/internal/controller"
 	kuikcontroller "github.com/enix/kube-image-keeper/internal/controller/kuik"
+	"github.com/enix/kube-image-keeper/internal/copier"
 	"github.com/enix/kube-image-keeper/internal/info"
+	"github.com/enix/kube-image-keeper/internal/registry"
 	webhookcorev1 "github.com/enix/kube-image-keeper/internal/webhook/core/v1"
 	// +kubebuilder:scaffold:imports
 )
@@ -49,6 +52,14 @@ func init() {
 
 // nolint:gocyclo
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == copier.Command {
+		if err := copier.Run(ctrl.SetupSignalHandler(), os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var metricsAddr string
 	var metricsCertPath, metricsCertName, metricsCertKey string
 	var webhookCertPath, webhookCertName, webhookCertKey string
@@ -106,6 +117,14 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Copy jobs run the image of the manager in its namespace unless configured otherwise
+	if configuration.Mirroring.Jobs.Image == "" {
+		configuration.Mirroring.Jobs.Image = os.Getenv("MANAGER_IMAGE")
+	}
+	if configuration.Mirroring.Jobs.Namespace == "" {
+		configuration.Mirroring.Jobs.Namespace = os.Getenv("POD_NAMESPACE")
+	}
+
 	if err := configuration.Validate(); err != nil {
 		setupLog.Error(err, "Invalid configuration")
 		os.Exit(1)
@@ -165,12 +184,14 @@ func main() {
 	// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.20.4/pkg/metrics/server
 	// - https://book.kubebuilder.io/reference/metrics.html
 	statusHandler := &controller.StatusHandler{}
+	cleanupReportHandler := &controller.CleanupReportHandler{}
 	metricsServerOptions := metricsserver.Options{
 		BindAddress:   metricsAddr,
 		SecureServing: secureMetrics,
 		TLSOpts:       tlsOpts,
 		ExtraHandlers: map[string]http.Handler{
-			"/status/images": statusHandler,
+			"/status/images":  statusHandler,
+			"/status/cleanup": cleanupReportHandler,
 		},
 	}
 
@@ -234,6 +255,7 @@ func main() {
 	}
 
 	statusHandler.Client = mgr.GetClient()
+	cleanupReportHandler.Client = mgr.GetClient()
 
 	// nolint:goconst
 	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
@@ -246,11 +268,20 @@ func main() {
 			os.Exit(1)
 		}
 	}
+	copyPool := kuikcontroller.NewCopyPool(configuration.Mirroring.Concurrency)
+	if err = mgr.Add(copyPool); err != nil {
+		setupLog.Error(err, "unable to add copy pool")
+		os.Exit(1)
+	}
+	bandwidth := configuration.Mirroring.Bandwidth
+	bandwidthLimiter := registry.NewBandwidthLimiter(bandwidth.MaxBytesPerSecond, bandwidth.PerDestinationRegistry.MaxBytesPerSecond)
 	if err = (&kuikcontroller.ClusterImageSetMirrorReconciler{
 		ImageSetMirrorBaseReconciler: kuikcontroller.ImageSetMirrorBaseReconciler{
-			Client: mgr.GetClient(),
-			Scheme: mgr.GetScheme(),
-			Config: configuration,
+			Client:           mgr.GetClient(),
+			Scheme:           mgr.GetScheme(),
+			Config:           configuration,
+			CopyPool:         copyPool,
+			BandwidthLimiter: bandwidthLimiter,
 		},
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ClusterImageSetMirror")
@@ -258,9 +289,11 @@ func main() {
 	}
 	if err = (&kuikcontroller.ImageSetMirrorReconciler{
 		ImageSetMirrorBaseReconciler: kuikcontroller.ImageSetMirrorBaseReconciler{
-			Client: mgr.GetClient(),
-			Scheme: mgr.GetScheme(),
-			Config: configuration,
+			Client:           mgr.GetClient(),
+			Scheme:           mgr.GetScheme(),
+			Config:           configuration,
+			CopyPool:         copyPool,
+			BandwidthLimiter: bandwidthLimiter,
 		},
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ImageSetMirror")
@@ -282,6 +315,30 @@ func main() {
 		setupLog.Error(err, "unable to create controller", "controller", "ClusterReplicatedImageSetSecretOwner")
 		os.Exit(1)
 	}
+	if err = (&kuikcontroller.ReplicatedImageSetReconciler{
+		ReplicatedImageSetBaseReconciler: kuikcontroller.ReplicatedImageSetBaseReconciler{
+			Client:           mgr.GetClient(),
+			Scheme:           mgr.GetScheme(),
+			Config:           configuration,
+			CopyPool:         copyPool,
+			BandwidthLimiter: bandwidthLimiter,
+		},
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ReplicatedImageSet")
+		os.Exit(1)
+	}
+	if err = (&kuikcontroller.ClusterReplicatedImageSetReconciler{
+		ReplicatedImageSetBaseReconciler: kuikcontroller.ReplicatedImageSetBaseReconciler{
+			Client:           mgr.GetClient(),
+			Scheme:           mgr.GetScheme(),
+			Config:           configuration,
+			CopyPool:         copyPool,
+			BandwidthLimiter: bandwidthLimiter,
+		},
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterReplicatedImageSet")
+		os.Exit(1)
+	}
 	cisaReconciler := &kuikcontroller.ClusterImageSetAvailabilityReconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
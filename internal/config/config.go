@@ -4,6 +4,7 @@ import (
 	"errors"
 	"net/http"
 	"os"
+	"slices"
 	"time"
 
 	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
@@ -16,18 +17,27 @@ import (
 )
 
 type Config struct {
-	SkipLabels      []string   `koanf:"skipLabels"`
-	SkipAnnotations []string   `koanf:"skipAnnotations"`
-	Routing         Routing    `koanf:"routing"`
-	Mirroring       Mirroring  `koanf:"mirroring"`
-	Monitoring      Monitoring `koanf:"monitoring"`
-	Metrics         Metrics    `koanf:"metrics"`
+	SkipLabels        []string          `koanf:"skipLabels"`
+	SkipAnnotations   []string          `koanf:"skipAnnotations"`
+	Routing           Routing           `koanf:"routing"`
+	Mirroring         Mirroring         `koanf:"mirroring"`
+	Monitoring        Monitoring        `koanf:"monitoring"`
+	WorkloadTemplates WorkloadTemplates `koanf:"workloadTemplates"`
+	Metrics           Metrics           `koanf:"metrics"`
 }
 
 type Routing struct {
-	ActiveCheck                            ActiveCheck `koanf:"activeCheck"`
-	RewriteOnNeverImagePullPolicy          bool        `koanf:"rewriteOnNeverImagePullPolicy"`
-	HonorPrioritiesOnAlwaysImagePullPolicy bool        `koanf:"honorPrioritiesOnAlwaysImagePullPolicy"`
+	ActiveCheck                            ActiveCheck   `koanf:"activeCheck"`
+	UpstreamProbe                          UpstreamProbe `koanf:"upstreamProbe"`
+	RewriteOnNeverImagePullPolicy          bool          `koanf:"rewriteOnNeverImagePullPolicy"`
+	HonorPrioritiesOnAlwaysImagePullPolicy bool          `koanf:"honorPrioritiesOnAlwaysImagePullPolicy"`
+}
+
+// UpstreamProbe controls the periodic probe of the upstreams of the
+// ReplicatedImageSets and ClusterReplicatedImageSets.
+type UpstreamProbe struct {
+	Interval time.Duration `koanf:"interval" validate:"gt=0"`
+	Timeout  time.Duration `koanf:"timeout"`
 }
 
 type ActiveCheck struct {
@@ -42,7 +52,71 @@ type StaleMirrorCleanup struct {
 }
 
 type Mirroring struct {
-	Platforms []Platform `koanf:"platforms" validate:"min=1,dive"`
+	Platforms   []Platform  `koanf:"platforms" validate:"min=1,dive"`
+	Concurrency Concurrency `koanf:"concurrency"`
+	Jobs        CopyJobs    `koanf:"jobs"`
+	Bandwidth   Bandwidth   `koanf:"bandwidth"`
+	UsageLedger UsageLedger `koanf:"usageLedger"`
+	Cleanup     Cleanup     `koanf:"cleanup"`
+}
+
+// Cleanup controls the cleanup of the mirrors by every mirror resource.
+type Cleanup struct {
+	// DryRun puts the cleanup of every mirror resource in dry run mode.
+	DryRun bool `koanf:"dryRun"`
+}
+
+// Concurrency bounds the number of images copied at the same time, globally and
+// per source and destination registry.
+type Concurrency struct {
+	MaxConcurrent          int `koanf:"maxConcurrent" validate:"min=1"`
+	PerSourceRegistry      int `koanf:"perSourceRegistry" validate:"min=1"`
+	PerDestinationRegistry int `koanf:"perDestinationRegistry" validate:"min=1"`
+}
+
+// CopyJobs configures the Jobs copying images for the mirror resources using
+// the Job copy mode. Image and Namespace default to the ones of the manager.
+type CopyJobs struct {
+	Image              string        `koanf:"image"`
+	Namespace          string        `koanf:"namespace"`
+	ServiceAccountName string        `koanf:"serviceAccountName"`
+	PollInterval       time.Duration `koanf:"pollInterval" validate:"gt=0"`
+}
+
+// Bandwidth bounds the rate at which images are uploaded to the mirrors, in
+// bytes per second, globally and per destination registry. 0 means unlimited.
+type Bandwidth struct {
+	MaxBytesPerSecond      int64             `koanf:"maxBytesPerSecond" validate:"min=0"`
+	PerDestinationRegistry RegistryBandwidth `koanf:"perDestinationRegistry"`
+}
+
+type RegistryBandwidth struct {
+	Default int64            `koanf:"default" validate:"min=0"`
+	Items   map[string]int64 `koanf:"items" validate:"dive,min=0"`
+}
+
+// MaxBytesPerSecond returns the limit of registry, falling back to the default
+// one.
+func (r *RegistryBandwidth) MaxBytesPerSecond(registry string) int64 {
+	if maxBytesPerSecond, ok := r.Items[registry]; ok {
+		return maxBytesPerSecond
+	}
+	return r.Default
+}
+
+// UsageLedger controls the usage markers kept next to the mirrored images in
+// the mirror registries, which prevent the clusters sharing a mirror registry
+// from deleting the images the others still use. It is disabled when ClusterID
+// is empty.
+type UsageLedger struct {
+	ClusterID       string        `koanf:"clusterID"`
+	RefreshInterval time.Duration `koanf:"refreshInterval" validate:"gt=0"`
+	TTL             time.Duration `koanf:"ttl" validate:"gtfield=RefreshInterval"`
+}
+
+// Enabled returns true when a cluster ID is configured.
+func (u *UsageLedger) Enabled() bool {
+	return u.ClusterID != ""
 }
 
 type Platform struct {
@@ -51,6 +125,19 @@ type Platform struct {
 	Variant      string `koanf:"variant"`
 }
 
+// WorkloadTemplates controls whether the pod templates of workloads are
+// considered as pods by the mirror and availability controllers, so that the
+// images of pods that do not exist yet are mirrored and monitored too.
+type WorkloadTemplates struct {
+	Enabled bool     `koanf:"enabled"`
+	Kinds   []string `koanf:"kinds" validate:"dive,oneof=Deployment StatefulSet DaemonSet ReplicaSet Job CronJob"`
+}
+
+// KindEnabled returns true when the pod templates of kind must be considered.
+func (w *WorkloadTemplates) KindEnabled(kind string) bool {
+	return w.Enabled && slices.Contains(w.Kinds, kind)
+}
+
 type Monitoring struct {
 	Registries Registries `koanf:"registries"`
 }
@@ -90,6 +177,10 @@ var defaultConfig = Config{
 				Timeout:       5 * time.Second,
 			},
 		},
+		UpstreamProbe: UpstreamProbe{
+			Interval: 5 * time.Minute,
+			Timeout:  5 * time.Second,
+		},
 		RewriteOnNeverImagePullPolicy:          false,
 		HonorPrioritiesOnAlwaysImagePullPolicy: false,
 	},
@@ -97,6 +188,18 @@ var defaultConfig = Config{
 		Platforms: []Platform{
 			{Architecture: "amd64"},
 		},
+		Concurrency: Concurrency{
+			MaxConcurrent:          10,
+			PerSourceRegistry:      4,
+			PerDestinationRegistry: 8,
+		},
+		Jobs: CopyJobs{
+			PollInterval: 5 * time.Second,
+		},
+		UsageLedger: UsageLedger{
+			RefreshInterval: time.Hour,
+			TTL:             24 * time.Hour,
+		},
 	},
 	Monitoring: Monitoring{
 		Registries: Registries{
@@ -113,6 +216,10 @@ var defaultConfig = Config{
 			},
 		},
 	},
+	WorkloadTemplates: WorkloadTemplates{
+		Enabled: false,
+		Kinds:   []string{"Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "Job", "CronJob"},
+	},
 	Metrics: Metrics{
 		ImageLastMonitorAgeMinutes: HistogramConfig{
 			BucketFactor:    1.1,
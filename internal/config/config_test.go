@@ -3,6 +3,7 @@ package config
 import (
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestConfig_Validate(t *testing.T) {
@@ -50,6 +51,40 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			wantError: "Architecture",
 		},
+		{
+			name: "zero per source registry concurrency is rejected",
+			mutate: func(c *Config) {
+				c.Mirroring.Concurrency.PerSourceRegistry = 0
+			},
+			wantError: "PerSourceRegistry",
+		},
+		{
+			name: "zero upstream probe interval is rejected",
+			mutate: func(c *Config) {
+				c.Routing.UpstreamProbe.Interval = 0
+			},
+			wantError: "Interval",
+		},
+		{
+			name: "usage ledger ttl shorter than its refresh interval is rejected",
+			mutate: func(c *Config) {
+				c.Mirroring.UsageLedger = UsageLedger{ClusterID: "a", RefreshInterval: time.Hour, TTL: 30 * time.Minute}
+			},
+			wantError: "TTL",
+		},
+		{
+			name: "workload template kinds subset",
+			mutate: func(c *Config) {
+				c.WorkloadTemplates = WorkloadTemplates{Enabled: true, Kinds: []string{"CronJob", "Deployment"}}
+			},
+		},
+		{
+			name: "unknown workload template kind is rejected",
+			mutate: func(c *Config) {
+				c.WorkloadTemplates.Kinds = []string{"Deployment", "Pod"}
+			},
+			wantError: "Kinds",
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// CleanupReportHandler serves the deletions planned by the cleanup of the
+// ImageSetMirrors and ClusterImageSetMirrors in dry run mode.
+type CleanupReportHandler struct {
+	Client client.Client
+}
+
+type plannedDeletion struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Image     string `json:"image"`
+	Reason    string `json:"reason"`
+	DeleteAt  string `json:"deleteAt"`
+	Due       bool   `json:"due"`
+}
+
+func (h *CleanupReportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log := logf.FromContext(r.Context())
+	writeJSON := func(status int, body any) {
+		data, err := json.Marshal(body)
+		if err != nil {
+			log.Error(err, "failed to marshal cleanup report response")
+			w.WriteHeader(http.StatusInternalServerError)
+			data = internalErrorBody
+		} else {
+			w.WriteHeader(status)
+		}
+		if _, err := w.Write(data); err != nil {
+			log.Error(err, "failed to write cleanup report response")
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	cismList := &kuikv1alpha1.ClusterImageSetMirrorList{}
+	if err := h.Client.List(r.Context(), cismList); err != nil {
+		writeJSON(http.StatusInternalServerError, errorResponse{
+			Error: "failed to list ClusterImageSetMirror resources: " + err.Error(),
+		})
+		return
+	}
+	ismList := &kuikv1alpha1.ImageSetMirrorList{}
+	if err := h.Client.List(r.Context(), ismList); err != nil {
+		writeJSON(http.StatusInternalServerError, errorResponse{
+			Error: "failed to list ImageSetMirror resources: " + err.Error(),
+		})
+		return
+	}
+
+	items := []plannedDeletion{}
+	total := 0
+	now := time.Now()
+	add := func(kind, namespace, name string, report *kuikv1alpha1.CleanupReport) {
+		if report == nil {
+			return
+		}
+		for _, deletion := range report.Deletions {
+			items = append(items, plannedDeletion{
+				Kind:      kind,
+				Namespace: namespace,
+				Name:      name,
+				Image:     deletion.Image,
+				Reason:    string(deletion.Reason),
+				DeleteAt:  deletion.DeleteAt.UTC().Format(time.RFC3339),
+				Due:       !deletion.DeleteAt.After(now),
+			})
+		}
+		total += report.DeletionCount
+	}
+	for _, cism := range cismList.Items {
+		add("ClusterImageSetMirror", "", cism.Name, cism.Status.CleanupReport)
+	}
+	for _, ism := range ismList.Items {
+		add("ImageSetMirror", ism.Namespace, ism.Name, ism.Status.CleanupReport)
+	}
+
+	writeJSON(http.StatusOK, map[string]any{
+		"items": items,
+		"total": total,
+	})
+}
@@ -0,0 +1,293 @@
+package kuik
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"path"
+	"slices"
+
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	"github.com/enix/kube-image-keeper/internal"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// crTypeOrder represents the default ordering of CR types when priorities are equal.
+type crTypeOrder int
+
+const (
+	crTypeOrderOriginal crTypeOrder = iota
+	crTypeOrderCISM
+	crTypeOrderISM
+	crTypeOrderCRIS
+	crTypeOrderRIS
+)
+
+// prioritizedAlternative holds an alternative image reference along with
+// the metadata needed to sort it according to the two-level priority system.
+type prioritizedAlternative struct {
+	reference        string
+	credentialSecret *kuikv1alpha1.CredentialSecret
+	secretOwner      client.Object
+	crPriority       int         // from spec.priority (signed, default 0)
+	intraPriority    uint        // from mirror/upstream priority (unsigned, default 0)
+	typeOrder        crTypeOrder // default type ordering
+	declarationOrder int         // YAML declaration index within CR
+}
+
+// compareAlternatives defines the sort order for prioritized alternatives.
+// Sort key: (crPriority asc, typeOrder asc, intraPriority asc, declOrder asc).
+func compareAlternatives(a, b prioritizedAlternative) int {
+	return cmp.Or(
+		cmp.Compare(a.crPriority, b.crPriority),
+		cmp.Compare(a.typeOrder, b.typeOrder),
+		cmp.Compare(a.intraPriority, b.intraPriority),
+		cmp.Compare(a.declarationOrder, b.declarationOrder),
+	)
+}
+
+// Alternative is a reference an image can be pulled from, either the image
+// itself or one of its mirrors or replicated upstreams.
+type Alternative struct {
+	Reference        string
+	CredentialSecret *kuikv1alpha1.CredentialSecret
+	SecretOwner      client.Object
+}
+
+// MatchingImageSets returns the ClusterImageSetMirrors and ImageSetMirrors, and
+// the ClusterReplicatedImageSets and ReplicatedImageSets, whose filter matches
+// pod, or all of them if pod is nil. The cluster-scoped resources come first,
+// converted to their namespaced counterpart. The namespaced ones are the ones of
+// namespace, none if it is empty, and get their namespace set on their credential
+// secrets. Resources with an invalid filter are skipped.
+func MatchingImageSets(ctx context.Context, c client.Reader, namespace string, pod *corev1.Pod) ([]kuikv1alpha1.ImageSetMirror, []kuikv1alpha1.ReplicatedImageSet, error) {
+	log := logf.FromContext(ctx)
+
+	var cismList kuikv1alpha1.ClusterImageSetMirrorList
+	if err := c.List(ctx, &cismList); err != nil {
+		return nil, nil, err
+	}
+	var ismList kuikv1alpha1.ImageSetMirrorList
+	var crisList kuikv1alpha1.ClusterReplicatedImageSetList
+	if err := c.List(ctx, &crisList); err != nil {
+		return nil, nil, err
+	}
+	var risList kuikv1alpha1.ReplicatedImageSetList
+	if namespace != "" {
+		if err := c.List(ctx, &ismList, &client.ListOptions{Namespace: namespace}); err != nil {
+			return nil, nil, err
+		}
+		if err := c.List(ctx, &risList, &client.ListOptions{Namespace: namespace}); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	matches := func(podMatcher func() (func(*corev1.Pod) bool, error), kind string, obj client.Object) bool {
+		match, err := podMatcher()
+		if err != nil {
+			log.Error(err, "skipping "+kind+" with invalid filter", "namespace", obj.GetNamespace(), "name", obj.GetName())
+			return false
+		}
+		return pod == nil || match(pod)
+	}
+
+	imageSetMirrors := make([]kuikv1alpha1.ImageSetMirror, 0, len(cismList.Items)+len(ismList.Items))
+	for _, cism := range cismList.Items {
+		if !matches(cism.PodMatcher, "ClusterImageSetMirror", &cism) {
+			continue
+		}
+		imageSetMirrors = append(imageSetMirrors, kuikv1alpha1.ImageSetMirror{
+			ObjectMeta: cism.ObjectMeta,
+			Spec: kuikv1alpha1.ImageSetMirrorSpec{
+				ImageSetMirrorBase: cism.Spec.ImageSetMirrorBase,
+				Filter:             cism.Spec.Filter.ToFilter(),
+			},
+			Status: kuikv1alpha1.ImageSetMirrorStatus(cism.Status),
+		})
+	}
+	for _, ism := range ismList.Items {
+		if !matches(ism.PodMatcher, "ImageSetMirror", &ism) {
+			continue
+		}
+		for i := range ism.Spec.Mirrors {
+			mirror := &ism.Spec.Mirrors[i]
+			if mirror.CredentialSecret != nil {
+				mirror.CredentialSecret.Namespace = ism.Namespace
+			}
+		}
+		imageSetMirrors = append(imageSetMirrors, ism)
+	}
+
+	replicatedImageSets := make([]kuikv1alpha1.ReplicatedImageSet, 0, len(crisList.Items)+len(risList.Items))
+	for _, cris := range crisList.Items {
+		if !matches(cris.PodMatcher, "ClusterReplicatedImageSet", &cris) {
+			continue
+		}
+		replicatedImageSets = append(replicatedImageSets, kuikv1alpha1.ReplicatedImageSet{
+			ObjectMeta: cris.ObjectMeta,
+			Spec: kuikv1alpha1.ReplicatedImageSetSpec{
+				ReplicatedImageSetBase: cris.Spec.ReplicatedImageSetBase,
+				Filter:                 cris.Spec.Filter.ToFilter(),
+			},
+		})
+	}
+	for _, ris := range risList.Items {
+		if !matches(ris.PodMatcher, "ReplicatedImageSet", &ris) {
+			continue
+		}
+		for i := range ris.Spec.Upstreams {
+			upstream := &ris.Spec.Upstreams[i]
+			if upstream.CredentialSecret != nil {
+				upstream.CredentialSecret.Namespace = ris.Namespace
+			}
+		}
+		replicatedImageSets = append(replicatedImageSets, ris)
+	}
+
+	return imageSetMirrors, replicatedImageSets, nil
+}
+
+// Alternatives returns the references image, a normalized image reference, can
+// be pulled from, best first, according to the priorities of imageSetMirrors
+// and replicatedImageSets. The original image comes first regardless of the
+// priorities when pinOriginal is true, and is left out when a matching upstream
+// discards it.
+func Alternatives(ctx context.Context, imageSetMirrors []kuikv1alpha1.ImageSetMirror, replicatedImageSets []kuikv1alpha1.ReplicatedImageSet, image string, pinOriginal bool) ([]Alternative, error) {
+	log := logf.FromContext(ctx)
+	alternatives := make([]prioritizedAlternative, 0, 1)
+
+	discardOriginal := false
+
+	// Collect from ReplicatedImageSets
+	for risIdx := range replicatedImageSets {
+		ris := &replicatedImageSets[risIdx]
+		// A malformed image filter on one upstream must not break admission nor
+		// disable the rest of the CR: skip only the offending upstream (both as a
+		// match candidate and as a routing alternative below).
+		index := -1
+		validUpstream := make([]bool, len(ris.Spec.Upstreams))
+		for i := range ris.Spec.Upstreams {
+			upstream := &ris.Spec.Upstreams[i]
+			imageFilter, err := upstream.ImageFilter.BuildWithRegistry(upstream.Registry)
+			if err != nil {
+				log.Error(err, "skipping ReplicatedImageSet upstream with invalid image filter", "namespace", ris.Namespace, "name", ris.Name, "registry", upstream.Registry)
+				continue
+			}
+			if err := upstream.Rewrite.Validate(); err != nil {
+				log.Error(err, "skipping ReplicatedImageSet upstream with invalid rewrite rule", "namespace", ris.Namespace, "name", ris.Name, "registry", upstream.Registry)
+				continue
+			}
+			validUpstream[i] = true
+			if index == -1 && imageFilter.Match(image) && upstream.MatchesRewrite(image) {
+				index = i
+			}
+		}
+		if index == -1 {
+			continue
+		}
+
+		match := &ris.Spec.Upstreams[index]
+		if match.DiscardAlternative {
+			// A matching upstream with DiscardAlternative enabled prevents the original registry from
+			// being used as a fallback. We set discardOriginal to true here to suppress it later.
+			discardOriginal = true
+		}
+
+		typeOrder := crTypeOrderRIS
+		if ris.Namespace == "" {
+			typeOrder = crTypeOrderCRIS
+		}
+
+		for declarationIdx, upstream := range ris.Spec.Upstreams {
+			if !validUpstream[declarationIdx] || upstream.DiscardAlternative {
+				continue
+			}
+			reference := image
+			if declarationIdx != index {
+				var err error
+				if reference, err = upstream.Translate(match, image); err != nil {
+					log.Error(err, "skipping ReplicatedImageSet upstream that cannot be rewritten", "namespace", ris.Namespace, "name", ris.Name, "registry", upstream.Registry)
+					continue
+				}
+			}
+			alternatives = append(alternatives, prioritizedAlternative{
+				reference:        reference,
+				credentialSecret: upstream.CredentialSecret,
+				secretOwner:      ris,
+				crPriority:       ris.Spec.Priority,
+				intraPriority:    upstream.Priority,
+				typeOrder:        typeOrder,
+				declarationOrder: declarationIdx,
+			})
+		}
+	}
+
+	if !discardOriginal {
+		original := prioritizedAlternative{
+			reference: image,
+			typeOrder: crTypeOrderOriginal,
+		}
+		if pinOriginal {
+			original.crPriority = math.MinInt
+		}
+		alternatives = append(alternatives, original)
+	}
+
+	// Collect from ImageSetMirrors
+	for ismIdx := range imageSetMirrors {
+		ism := &imageSetMirrors[ismIdx]
+		imageFilter, err := ism.ImageFilter()
+		if err != nil {
+			log.Error(err, "skipping ImageSetMirror with invalid image filter", "namespace", ism.Namespace, "name", ism.Name)
+			continue
+		}
+
+		for _, alternative := range alternatives {
+			imgRegistry, imgPath, err := internal.RegistryAndPathFromReference(alternative.reference)
+			if err != nil {
+				return nil, err
+			}
+
+			if !imageFilter.Match(path.Join(imgRegistry, imgPath)) {
+				// FIXME: if it doesn't match the filter, also check if it matches one of the mirrored images
+				continue
+			}
+
+			typeOrder := crTypeOrderISM
+			if ism.Namespace == "" {
+				typeOrder = crTypeOrderCISM
+			}
+
+			for declarationIdx, mirror := range ism.Spec.Mirrors {
+				alternatives = append(alternatives, prioritizedAlternative{
+					reference:        path.Join(mirror.Registry, mirror.Path, imgPath),
+					credentialSecret: mirror.CredentialSecret,
+					secretOwner:      ism,
+					crPriority:       ism.Spec.Priority,
+					intraPriority:    mirror.Priority,
+					typeOrder:        typeOrder,
+					declarationOrder: declarationIdx,
+				})
+			}
+		}
+	}
+
+	// Stable sort by priority
+	slices.SortStableFunc(alternatives, compareAlternatives)
+
+	result := make([]Alternative, 0, len(alternatives))
+	for _, alternative := range alternatives {
+		if slices.ContainsFunc(result, func(a Alternative) bool { return a.Reference == alternative.reference }) {
+			continue
+		}
+		result = append(result, Alternative{
+			Reference:        alternative.reference,
+			CredentialSecret: alternative.credentialSecret,
+			SecretOwner:      alternative.secretOwner,
+		})
+	}
+
+	return result, nil
+}
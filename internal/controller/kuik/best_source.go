@@ -0,0 +1,124 @@
+package kuik
+
+import (
+	"context"
+	"net/http"
+	"slices"
+
+	"github.com/distribution/reference"
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	"github.com/enix/kube-image-keeper/internal/registry"
+	corev1 "k8s.io/api/core/v1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// knownDigests returns the digest known for the manifest of an image, and every
+// digest its content is known under, from the digest it runs with, if not
+// empty, or else from the source digest its mirrors were last synced from. The
+// digests of the mirrors synced from this source digest are known for the same
+// content, filtered to the configured platforms.
+func knownDigests(runningDigest string, mirrors []kuikv1alpha1.MirrorStatus) (sourceDigest string, digests []string) {
+	sourceDigest = runningDigest
+	if sourceDigest == "" {
+		var lastSyncedAt *kuikv1alpha1.MirrorStatus
+		for i := range mirrors {
+			mirror := &mirrors[i]
+			if mirror.SourceDigest == "" || mirror.LastSyncedAt == nil {
+				continue
+			}
+			if lastSyncedAt == nil || mirror.LastSyncedAt.After(lastSyncedAt.LastSyncedAt.Time) {
+				lastSyncedAt = mirror
+			}
+		}
+		if lastSyncedAt == nil {
+			return "", nil
+		}
+		sourceDigest = lastSyncedAt.SourceDigest
+	}
+
+	digests = []string{sourceDigest}
+	for _, mirror := range mirrors {
+		if mirror.SourceDigest == sourceDigest && mirror.DestinationDigest != "" && !slices.Contains(digests, mirror.DestinationDigest) {
+			digests = append(digests, mirror.DestinationDigest)
+		}
+	}
+	return sourceDigest, digests
+}
+
+// pinsOriginal reports whether the webhook pins image first in the alternatives
+// of the containers of pod, regardless of the priorities of the mirrors.
+func (r *ImageSetMirrorBaseReconciler) pinsOriginal(pod *corev1.Pod, image string) bool {
+	if pod == nil || (r.Config != nil && r.Config.Routing.HonorPrioritiesOnAlwaysImagePullPolicy) {
+		return false
+	}
+	return slices.ContainsFunc(slices.Concat(pod.Spec.InitContainers, pod.Spec.Containers), func(container corev1.Container) bool {
+		named, err := reference.ParseNormalizedNamed(container.Image)
+		return err == nil && named.String() == image && container.ImagePullPolicy == corev1.PullAlways
+	})
+}
+
+// alternativeSource returns the alternative of from to copy it to the mirror to
+// from, with the secrets to pull it, when it comes before from in the
+// alternatives the webhook routes pod to and from is not available. The
+// alternative must hold one of the digests known for from: it is pinned to it.
+// It returns an empty source when from is to be copied from itself, including
+// when no alternative is available.
+func (r *ImageSetMirrorBaseReconciler) alternativeSource(ctx context.Context, namespace string, pod *corev1.Pod, from, to string, digests []string, srcSecrets []corev1.Secret) (source string, secrets []corev1.Secret, err error) {
+	if len(digests) == 0 {
+		return "", nil, nil
+	}
+	log := logf.FromContext(ctx)
+
+	if pod != nil {
+		namespace = pod.Namespace
+	}
+	imageSetMirrors, replicatedImageSets, err := MatchingImageSets(ctx, r.Client, namespace, pod)
+	if err != nil {
+		return "", nil, err
+	}
+	alternatives, err := Alternatives(ctx, imageSetMirrors, replicatedImageSets, from, r.pinsOriginal(pod, from))
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, alternative := range alternatives {
+		if alternative.Reference == to {
+			continue
+		}
+
+		if alternative.Reference == from {
+			if _, _, err := registry.NewClient(nil, nil).WithPullSecrets(srcSecrets).ReadDescriptor(ctx, http.MethodHead, from); err != nil {
+				log.V(1).Info("original image is not available, looking for another source", "error", err)
+				continue
+			}
+			return "", nil, nil
+		}
+
+		secrets = nil
+		if alternative.CredentialSecret != nil {
+			secret := corev1.Secret{}
+			if err := r.getPullSecret(ctx, alternative.CredentialSecret.Namespace, alternative.CredentialSecret.Name, &secret); err != nil {
+				log.V(1).Info("could not read the credentials of an alternative source", "source", alternative.Reference, "error", err)
+				continue
+			}
+			secrets = []corev1.Secret{secret}
+		}
+
+		desc, _, err := registry.NewClient(nil, nil).WithPullSecrets(secrets).ReadDescriptor(ctx, http.MethodHead, alternative.Reference)
+		if err != nil {
+			log.V(1).Info("alternative source is not available", "source", alternative.Reference, "error", err)
+			continue
+		}
+		if !slices.Contains(digests, desc.Digest.String()) {
+			log.V(1).Info("alternative source does not hold the digest known for the original image", "source", alternative.Reference, "digest", desc.Digest.String())
+			continue
+		}
+
+		if source, err = withDigest(alternative.Reference, desc.Digest.String()); err != nil {
+			return "", nil, err
+		}
+		return source, secrets, nil
+	}
+
+	return "", nil, nil
+}
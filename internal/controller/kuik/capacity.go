@@ -0,0 +1,218 @@
+package kuik
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// mirroredImage is a copied mirror of a matching or prefetched image, as
+// accounted for in the capacity of its mirror resource.
+type mirroredImage struct {
+	image       string
+	size        int64
+	unusedSince *metav1.Time
+}
+
+// capacityEvictions returns the mirrors to delete, least recently used first,
+// so that the copied mirrors of status fit in the capacity of spec and in the
+// capacity of each of its mirrors. Only the mirrors of unused images are
+// evicted: the returned error describes the capacities that are still exceeded
+// once all of them are.
+func capacityEvictions(spec *kuikv1alpha1.ImageSetMirrorBase, status *kuikv1alpha1.ImageSetMirrorStatus) ([]string, error) {
+	images := []mirroredImage{}
+	add := func(mirrors []kuikv1alpha1.MirrorStatus, unusedSince *metav1.Time) {
+		for _, mirror := range mirrors {
+			if mirror.MirroredAt != nil {
+				images = append(images, mirroredImage{image: mirror.Image, size: mirror.Size, unusedSince: unusedSince})
+			}
+		}
+	}
+	for _, matchingImage := range status.MatchingImages {
+		add(matchingImage.Mirrors, matchingImage.UnusedSince)
+	}
+	for _, prefetchedImage := range status.PrefetchedImages {
+		add(prefetchedImage.Mirrors, prefetchedImage.UnusedSince)
+	}
+
+	// The images unused for the longest time are the least recently used ones
+	slices.SortStableFunc(images, func(a, b mirroredImage) int {
+		if a.unusedSince == nil || b.unusedSince == nil {
+			return boolCompare(a.unusedSince == nil, b.unusedSince == nil)
+		}
+		return cmp.Or(a.unusedSince.Compare(b.unusedSince.Time), strings.Compare(a.image, b.image))
+	})
+
+	evicted := map[string]struct{}{}
+	errs := []error{}
+	evict := func(field string, capacity *kuikv1alpha1.Capacity, inScope func(image string) bool) {
+		if !capacity.IsLimited() {
+			return
+		}
+		count, size := int32(0), int64(0)
+		for _, image := range images {
+			if _, ok := evicted[image.image]; !ok && inScope(image.image) {
+				count++
+				size += image.size
+			}
+		}
+		exceeded := func() bool {
+			return (capacity.MaxImages > 0 && count > capacity.MaxImages) ||
+				(capacity.MaxSize != nil && !capacity.MaxSize.IsZero() && size > capacity.MaxSize.Value())
+		}
+		for _, image := range images {
+			if !exceeded() || image.unusedSince == nil {
+				break
+			}
+			if _, ok := evicted[image.image]; ok || !inScope(image.image) {
+				continue
+			}
+			evicted[image.image] = struct{}{}
+			count--
+			size -= image.size
+		}
+		if exceeded() {
+			errs = append(errs, fmt.Errorf("%s is exceeded by images in use: %d image(s) for %s", field, count, resource.NewQuantity(size, resource.BinarySI)))
+		}
+	}
+
+	for i := range spec.Mirrors {
+		evict(fmt.Sprintf("mirrors[%d].capacity", i), spec.Mirrors[i].Capacity, func(image string) bool {
+			return mirrorIndexForImage(spec.Mirrors, image) == i
+		})
+	}
+	evict("capacity", &spec.Capacity, func(string) bool { return true })
+
+	evictions := []string{}
+	for _, image := range images {
+		if _, ok := evicted[image.image]; ok {
+			evictions = append(evictions, image.image)
+		}
+	}
+	return evictions, errors.Join(errs...)
+}
+
+// boolCompare orders false before true.
+func boolCompare(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// mirrorIndexForImage returns the index of the mirror with the longest prefix
+// of image, the one image is mirrored to, or -1 if there is none. Prefixes only
+// match whole path components, a.example.com/team is not a prefix of
+// a.example.com/team-b/app.
+func mirrorIndexForImage(mirrors kuikv1alpha1.Mirrors, image string) int {
+	index, longestPrefixLen := -1, 0
+	for i, mirror := range mirrors {
+		prefix := path.Join(mirror.Registry, mirror.Path)
+		if strings.HasPrefix(image, prefix+"/") && len(prefix) > longestPrefixLen {
+			index, longestPrefixLen = i, len(prefix)
+		}
+	}
+	return index
+}
+
+// enforceCapacity deletes the least recently used unused mirrors of obj that
+// do not fit in its capacities, and removes them from its status. It returns
+// whether some of them could not be deleted, and the capacities that cannot be
+// met without deleting images in use.
+func (r *ImageSetMirrorBaseReconciler) enforceCapacity(ctx context.Context, obj MirrorObject) (someDeletionFailed bool, err error) {
+	log := logf.FromContext(ctx)
+	spec, status := obj.MirrorSpec(), obj.MirrorStatus()
+
+	evictions, capacityErr := capacityEvictions(spec, status)
+	r.reportCapacityExceeded(ctx, obj, capacityErr)
+	if len(evictions) == 0 {
+		return false, capacityErr
+	}
+
+	evictMirrors := func(mirrors []kuikv1alpha1.MirrorStatus) []kuikv1alpha1.MirrorStatus {
+		mirrorsAfterEviction := []kuikv1alpha1.MirrorStatus{}
+		for _, mirror := range mirrors {
+			if !slices.Contains(evictions, mirror.Image) {
+				mirrorsAfterEviction = append(mirrorsAfterEviction, mirror)
+				continue
+			}
+			cleanupLog := log.WithValues("image", mirror.Image)
+			cleanupLog.Info("image is the least recently used one and does not fit in the capacity, deleting it")
+			if !r.cleanupMirror(logf.IntoContext(ctx, cleanupLog), obj, mirror.Image) {
+				mirrorsAfterEviction = append(mirrorsAfterEviction, mirror)
+				someDeletionFailed = true
+			}
+		}
+		return mirrorsAfterEviction
+	}
+
+	matchingImages := []kuikv1alpha1.MatchingImage{}
+	for _, matchingImage := range status.MatchingImages {
+		mirrorsCount := len(matchingImage.Mirrors)
+		if matchingImage.Mirrors = evictMirrors(matchingImage.Mirrors); len(matchingImage.Mirrors) > 0 || mirrorsCount == 0 {
+			matchingImages = append(matchingImages, matchingImage)
+		}
+	}
+	status.MatchingImages = matchingImages
+
+	prefetchedImages := []kuikv1alpha1.PrefetchedImage{}
+	for _, prefetchedImage := range status.PrefetchedImages {
+		mirrorsCount := len(prefetchedImage.Mirrors)
+		if prefetchedImage.Mirrors = evictMirrors(prefetchedImage.Mirrors); len(prefetchedImage.Mirrors) > 0 || mirrorsCount == 0 {
+			prefetchedImages = append(prefetchedImages, prefetchedImage)
+		}
+	}
+	status.PrefetchedImages = prefetchedImages
+
+	return someDeletionFailed, capacityErr
+}
+
+// planCapacityEvictions adds to plan, without deleting them, the evictions
+// enforceCapacity would do once the deletions already planned are done. It
+// returns the capacities that cannot be met without deleting images in use.
+func (r *ImageSetMirrorBaseReconciler) planCapacityEvictions(ctx context.Context, obj MirrorObject, plan *cleanupPlan) error {
+	status := obj.MirrorStatus().DeepCopy()
+	now := time.Now()
+	withoutPlannedDeletions := func(mirrors []kuikv1alpha1.MirrorStatus) []kuikv1alpha1.MirrorStatus {
+		return slices.DeleteFunc(mirrors, func(mirror kuikv1alpha1.MirrorStatus) bool {
+			return plan.plannedBefore(mirror.Image, now)
+		})
+	}
+	for i := range status.MatchingImages {
+		status.MatchingImages[i].Mirrors = withoutPlannedDeletions(status.MatchingImages[i].Mirrors)
+	}
+	for i := range status.PrefetchedImages {
+		status.PrefetchedImages[i].Mirrors = withoutPlannedDeletions(status.PrefetchedImages[i].Mirrors)
+	}
+
+	evictions, capacityErr := capacityEvictions(obj.MirrorSpec(), status)
+	r.reportCapacityExceeded(ctx, obj, capacityErr)
+	for _, image := range evictions {
+		plan.add(image, kuikv1alpha1.CleanupReasonCapacity, now)
+	}
+	return capacityErr
+}
+
+// reportCapacityExceeded reports with a CapacityExceeded event the capacities
+// of obj that cannot be met without deleting images in use, if any.
+func (r *ImageSetMirrorBaseReconciler) reportCapacityExceeded(ctx context.Context, obj MirrorObject, capacityErr error) {
+	if capacityErr != nil {
+		logf.FromContext(ctx).Info("capacity cannot be met without deleting images in use", "reason", capacityErr.Error())
+		r.Recorder.Eventf(obj, nil, corev1.EventTypeWarning, "CapacityExceeded", "Evict", "%v", capacityErr)
+	}
+}
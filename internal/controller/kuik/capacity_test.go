@@ -0,0 +1,123 @@
+package kuik
+
+import (
+	"context"
+	"time"
+
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Mirror capacity", func() {
+	mirroredAt := metav1.Now()
+	unusedSince := func(ago time.Duration) *metav1.Time {
+		return &metav1.Time{Time: mirroredAt.Add(-ago)}
+	}
+	matchingImage := func(name string, size int64, unusedSince *metav1.Time, mirrors ...string) kuikv1alpha1.MatchingImage {
+		matchingImage := kuikv1alpha1.MatchingImage{Image: "docker.io/library/" + name, UnusedSince: unusedSince}
+		for _, mirror := range mirrors {
+			matchingImage.Mirrors = append(matchingImage.Mirrors, kuikv1alpha1.MirrorStatus{Image: mirror + "/library/" + name, MirroredAt: &mirroredAt, Size: size})
+		}
+		return matchingImage
+	}
+	quantity := func(s string) *resource.Quantity {
+		q := resource.MustParse(s)
+		return &q
+	}
+
+	status := &kuikv1alpha1.ImageSetMirrorStatus{
+		MatchingImages: []kuikv1alpha1.MatchingImage{
+			matchingImage("nginx:1.27", 100, nil, "a.example.com", "b.example.com"),
+			matchingImage("nginx:1.26", 100, unusedSince(time.Hour), "a.example.com", "b.example.com"),
+			matchingImage("nginx:1.25", 100, unusedSince(2*time.Hour), "a.example.com"),
+			matchingImage("redis:7", 300, unusedSince(time.Minute), "b.example.com"),
+		},
+		PrefetchedImages: []kuikv1alpha1.PrefetchedImage{{
+			Image:   "docker.io/library/nginx:1.28",
+			Mirrors: []kuikv1alpha1.MirrorStatus{{Image: "a.example.com/library/nginx:1.28", MirroredAt: &mirroredAt, Size: 100}},
+		}},
+	}
+	mirrors := kuikv1alpha1.Mirrors{{Registry: "a.example.com"}, {Registry: "b.example.com"}}
+
+	DescribeTable("evicts the least recently used unused images first",
+		func(capacity kuikv1alpha1.Capacity, mirrorCapacities map[int]*kuikv1alpha1.Capacity, expectedEvictions []string, expectedErr string) {
+			spec := &kuikv1alpha1.ImageSetMirrorBase{Capacity: capacity, Mirrors: mirrors.DeepCopy()}
+			for i, mirrorCapacity := range mirrorCapacities {
+				spec.Mirrors[i].Capacity = mirrorCapacity
+			}
+
+			evictions, err := capacityEvictions(spec, status)
+			Expect(evictions).To(Equal(expectedEvictions))
+			if expectedErr == "" {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+			}
+		},
+		Entry("without limits", kuikv1alpha1.Capacity{}, nil, []string{}, ""),
+		Entry("within the limits", kuikv1alpha1.Capacity{MaxImages: 7, MaxSize: quantity("1k")}, nil, []string{}, ""),
+		Entry("over the maximum image count", kuikv1alpha1.Capacity{MaxImages: 5}, nil, []string{
+			"a.example.com/library/nginx:1.25",
+			"a.example.com/library/nginx:1.26",
+		}, ""),
+		Entry("over the maximum size", kuikv1alpha1.Capacity{MaxSize: quantity("650")}, nil, []string{
+			"a.example.com/library/nginx:1.25",
+			"a.example.com/library/nginx:1.26",
+			"b.example.com/library/nginx:1.26",
+		}, ""),
+		Entry("over a mirror capacity", kuikv1alpha1.Capacity{}, map[int]*kuikv1alpha1.Capacity{1: {MaxImages: 2}}, []string{
+			"b.example.com/library/nginx:1.26",
+		}, ""),
+		Entry("over a capacity that images in use exceed", kuikv1alpha1.Capacity{}, map[int]*kuikv1alpha1.Capacity{0: {MaxImages: 1}}, []string{
+			"a.example.com/library/nginx:1.25",
+			"a.example.com/library/nginx:1.26",
+		}, "mirrors[0].capacity is exceeded by images in use: 2 image(s)"),
+	)
+
+	DescribeTable("finds the mirror an image is mirrored to",
+		func(image string, expected int) {
+			mirrors := kuikv1alpha1.Mirrors{{Registry: "a.example.com", Path: "team"}, {Registry: "a.example.com", Path: "team/app"}, {Registry: "b.example.com"}}
+			Expect(mirrorIndexForImage(mirrors, image)).To(Equal(expected))
+		},
+		Entry("with the longest prefix", "a.example.com/team/app/nginx:1.27", 1),
+		Entry("with a shorter prefix", "a.example.com/team/nginx:1.27", 0),
+		Entry("on a whole registry", "b.example.com/library/nginx:1.27", 2),
+		Entry("not on a path sharing a prefix", "a.example.com/team-b/nginx:1.27", -1),
+		Entry("not on a registry sharing a prefix", "b.example.com:5000/library/nginx:1.27", -1),
+	)
+
+	It("deletes the evicted mirrors and reports the capacity that cannot be met", func() {
+		ism := &kuikv1alpha1.ImageSetMirror{
+			ObjectMeta: metav1.ObjectMeta{Name: "ism", Namespace: "default"},
+			Spec: kuikv1alpha1.ImageSetMirrorSpec{ImageSetMirrorBase: kuikv1alpha1.ImageSetMirrorBase{
+				Capacity: kuikv1alpha1.Capacity{MaxImages: 2},
+				Mirrors:  mirrors.DeepCopy(),
+			}},
+			Status: *status.DeepCopy(),
+		}
+		recorder := events.NewFakeRecorder(10)
+		r := &ImageSetMirrorBaseReconciler{
+			Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).Build(),
+			Scheme:   scheme.Scheme,
+			Recorder: recorder,
+		}
+
+		someDeletionFailed, err := r.enforceCapacity(context.Background(), ism)
+		Expect(someDeletionFailed).To(BeFalse())
+		Expect(err).To(MatchError(ContainSubstring("capacity is exceeded by images in use: 3 image(s)")))
+		Expect(recorder.Events).To(Receive(ContainSubstring("CapacityExceeded")))
+
+		images := []string{}
+		for _, matchingImage := range ism.Status.MatchingImages {
+			images = append(images, matchingImage.Image)
+		}
+		Expect(images).To(Equal([]string{"docker.io/library/nginx:1.27"}))
+		Expect(ism.Status.PrefetchedImages).To(HaveLen(1), "prefetched images not unused yet are kept")
+	})
+})
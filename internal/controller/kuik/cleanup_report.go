@@ -0,0 +1,63 @@
+package kuik
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"time"
+
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// cleanupDryRun reports whether the cleanup of spec is in dry run mode, on its
+// own or for every mirror resource.
+func (r *ImageSetMirrorBaseReconciler) cleanupDryRun(spec *kuikv1alpha1.ImageSetMirrorBase) bool {
+	return spec.Cleanup.DryRun || (r.Config != nil && r.Config.Mirroring.Cleanup.DryRun)
+}
+
+// cleanupPlan collects the deletions the cleanup would do in dry run mode.
+type cleanupPlan struct {
+	deletions map[string]kuikv1alpha1.PlannedDeletion
+}
+
+func newCleanupPlan() *cleanupPlan {
+	return &cleanupPlan{deletions: map[string]kuikv1alpha1.PlannedDeletion{}}
+}
+
+// add plans the deletion of image at deleteAt for reason, unless it is already
+// planned earlier.
+func (p *cleanupPlan) add(image string, reason kuikv1alpha1.CleanupReason, deleteAt time.Time) {
+	if deletion, ok := p.deletions[image]; ok && !deleteAt.Before(deletion.DeleteAt.Time) {
+		return
+	}
+	p.deletions[image] = kuikv1alpha1.PlannedDeletion{Image: image, Reason: reason, DeleteAt: metav1.NewTime(deleteAt)}
+}
+
+// plannedBefore reports whether the deletion of image is planned before t.
+func (p *cleanupPlan) plannedBefore(image string, t time.Time) bool {
+	deletion, ok := p.deletions[image]
+	return ok && !deletion.DeleteAt.After(t)
+}
+
+// report returns the report of the planned deletions, soonest first, or nil if
+// p is nil.
+func (p *cleanupPlan) report() *kuikv1alpha1.CleanupReport {
+	if p == nil {
+		return nil
+	}
+
+	deletions := make([]kuikv1alpha1.PlannedDeletion, 0, len(p.deletions))
+	for _, deletion := range p.deletions {
+		deletions = append(deletions, deletion)
+	}
+	slices.SortFunc(deletions, func(a, b kuikv1alpha1.PlannedDeletion) int {
+		return cmp.Or(a.DeleteAt.Compare(b.DeleteAt.Time), strings.Compare(a.Image, b.Image))
+	})
+
+	return &kuikv1alpha1.CleanupReport{
+		EvaluatedAt:   metav1.Now(),
+		DeletionCount: len(deletions),
+		Deletions:     deletions[:min(len(deletions), kuikv1alpha1.MaxPlannedDeletions)],
+	}
+}
@@ -0,0 +1,70 @@
+package kuik
+
+import (
+	"context"
+	"time"
+
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Cleanup dry run", func() {
+	ctx := context.Background()
+
+	It("reports the retention and capacity deletions without deleting anything", func() {
+		now := time.Now()
+		mirroredAt := metav1.NewTime(now.Add(-24 * time.Hour))
+		matchingImage := func(tag string, unusedSince *metav1.Time) kuikv1alpha1.MatchingImage {
+			return kuikv1alpha1.MatchingImage{
+				Image:       "docker.io/library/nginx:" + tag,
+				Mirrors:     []kuikv1alpha1.MirrorStatus{{Image: "registry.example.com/mirror/docker.io/library/nginx:" + tag, MirroredAt: &mirroredAt}},
+				UnusedSince: unusedSince,
+			}
+		}
+		ism := &kuikv1alpha1.ImageSetMirror{
+			ObjectMeta: metav1.ObjectMeta{Name: "ism", Namespace: "default", Finalizers: []string{imageSetMirrorFinalizer}},
+			Spec: kuikv1alpha1.ImageSetMirrorSpec{ImageSetMirrorBase: kuikv1alpha1.ImageSetMirrorBase{
+				ImageFilter: kuikv1alpha1.ImageFilterDefinition{Include: []string{`docker\.io/library/nginx:.*`}},
+				Cleanup:     kuikv1alpha1.Cleanup{Retention: metav1.Duration{Duration: time.Hour}, DryRun: true},
+				Capacity:    kuikv1alpha1.Capacity{MaxImages: 1},
+				Mirrors:     kuikv1alpha1.Mirrors{{Registry: "registry.example.com", Path: "mirror"}},
+			}},
+			Status: kuikv1alpha1.ImageSetMirrorStatus{MatchingImages: []kuikv1alpha1.MatchingImage{
+				{
+					Image:       "docker.io/library/nginx:1.24",
+					Mirrors:     []kuikv1alpha1.MirrorStatus{{Image: "registry.example.com/mirror/docker.io/library/nginx:1.24"}},
+					UnusedSince: &metav1.Time{Time: now.Add(-2 * time.Hour)},
+				},
+				matchingImage("1.25", &metav1.Time{Time: now.Add(-2 * time.Hour)}),
+				matchingImage("1.26", &metav1.Time{Time: now.Add(-10 * time.Minute)}),
+				matchingImage("1.27", &metav1.Time{Time: now.Add(-time.Minute)}),
+			}},
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(ism).WithStatusSubresource(ism).Build()
+		r := &ImageSetMirrorBaseReconciler{Client: c, Scheme: scheme.Scheme, Recorder: events.NewFakeRecorder(10)}
+
+		key := client.ObjectKeyFromObject(ism)
+		_, err := r.reconcile(ctx, ctrl.Request{NamespacedName: key}, &kuikv1alpha1.ImageSetMirror{})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(c.Get(ctx, key, ism)).To(Succeed())
+		Expect(ism.Status.MatchingImages).To(HaveLen(4), "no image is deleted in dry run mode")
+		report := ism.Status.CleanupReport
+		Expect(report).NotTo(BeNil())
+		Expect(report.DeletionCount).To(Equal(3), "the image that is not mirrored is not to be deleted")
+		Expect(report.Deletions).To(HaveExactElements(
+			And(HaveField("Image", HaveSuffix("nginx:1.25")), HaveField("Reason", kuikv1alpha1.CleanupReasonRetention)),
+			And(HaveField("Image", HaveSuffix("nginx:1.26")), HaveField("Reason", kuikv1alpha1.CleanupReasonCapacity)),
+			And(HaveField("Image", HaveSuffix("nginx:1.27")), HaveField("Reason", kuikv1alpha1.CleanupReasonRetention)),
+		))
+		Expect(report.Deletions[0].DeleteAt.Time).To(BeTemporally("~", now.Add(-time.Hour), time.Second))
+		Expect(report.Deletions[2].DeleteAt.Time).To(BeTemporally("~", now.Add(59*time.Minute), time.Second))
+	})
+})
@@ -14,6 +14,7 @@ import (
 	"github.com/enix/kube-image-keeper/internal/filter"
 	"github.com/enix/kube-image-keeper/internal/registry"
 	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/events"
@@ -60,55 +61,58 @@ func (r *ClusterImageSetAvailabilityReconciler) SetupWithManager(mgr ctrl.Manage
 		r.Recorder = mgr.GetEventRecorder("kuik-clusterimagesetavailability")
 	}
 
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&kuikv1alpha1.ClusterImageSetAvailability{}).
 		Named("kuik-clusterimagesetavailability").
 		WithEventFilter(predicate.GenerationChangedPredicate{}).
-		WatchesRawSource(source.TypedKind(mgr.GetCache(), &corev1.Pod{},
-			handler.TypedEnqueueRequestsFromMapFunc(func(ctx context.Context, pod *corev1.Pod) []reconcile.Request {
-				log := logf.FromContext(ctx).WithName("pod-mapper").WithValues("pod", klog.KObj(pod))
+		WatchesRawSource(source.TypedKind(mgr.GetCache(), &corev1.Pod{}, handler.TypedEnqueueRequestsFromMapFunc(r.mapPodToRequests)))
 
-				if !r.globalPodFilter.Match(pod) {
-					return nil
-				}
+	return watchWorkloadTemplates(b, r.Config, r.mapPodToRequests).Complete(r)
+}
 
-				var cisaList kuikv1alpha1.ClusterImageSetAvailabilityList
-				if err := r.List(ctx, &cisaList); err != nil {
-					log.Error(err, "failed to list ClusterImageSetAvailability")
-					return nil
-				}
+// mapPodToRequests enqueues the ClusterImageSetAvailabilities matching the pod
+// and at least one of its images.
+func (r *ClusterImageSetAvailabilityReconciler) mapPodToRequests(ctx context.Context, pod *corev1.Pod) []reconcile.Request {
+	log := logf.FromContext(ctx).WithName("pod-mapper").WithValues("pod", klog.KObj(pod))
 
-				imageNames := normalizedImageNamesFromAnnotatedPod(logf.IntoContext(ctx, log), pod)
-
-				var reqs []reconcile.Request
-				for _, cisa := range cisaList.Items {
-					match, err := cisa.PodMatcher()
-					if err != nil {
-						log.Error(err, "skipping ClusterImageSetAvailability with invalid filter", "name", cisa.Name)
-						continue
-					}
-					if !match(pod) {
-						continue
-					}
-					imageFilter, err := cisa.ImageFilter()
-					if err != nil {
-						log.Error(err, "skipping ClusterImageSetAvailability with invalid filter", "name", cisa.Name)
-						continue
-					}
-					for imageName := range imageNames {
-						if imageFilter.Match(imageName) {
-							reqs = append(reqs, reconcile.Request{
-								NamespacedName: client.ObjectKeyFromObject(&cisa),
-							})
-							break
-						}
-					}
-				}
+	if !r.globalPodFilter.Match(pod) {
+		return nil
+	}
+
+	var cisaList kuikv1alpha1.ClusterImageSetAvailabilityList
+	if err := r.List(ctx, &cisaList); err != nil {
+		log.Error(err, "failed to list ClusterImageSetAvailability")
+		return nil
+	}
+
+	imageNames := normalizedImageNamesFromAnnotatedPod(logf.IntoContext(ctx, log), pod)
+
+	var reqs []reconcile.Request
+	for _, cisa := range cisaList.Items {
+		match, err := cisa.PodMatcher()
+		if err != nil {
+			log.Error(err, "skipping ClusterImageSetAvailability with invalid filter", "name", cisa.Name)
+			continue
+		}
+		if !match(pod) {
+			continue
+		}
+		imageFilter, err := cisa.ImageFilter()
+		if err != nil {
+			log.Error(err, "skipping ClusterImageSetAvailability with invalid filter", "name", cisa.Name)
+			continue
+		}
+		for imageName := range imageNames {
+			if imageFilter.Match(imageName) {
+				reqs = append(reqs, reconcile.Request{
+					NamespacedName: client.ObjectKeyFromObject(&cisa),
+				})
+				break
+			}
+		}
+	}
 
-				return reqs
-			})),
-		).
-		Complete(r)
+	return reqs
 }
 
 func (r *ClusterImageSetAvailabilityReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -123,22 +127,37 @@ func (r *ClusterImageSetAvailabilityReconciler) Reconcile(ctx context.Context, r
 	if err := r.List(ctx, &pods); err != nil {
 		return ctrl.Result{}, err
 	}
+	templatePods, err := listTemplatePods(ctx, r.Client, r.Config, "")
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	pods.Items = append(templatePods, pods.Items...)
 
 	podMatcher, err := cisa.PodMatcher()
 	if err != nil {
-		log.Error(err, "invalid filter; skipping reconcile until spec is fixed")
-		r.Recorder.Eventf(&cisa, nil, corev1.EventTypeWarning, "InvalidFilter", "ReconcileSkipped", "filter is invalid: %v", err)
-		return ctrl.Result{}, nil
+		return ctrl.Result{}, r.skipInvalidFilter(ctx, &cisa, err)
 	}
 	pods.Items = slices.DeleteFunc(pods.Items, func(p corev1.Pod) bool {
 		return !podMatcher(&p) || !r.globalPodFilter.Match(&p)
 	})
 
+	staticImages := resolveStaticImages(ctx, r.Recorder, &cisa, cisa.Spec.Images, func(repository string) ([]corev1.Secret, error) {
+		registry, _, err := internal.RegistryAndPathFromReference(repository)
+		if err != nil {
+			return nil, err
+		}
+		return r.resolveCredentials(ctx, repository, r.registryConfig(registry).FallbackCredentialSecret, nil)
+	})
+
 	original := cisa.DeepCopy()
-	if changed := r.syncImageList(ctx, &cisa, pods.Items); changed {
+	changed := r.syncImageList(ctx, &cisa, pods.Items, staticImages)
+	setAvailabilityConditions(&cisa)
+	if changed || !apiequality.Semantic.DeepEqual(original.Status.Conditions, cisa.Status.Conditions) {
 		if err := r.Status().Patch(ctx, &cisa, client.MergeFrom(original)); err != nil {
 			return ctrl.Result{}, err
 		}
+	}
+	if changed {
 		log.V(1).Info("updated ClusterImageSetAvailability image monitoring list", "count", len(cisa.Status.Images))
 	}
 
@@ -288,6 +307,7 @@ func (r *ClusterImageSetAvailabilityReconciler) checkNextForRegistry(ctx context
 	log.V(1).Info("checking image availability", "registry", registry, "image", image.Image)
 	r.performCheck(ctx, image, registryConfig, pods)
 	log.V(1).Info("image monitoring done", "status", image.Status)
+	setAvailabilityConditions(candidate.cisa)
 
 	if err := r.Status().Patch(ctx, candidate.cisa, client.MergeFrom(original)); err != nil {
 		return 0, err
@@ -296,6 +316,48 @@ func (r *ClusterImageSetAvailabilityReconciler) checkNextForRegistry(ctx context
 	return tickDuration, nil
 }
 
+// skipInvalidFilter reports the invalid filter of cisa, whose reconciliation is
+// skipped until its spec is fixed.
+func (r *ClusterImageSetAvailabilityReconciler) skipInvalidFilter(ctx context.Context, cisa *kuikv1alpha1.ClusterImageSetAvailability, err error) error {
+	logf.FromContext(ctx).Error(err, "invalid filter; skipping reconcile until spec is fixed")
+	r.Recorder.Eventf(cisa, nil, corev1.EventTypeWarning, "InvalidFilter", "ReconcileSkipped", "filter is invalid: %v", err)
+
+	original := cisa.DeepCopy()
+	setAvailabilityConditions(cisa)
+	return r.Status().Patch(ctx, cisa, client.MergeFrom(original))
+}
+
+// setAvailabilityConditions sets the FilterValid, CredentialsResolved and Ready
+// conditions of cisa. Credentials are resolved unless the last check of one of
+// the monitored images failed because of them.
+func setAvailabilityConditions(cisa *kuikv1alpha1.ClusterImageSetAvailability) {
+	_, err := cisa.PodMatcher()
+	if err == nil {
+		_, err = cisa.ImageFilter()
+	}
+	setFilterValidCondition(&cisa.Status.Conditions, cisa.Generation, err)
+
+	unavailableSecrets, invalidAuths := 0, 0
+	for _, image := range cisa.Status.Images {
+		switch image.Status {
+		case kuikv1alpha1.ImageAvailabilityUnavailableSecret:
+			unavailableSecrets++
+		case kuikv1alpha1.ImageAvailabilityInvalidAuth:
+			invalidAuths++
+		}
+	}
+	switch {
+	case unavailableSecrets > 0:
+		setCondition(&cisa.Status.Conditions, cisa.Generation, kuikv1alpha1.ConditionCredentialsResolved, false, reasonSecretNotFound, fmt.Sprintf("the pull secrets of %d image(s) could not be read", unavailableSecrets))
+	case invalidAuths > 0:
+		setCondition(&cisa.Status.Conditions, cisa.Generation, kuikv1alpha1.ConditionCredentialsResolved, false, reasonInvalidCredentials, fmt.Sprintf("%d image(s) could not be checked with their pull secrets", invalidAuths))
+	default:
+		setCondition(&cisa.Status.Conditions, cisa.Generation, kuikv1alpha1.ConditionCredentialsResolved, true, reasonResolved, "")
+	}
+
+	setReadyCondition(&cisa.Status.Conditions, cisa.Generation, kuikv1alpha1.ConditionFilterValid, kuikv1alpha1.ConditionCredentialsResolved)
+}
+
 func findMonitoredImage(images []kuikv1alpha1.MonitoredImage, name string) *kuikv1alpha1.MonitoredImage {
 	for i := range images {
 		if images[i].Image == name {
@@ -305,7 +367,10 @@ func findMonitoredImage(images []kuikv1alpha1.MonitoredImage, name string) *kuik
 	return nil
 }
 
-func (r *ClusterImageSetAvailabilityReconciler) syncImageList(ctx context.Context, cisa *kuikv1alpha1.ClusterImageSetAvailability, pods []corev1.Pod) (changed bool) {
+// syncImageList updates the monitored images of cisa from the images used by
+// pods and its resolved static images. Static images bypass the image filter
+// and are never marked as unused.
+func (r *ClusterImageSetAvailabilityReconciler) syncImageList(ctx context.Context, cisa *kuikv1alpha1.ClusterImageSetAvailability, pods []corev1.Pod, staticImages []string) (changed bool) {
 	log := logf.FromContext(ctx)
 	now := metav1.NewTime(time.Now())
 	instantExpiryMarker := metav1.NewTime(time.Time{}.Add(time.Hour))
@@ -325,13 +390,21 @@ func (r *ClusterImageSetAvailabilityReconciler) syncImageList(ctx context.Contex
 			}
 		}
 	}
+	for _, imageName := range staticImages {
+		if _, ok := currentImages[imageName]; !ok {
+			currentImages[imageName] = false
+		}
+	}
 
 	// Update unusedSince field (for both in-use status and instantExpiryMarker)
 	for i := range cisa.Status.Images {
 		image := &cisa.Status.Images[i]
 		previousUnused := image.UnusedSince
 
-		if !imageFilter.Match(image.Image) {
+		if cisa.Spec.Images.Matches(image.Image) {
+			// Static images are pinned, even when their tags could not be listed during this reconciliation.
+			image.UnusedSince = nil
+		} else if !imageFilter.Match(image.Image) {
 			if image.UnusedSince == nil || !image.UnusedSince.Equal(&instantExpiryMarker) {
 				image.UnusedSince = &instantExpiryMarker
 				log.Info("image no longer in scope, marking for removal", "image", image.Image)
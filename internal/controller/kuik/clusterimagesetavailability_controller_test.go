@@ -438,4 +438,48 @@ var _ = Describe("ClusterImageSetAvailability Controller", func() {
 			Expect(candidates).NotTo(HaveKey(registry))
 		})
 	})
+
+	Context("When the CISA has static images", func() {
+		ctx := context.Background()
+
+		It("monitors static images outside of the filter and never marks them unused", func() {
+			unusedSince := metav1.NewTime(time.Now().Add(-time.Minute))
+			cisa := &kuikv1alpha1.ClusterImageSetAvailability{
+				Spec: kuikv1alpha1.ClusterImageSetAvailabilitySpec{
+					UnusedImageExpiry: metav1.Duration{Duration: time.Hour},
+					Filter: kuikv1alpha1.ClusterFilter{
+						Include: []kuikv1alpha1.ClusterFilterItem{{FilterItem: kuikv1alpha1.FilterItem{Image: `docker\.io/library/nginx:.*`}}},
+					},
+					Images: kuikv1alpha1.StaticImages{
+						{Image: "redis:7"},
+						{Image: "alpine:3"},
+						{Image: "ghcr.io/enix/kube-image-keeper", Tags: `2\..*`},
+					},
+				},
+				Status: kuikv1alpha1.ClusterImageSetAvailabilityStatus{
+					Images: []kuikv1alpha1.MonitoredImage{
+						{Image: "docker.io/library/redis:7", Status: kuikv1alpha1.ImageAvailabilityAvailable, UnusedSince: &unusedSince},
+						{Image: "ghcr.io/enix/kube-image-keeper:2.0.0", Status: kuikv1alpha1.ImageAvailabilityAvailable},
+						{Image: "docker.io/library/nginx:1.25", Status: kuikv1alpha1.ImageAvailabilityAvailable},
+					},
+				},
+			}
+
+			// The tags of ghcr.io/enix/kube-image-keeper could not be listed: they are not resolved.
+			staticImages := []string{"docker.io/library/redis:7", "docker.io/library/alpine:3"}
+			changed := (&ClusterImageSetAvailabilityReconciler{}).syncImageList(ctx, cisa, nil, staticImages)
+			Expect(changed).To(BeTrue())
+
+			images := map[string]kuikv1alpha1.MonitoredImage{}
+			for _, image := range cisa.Status.Images {
+				images[image.Image] = image
+			}
+			Expect(images).To(HaveLen(4))
+			Expect(images["docker.io/library/redis:7"].UnusedSince).To(BeNil())
+			Expect(images["docker.io/library/alpine:3"].Status).To(Equal(kuikv1alpha1.ImageAvailabilityScheduled))
+			Expect(images["ghcr.io/enix/kube-image-keeper:2.0.0"].UnusedSince).To(BeNil(),
+				"a static image must stay pinned when its tags could not be listed")
+			Expect(images["docker.io/library/nginx:1.25"].UnusedSince).NotTo(BeNil())
+		})
+	})
 })
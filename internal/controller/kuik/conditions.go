@@ -0,0 +1,194 @@
+package kuik
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Reasons of the conditions reported in the status of the kuik resources.
+const (
+	reasonReady              = "Ready"
+	reasonValid              = "Valid"
+	reasonInvalidFilter      = "InvalidFilter"
+	reasonResolved           = "Resolved"
+	reasonSecretNotFound     = "SecretNotFound"
+	reasonInvalidCredentials = "InvalidCredentials"
+	reasonMirrored           = "Mirrored"
+	reasonMirroring          = "Mirroring"
+	reasonWaitingForWindow   = "WaitingForWindow"
+	reasonMirroringFailed    = "MirroringFailed"
+	reasonCleanedUp          = "CleanedUp"
+	reasonCleanupFailed      = "CleanupFailed"
+	reasonCapacityExceeded   = "CapacityExceeded"
+)
+
+// setCondition sets the condition of type conditionType, observed at the
+// given generation, in conditions.
+func setCondition(conditions *[]metav1.Condition, generation int64, conditionType string, status bool, reason, message string) {
+	conditionStatus := metav1.ConditionFalse
+	if status {
+		conditionStatus = metav1.ConditionTrue
+	}
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             conditionStatus,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// setReadyCondition sets the Ready condition from the conditions of the given
+// types: it is true when all of them are, otherwise it carries the reason and
+// message of the first one that is not.
+func setReadyCondition(conditions *[]metav1.Condition, generation int64, conditionTypes ...string) {
+	for _, conditionType := range conditionTypes {
+		condition := meta.FindStatusCondition(*conditions, conditionType)
+		if condition == nil {
+			setCondition(conditions, generation, kuikv1alpha1.ConditionReady, false, "Unknown", fmt.Sprintf("%s is not known yet", conditionType))
+			return
+		} else if condition.Status != metav1.ConditionTrue {
+			setCondition(conditions, generation, kuikv1alpha1.ConditionReady, false, condition.Reason, condition.Message)
+			return
+		}
+	}
+	setCondition(conditions, generation, kuikv1alpha1.ConditionReady, true, reasonReady, "")
+}
+
+// setFilterValidCondition sets the FilterValid condition from the error
+// returned while compiling the filters, and the Ready condition accordingly
+// when it is invalid since the reconciliation stops there.
+func setFilterValidCondition(conditions *[]metav1.Condition, generation int64, err error) {
+	if err == nil {
+		setCondition(conditions, generation, kuikv1alpha1.ConditionFilterValid, true, reasonValid, "")
+		return
+	}
+	setCondition(conditions, generation, kuikv1alpha1.ConditionFilterValid, false, reasonInvalidFilter, err.Error())
+	setReadyCondition(conditions, generation, kuikv1alpha1.ConditionFilterValid)
+}
+
+// setCredentialsResolvedCondition sets the CredentialsResolved condition from
+// the error returned by checkSecretsExist.
+func setCredentialsResolvedCondition(conditions *[]metav1.Condition, generation int64, err error) {
+	if err == nil {
+		setCondition(conditions, generation, kuikv1alpha1.ConditionCredentialsResolved, true, reasonResolved, "")
+	} else if apierrors.IsNotFound(err) {
+		setCondition(conditions, generation, kuikv1alpha1.ConditionCredentialsResolved, false, reasonSecretNotFound, err.Error())
+	} else {
+		setCondition(conditions, generation, kuikv1alpha1.ConditionCredentialsResolved, false, reasonInvalidCredentials, err.Error())
+	}
+}
+
+// checkSecretsExist returns an error if any of the credential secrets does not
+// exist. The namespace of the secrets is ignored for namespaced resources, for
+// which namespace is not empty.
+func checkSecretsExist(ctx context.Context, c client.Client, namespace string, credentialSecrets []*kuikv1alpha1.CredentialSecret) error {
+	errs := []error{}
+	for _, credentialSecret := range credentialSecrets {
+		if credentialSecret == nil {
+			continue
+		}
+		// This allows to use the same code for both cluster-scoped and namespaced resources
+		secretNamespace := namespace
+		if secretNamespace == "" {
+			secretNamespace = credentialSecret.Namespace
+		}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: secretNamespace, Name: credentialSecret.Name}, &corev1.Secret{}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// mirrorConditionTypes are the conditions the Ready condition of the mirror
+// resources is computed from.
+var mirrorConditionTypes = []string{
+	kuikv1alpha1.ConditionFilterValid,
+	kuikv1alpha1.ConditionCredentialsResolved,
+	kuikv1alpha1.ConditionMirroringComplete,
+	kuikv1alpha1.ConditionCleanupHealthy,
+}
+
+// mirrorCredentialSecrets returns the secrets referenced by the spec of a
+// mirror resource, to pull from the sources and to push to the mirrors.
+func mirrorCredentialSecrets(spec *kuikv1alpha1.ImageSetMirrorBase) []*kuikv1alpha1.CredentialSecret {
+	credentialSecrets := []*kuikv1alpha1.CredentialSecret{}
+	for i := range spec.SourceCredentials {
+		credentialSecrets = append(credentialSecrets, &spec.SourceCredentials[i].CredentialSecret)
+	}
+	for i := range spec.Mirrors {
+		credentialSecrets = append(credentialSecrets, spec.Mirrors[i].CredentialSecret)
+	}
+	return credentialSecrets
+}
+
+// setMirroringCompleteCondition sets the MirroringComplete condition from the
+// mirrors of the images in use and of the prefetched images not yet unused. The
+// failed mirrors of the images protected by minReplicas are best effort and do
+// not fail the condition.
+func setMirroringCompleteCondition(conditions *[]metav1.Condition, generation int64, status *kuikv1alpha1.ImageSetMirrorStatus, minReplicas int32) {
+	imagesMirrors := [][]kuikv1alpha1.MirrorStatus{}
+	for _, matchingImage := range status.MatchingImages {
+		if matchingImage.UnusedSince == nil {
+			imagesMirrors = append(imagesMirrors, matchingImage.Mirrors)
+		}
+	}
+	for _, prefetchedImage := range status.PrefetchedImages {
+		if prefetchedImage.UnusedSince == nil {
+			imagesMirrors = append(imagesMirrors, prefetchedImage.Mirrors)
+		}
+	}
+
+	total, failed, bestEffortFailed, pending, waiting := 0, 0, 0, 0, 0
+	for _, mirrors := range imagesMirrors {
+		protected := isProtected(minReplicas, mirrors)
+		for _, mirror := range mirrors {
+			total++
+			if mirror.LastError != "" && protected {
+				bestEffortFailed++
+			} else if mirror.LastError != "" {
+				failed++
+			} else if mirror.MirroredAt == nil {
+				pending++
+				if mirror.WaitingForWindowUntil != nil {
+					waiting++
+				}
+			}
+		}
+	}
+
+	switch {
+	case failed > 0:
+		setCondition(conditions, generation, kuikv1alpha1.ConditionMirroringComplete, false, reasonMirroringFailed, fmt.Sprintf("%d of %d mirror(s) failed", failed, total))
+	case pending > 0 && pending == waiting:
+		setCondition(conditions, generation, kuikv1alpha1.ConditionMirroringComplete, false, reasonWaitingForWindow, fmt.Sprintf("%d of %d mirror(s) waiting for a copy window", pending, total))
+	case pending > 0:
+		setCondition(conditions, generation, kuikv1alpha1.ConditionMirroringComplete, false, reasonMirroring, fmt.Sprintf("%d of %d mirror(s) pending", pending, total))
+	case bestEffortFailed > 0:
+		setCondition(conditions, generation, kuikv1alpha1.ConditionMirroringComplete, true, reasonMirrored, fmt.Sprintf("%d of %d mirror(s) up to date, %d best effort mirror(s) failed", total-bestEffortFailed, total, bestEffortFailed))
+	default:
+		setCondition(conditions, generation, kuikv1alpha1.ConditionMirroringComplete, true, reasonMirrored, fmt.Sprintf("%d mirror(s) up to date", total))
+	}
+}
+
+// setCleanupHealthyCondition sets the CleanupHealthy condition from the outcome
+// of the deletion of the unused mirrors and from the capacities that cannot be
+// met without deleting images in use.
+func setCleanupHealthyCondition(conditions *[]metav1.Condition, generation int64, someDeletionFailed bool, capacityErr error) {
+	if someDeletionFailed {
+		setCondition(conditions, generation, kuikv1alpha1.ConditionCleanupHealthy, false, reasonCleanupFailed, "one or more unused mirror(s) could not be deleted")
+		return
+	} else if capacityErr != nil {
+		setCondition(conditions, generation, kuikv1alpha1.ConditionCleanupHealthy, false, reasonCapacityExceeded, capacityErr.Error())
+		return
+	}
+	setCondition(conditions, generation, kuikv1alpha1.ConditionCleanupHealthy, true, reasonCleanedUp, "")
+}
@@ -0,0 +1,263 @@
+package kuik
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	"github.com/enix/kube-image-keeper/internal"
+	"github.com/enix/kube-image-keeper/internal/copier"
+	"github.com/enix/kube-image-keeper/internal/registry"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	copyJobGenerateName     = "kuik-copy-"
+	copierContainerName     = "copier"
+	copierCredentialsVolume = "credentials"
+	copierCredentialsDir    = "/var/run/kuik/credentials"
+
+	// copyJobCacheGracePeriod is how long the cache is given to catch up with a
+	// freshly created Job and the status of its pods.
+	copyJobCacheGracePeriod = time.Minute
+)
+
+// copyImageInJob copies source to dest in a Job and waits for it to finish. A
+// Job still copying source to dest, left over by a previous manager for
+// instance, is waited for instead of creating a new one.
+func (r *ImageSetMirrorBaseReconciler) copyImageInJob(ctx context.Context, spec *kuikv1alpha1.Copy, srcSecrets, destSecrets []corev1.Secret, source, dest string) (*copier.Result, error) {
+	log := logf.FromContext(ctx)
+	jobs := r.Config.Mirroring.Jobs
+	if jobs.Image == "" || jobs.Namespace == "" {
+		return nil, errors.New("copy jobs are not configured, mirroring.jobs.image and mirroring.jobs.namespace are required")
+	}
+
+	copyHash := copyJobHash(source, dest)
+	job, err := r.findRunningCopyJob(ctx, jobs.Namespace, copyHash)
+	if err != nil {
+		return nil, err
+	} else if job != nil {
+		log.V(1).Info("waiting for running copy job", "job", job.Name)
+	} else {
+		if job, err = r.createCopyJob(ctx, spec, srcSecrets, destSecrets, source, dest, copyHash); err != nil {
+			return nil, err
+		}
+		log.V(1).Info("created copy job", "job", job.Name)
+	}
+
+	var result *copier.Result
+	err = wait.PollUntilContextCancel(ctx, jobs.PollInterval, false, func(ctx context.Context) (bool, error) {
+		if err := r.Get(ctx, client.ObjectKeyFromObject(job), job); apierrors.IsNotFound(err) && time.Since(job.CreationTimestamp.Time) < copyJobCacheGracePeriod {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		finished := jobFinishedCondition(job)
+		if finished == nil {
+			return false, nil
+		}
+
+		if result, err = r.copyJobResult(ctx, job); err != nil {
+			return false, err
+		} else if result == nil {
+			if time.Since(finished.LastTransitionTime.Time) < copyJobCacheGracePeriod {
+				return false, nil
+			}
+			return false, fmt.Errorf("copy job %s finished without reporting a result: %s", job.Name, finished.Message)
+		}
+		return true, nil
+	})
+	if err != nil {
+		if errors.Is(context.Cause(ctx), errCopyCanceled) {
+			log.V(1).Info("copy canceled, deleting copy job", "job", job.Name)
+			if err := r.Delete(context.WithoutCancel(ctx), job, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+				log.Error(err, "could not delete copy job", "job", job.Name)
+			}
+		}
+		return nil, err
+	}
+
+	if result.Error != "" {
+		err := fmt.Errorf("copy job %s failed: %s", job.Name, result.Error)
+		if result.Permanent {
+			err = registry.Permanent(err)
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// findRunningCopyJob returns the Job still copying the image identified by
+// copyHash, if any.
+func (r *ImageSetMirrorBaseReconciler) findRunningCopyJob(ctx context.Context, namespace, copyHash string) (*batchv1.Job, error) {
+	var jobs batchv1.JobList
+	if err := r.List(ctx, &jobs, client.InNamespace(namespace), client.MatchingLabels{CopyJobLabel: copyHash}); err != nil {
+		return nil, err
+	}
+
+	for i := range jobs.Items {
+		if jobFinishedCondition(&jobs.Items[i]) == nil && jobs.Items[i].DeletionTimestamp.IsZero() {
+			return &jobs.Items[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// createCopyJob creates a Job copying source to dest, along with a secret
+// holding the credentials it needs. The secret is named after the Job and
+// created once the Job exists so that it is owned by the Job from the start and
+// garbage collected along with it. The pod of the Job waits for its secret to be
+// mounted in the meantime.
+func (r *ImageSetMirrorBaseReconciler) createCopyJob(ctx context.Context, spec *kuikv1alpha1.Copy, srcSecrets, destSecrets []corev1.Secret, source, dest, copyHash string) (*batchv1.Job, error) {
+	jobs := r.Config.Mirroring.Jobs
+	labels := map[string]string{CopyJobLabel: copyHash}
+
+	destRegistry, _, err := internal.RegistryAndPathFromReference(dest)
+	if err != nil {
+		return nil, err
+	}
+	// The limits cannot be shared between Jobs, each of them is bounded on its own
+	args, err := copier.Args(source, dest, r.platforms, spec.Referrers, copierCredentialsDir, r.BandwidthLimiter.MaxBytesPerSecond(destRegistry))
+	if err != nil {
+		return nil, err
+	}
+
+	// The name is generated beforehand for the Job to refer to its secret
+	name := copyJobGenerateName + utilrand.String(5)
+	backoffLimit := int32(0)
+	ttlSecondsAfterFinished := spec.Job.GetTTLSecondsAfterFinished()
+	runAsNonRoot, readOnly := true, true
+	automountServiceAccountToken, allowPrivilegeEscalation := false, false
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: jobs.Namespace,
+			Labels:    labels,
+			Annotations: map[string]string{
+				CopyFromAnnotation: source,
+				CopyToAnnotation:   dest,
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &backoffLimit,
+			ActiveDeadlineSeconds:   spec.Job.ActiveDeadlineSeconds,
+			TTLSecondsAfterFinished: &ttlSecondsAfterFinished,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					RestartPolicy:                corev1.RestartPolicyNever,
+					ServiceAccountName:           jobs.ServiceAccountName,
+					AutomountServiceAccountToken: &automountServiceAccountToken,
+					NodeSelector:                 spec.Job.NodeSelector,
+					Tolerations:                  spec.Job.Tolerations,
+					SecurityContext:              &corev1.PodSecurityContext{RunAsNonRoot: &runAsNonRoot},
+					Containers: []corev1.Container{{
+						Name:                     copierContainerName,
+						Image:                    jobs.Image,
+						Command:                  []string{"manager"},
+						Args:                     args,
+						Resources:                spec.Job.Resources,
+						TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+						SecurityContext: &corev1.SecurityContext{
+							AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+							ReadOnlyRootFilesystem:   &readOnly,
+							Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+						},
+						VolumeMounts: []corev1.VolumeMount{{
+							Name:      copierCredentialsVolume,
+							MountPath: copierCredentialsDir,
+							ReadOnly:  true,
+						}},
+					}},
+					Volumes: []corev1.Volume{{
+						Name: copierCredentialsVolume,
+						VolumeSource: corev1.VolumeSource{
+							Secret: &corev1.SecretVolumeSource{SecretName: name},
+						},
+					}},
+				},
+			},
+		},
+	}
+	if err := r.Create(ctx, job); err != nil {
+		return nil, err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       jobs.Namespace,
+			Labels:          labels,
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(job, batchv1.SchemeGroupVersion.WithKind("Job"))},
+		},
+		Data: copier.CredentialsData(srcSecrets, destSecrets),
+	}
+	if err := r.Create(ctx, secret); err != nil {
+		return nil, errors.Join(err, client.IgnoreNotFound(r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground))))
+	}
+
+	return job, nil
+}
+
+// copyJobResult returns the result reported by the copier of job, or nil if
+// its pod did not report any result yet.
+func (r *ImageSetMirrorBaseReconciler) copyJobResult(ctx context.Context, job *batchv1.Job) (*copier.Result, error) {
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods, client.InNamespace(job.Namespace), client.MatchingLabels{batchv1.JobNameLabel: job.Name}); err != nil {
+		return nil, err
+	}
+
+	var terminated *corev1.ContainerStateTerminated
+	for _, pod := range pods.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name != copierContainerName || status.State.Terminated == nil {
+				continue
+			}
+			if terminated == nil || status.State.Terminated.FinishedAt.After(terminated.FinishedAt.Time) {
+				terminated = status.State.Terminated
+			}
+		}
+	}
+	if terminated == nil {
+		return nil, nil
+	}
+
+	result := &copier.Result{}
+	if err := json.Unmarshal([]byte(terminated.Message), result); err != nil {
+		// The copier did not get to write its result, the message holds the end of its logs instead
+		result.Error = fmt.Sprintf("%s (exit code %d): %s", terminated.Reason, terminated.ExitCode, terminated.Message)
+	}
+	return result, nil
+}
+
+// jobFinishedCondition returns the condition of job telling it is complete or
+// failed, nil if it is still running.
+func jobFinishedCondition(job *batchv1.Job) *batchv1.JobCondition {
+	for i, condition := range job.Status.Conditions {
+		if (condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed) && condition.Status == corev1.ConditionTrue {
+			return &job.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// copyJobHash identifies the copy of source to dest in a label value.
+func copyJobHash(source, dest string) string {
+	hash := sha256.Sum256([]byte(source + "\x00" + dest))
+	return hex.EncodeToString(hash[:])[:32]
+}
@@ -0,0 +1,161 @@
+package kuik
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	"github.com/enix/kube-image-keeper/internal/config"
+	"github.com/enix/kube-image-keeper/internal/copier"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+var _ = Describe("Copy jobs", func() {
+	ctx := context.Background()
+
+	const (
+		namespace = "kuik-system"
+		source    = "docker.io/library/nginx:1.27"
+		dest      = "mirror.example.com/library/nginx:1.27"
+	)
+
+	var (
+		r    *ImageSetMirrorBaseReconciler
+		spec *kuikv1alpha1.Copy
+	)
+
+	BeforeEach(func() {
+		r = &ImageSetMirrorBaseReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).Build(),
+			Scheme: scheme.Scheme,
+			Config: &config.Config{Mirroring: config.Mirroring{Jobs: config.CopyJobs{
+				Image:        "enix/kube-image-keeper:test",
+				Namespace:    namespace,
+				PollInterval: 10 * time.Millisecond,
+			}}},
+			platforms: []v1.Platform{{OS: "linux", Architecture: "amd64"}},
+		}
+		spec = &kuikv1alpha1.Copy{Job: kuikv1alpha1.CopyJob{NodeSelector: map[string]string{"kuik.enix.io/copier": "true"}}}
+	})
+
+	// waitForJob returns the copy Job once created.
+	waitForJob := func() *batchv1.Job {
+		var jobs batchv1.JobList
+		Eventually(func(g Gomega) {
+			g.Expect(r.List(ctx, &jobs, client.InNamespace(namespace))).To(Succeed())
+			g.Expect(jobs.Items).To(HaveLen(1))
+		}).Should(Succeed())
+		return &jobs.Items[0]
+	}
+
+	// finishJob plays the Job controller, terminating the pod of job with message.
+	finishJob := func(job *batchv1.Job, conditionType batchv1.JobConditionType, message string) {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: job.Name + "-pod", Namespace: namespace, Labels: map[string]string{batchv1.JobNameLabel: job.Name}},
+			Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  copierContainerName,
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: message}},
+			}}},
+		}
+		Expect(r.Create(ctx, pod)).To(Succeed())
+		job.Status.Conditions = append(job.Status.Conditions, batchv1.JobCondition{Type: conditionType, Status: corev1.ConditionTrue, LastTransitionTime: metav1.Now()})
+		Expect(r.Status().Update(ctx, job)).To(Succeed())
+	}
+
+	It("reports the result of the copier into the mirror status", func() {
+		data, err := json.Marshal(copier.Result{SourceDigest: "sha256:aaa", DestinationDigest: "sha256:bbb", Size: 1024, Layers: 2, UploadedBytes: 512})
+		Expect(err).NotTo(HaveOccurred())
+		go func() {
+			defer GinkgoRecover()
+			finishJob(waitForJob(), batchv1.JobComplete, string(data))
+		}()
+
+		srcSecrets := []corev1.Secret{{Type: corev1.SecretTypeDockerConfigJson, Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte("{}")}}}
+		result, err := r.copyImageInJob(ctx, spec, srcSecrets, nil, source, dest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(&copier.Result{SourceDigest: "sha256:aaa", DestinationDigest: "sha256:bbb", Size: 1024, Layers: 2, UploadedBytes: 512}))
+
+		job := waitForJob()
+		Expect(job.Annotations).To(HaveKeyWithValue(CopyFromAnnotation, source))
+		Expect(*job.Spec.TTLSecondsAfterFinished).To(Equal(kuikv1alpha1.DefaultCopyJobTTLSecondsAfterFinished))
+		podSpec := job.Spec.Template.Spec
+		Expect(podSpec.NodeSelector).To(Equal(spec.Job.NodeSelector))
+		Expect(podSpec.Containers[0].Image).To(Equal("enix/kube-image-keeper:test"))
+		Expect(podSpec.Containers[0].Args).To(ContainElements(copier.Command, "-from="+source, "-to="+dest))
+
+		secret := &corev1.Secret{}
+		Expect(r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: podSpec.Volumes[0].Secret.SecretName}, secret)).To(Succeed())
+		Expect(secret.Data).To(HaveKey("source-000" + corev1.DockerConfigJsonKey))
+		Expect(secret.OwnerReferences).To(ConsistOf(HaveField("Name", job.Name)))
+	})
+
+	It("reports the error of a failed copier", func() {
+		go func() {
+			defer GinkgoRecover()
+			finishJob(waitForJob(), batchv1.JobFailed, `{"error":"MANIFEST_UNKNOWN"}`)
+		}()
+
+		_, err := r.copyImageInJob(ctx, spec, nil, nil, source, dest)
+		Expect(err).To(MatchError(ContainSubstring("MANIFEST_UNKNOWN")))
+	})
+
+	It("waits for a running Job copying the same image instead of creating a new one", func() {
+		job, err := r.createCopyJob(ctx, spec, nil, nil, source, dest, copyJobHash(source, dest))
+		Expect(err).NotTo(HaveOccurred())
+		go func() {
+			defer GinkgoRecover()
+			time.Sleep(50 * time.Millisecond)
+			finishJob(job, batchv1.JobComplete, `{"sourceDigest":"sha256:aaa","destinationDigest":"sha256:aaa"}`)
+		}()
+
+		result, err := r.copyImageInJob(ctx, spec, nil, nil, source, dest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.SourceDigest).To(Equal("sha256:aaa"))
+		Expect(waitForJob().Name).To(Equal(job.Name))
+	})
+
+	It("deletes the Job of a canceled copy", func() {
+		copyCtx, cancel := context.WithCancelCause(ctx)
+		go func() {
+			defer GinkgoRecover()
+			waitForJob()
+			cancel(errCopyCanceled)
+		}()
+
+		_, err := r.copyImageInJob(copyCtx, spec, nil, nil, source, dest)
+		Expect(err).To(HaveOccurred())
+		Eventually(func(g Gomega) {
+			var jobs batchv1.JobList
+			g.Expect(r.List(ctx, &jobs, client.InNamespace(namespace))).To(Succeed())
+			g.Expect(jobs.Items).To(BeEmpty())
+		}).Should(Succeed())
+	})
+
+	It("deletes the Job when its secret cannot be created", func() {
+		r.Client = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithInterceptorFuncs(interceptor.Funcs{
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				if _, ok := obj.(*corev1.Secret); ok {
+					return errors.New("forbidden")
+				}
+				return c.Create(ctx, obj, opts...)
+			},
+		}).Build()
+
+		_, err := r.createCopyJob(ctx, spec, nil, nil, source, dest, copyJobHash(source, dest))
+		Expect(err).To(MatchError("forbidden"))
+		var jobs batchv1.JobList
+		Expect(r.List(ctx, &jobs, client.InNamespace(namespace))).To(Succeed())
+		Expect(jobs.Items).To(BeEmpty())
+	})
+})
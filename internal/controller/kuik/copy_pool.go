@@ -0,0 +1,338 @@
+package kuik
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	"github.com/enix/kube-image-keeper/internal"
+	"github.com/enix/kube-image-keeper/internal/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// copyFunc copies an image to mirror, updating its status, and returns a
+// description of the drift that triggered the copy, if any.
+type copyFunc func(ctx context.Context, mirror *kuikv1alpha1.MirrorStatus) (drift string, err error)
+
+type copyKey struct {
+	// owner is the kind and name of the resource the copy is run for, since
+	// resources of several kinds share the pool.
+	owner    string
+	from, to string
+}
+
+type copyResult struct {
+	mirror kuikv1alpha1.MirrorStatus
+	drift  string
+	err    error
+}
+
+// errCopyCanceled is the cause of the cancellation of the copies that are not
+// needed anymore, as opposed to the copies canceled on shutdown.
+var errCopyCanceled = errors.New("copy canceled")
+
+type pendingCopy struct {
+	cancel context.CancelCauseFunc
+	done   bool
+	result copyResult
+}
+
+// CopyPool runs image copies in the background, so that a reconciliation never
+// waits for a copy to finish. The number of concurrent copies is bounded
+// globally and per source and destination registry. Once a copy is done, its
+// owner is enqueued again to collect the result into its status.
+//
+// CopyPool is shared by the mirror resource reconcilers and by the upstream
+// sync of the (Cluster)ReplicatedImageSet reconcilers so that the limits apply
+// to every kind at once. It must be added to the manager, which cancels the
+// running copies on shutdown.
+type CopyPool struct {
+	limits config.Concurrency
+	global chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu           sync.Mutex
+	sources      map[string]chan struct{}
+	destinations map[string]chan struct{}
+	pending      map[copyKey]*pendingCopy
+}
+
+func NewCopyPool(limits config.Concurrency) *CopyPool {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &CopyPool{
+		limits:       limits,
+		global:       make(chan struct{}, limits.MaxConcurrent),
+		ctx:          ctx,
+		cancel:       cancel,
+		sources:      map[string]chan struct{}{},
+		destinations: map[string]chan struct{}{},
+		pending:      map[copyKey]*pendingCopy{},
+	}
+}
+
+// Start implements manager.Runnable. It blocks until ctx is done and then
+// cancels the running copies.
+func (p *CopyPool) Start(ctx context.Context) error {
+	<-ctx.Done()
+	p.cancel()
+	return nil
+}
+
+// submit starts copying in the background. Once done, an event for owner is
+// sent to events.
+func (p *CopyPool) submit(key copyKey, sourceRegistry, destinationRegistry string, mirror kuikv1alpha1.MirrorStatus, copy func(ctx context.Context, mirror *kuikv1alpha1.MirrorStatus) copyResult, owner client.Object, events chan<- event.GenericEvent) {
+	ctx, cancel := context.WithCancelCause(p.ctx)
+	pending := &pendingCopy{cancel: cancel}
+
+	p.mu.Lock()
+	p.pending[key] = pending
+	source := p.semaphore(p.sources, sourceRegistry, p.limits.PerSourceRegistry)
+	destination := p.semaphore(p.destinations, destinationRegistry, p.limits.PerDestinationRegistry)
+	p.mu.Unlock()
+
+	pendingCopies.Inc()
+	go func() {
+		defer pendingCopies.Dec()
+		defer cancel(nil)
+
+		var result copyResult
+		if release, err := acquire(ctx, source, destination, p.global); err != nil {
+			result = copyResult{mirror: mirror, err: err}
+		} else {
+			result = copy(ctx, &mirror)
+			release()
+		}
+
+		p.mu.Lock()
+		if p.pending[key] != pending {
+			// The copy was forgotten while running, nobody is waiting for its result anymore
+			p.mu.Unlock()
+			return
+		}
+		pending.done = true
+		pending.result = result
+		p.mu.Unlock()
+
+		select {
+		case events <- event.GenericEvent{Object: owner}:
+		case <-p.ctx.Done():
+		}
+	}()
+}
+
+// collect returns the result of the copy of key when it is done, and whether
+// it is still running otherwise. The result is kept until it is acknowledged,
+// so that it is collected again if it could not be persisted.
+func (p *CopyPool) collect(key copyKey) (result *copyResult, running bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pending, ok := p.pending[key]
+	if !ok {
+		return nil, false
+	} else if !pending.done {
+		return nil, true
+	}
+
+	return &pending.result, false
+}
+
+// ack drops the results of the done copies of keys, once they are persisted.
+func (p *CopyPool) ack(keys ...copyKey) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, key := range keys {
+		if pending, ok := p.pending[key]; ok && pending.done {
+			delete(p.pending, key)
+		}
+	}
+}
+
+// forget cancels and drops the copies of owner whose key is not kept.
+func (p *CopyPool) forget(owner string, keep func(key copyKey) bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, pending := range p.pending {
+		if key.owner == owner && !keep(key) {
+			pending.cancel(errCopyCanceled)
+			delete(p.pending, key)
+		}
+	}
+}
+
+// semaphore returns the semaphore of registry in semaphores, creating it with
+// size slots if needed. p.mu must be held.
+func (p *CopyPool) semaphore(semaphores map[string]chan struct{}, registry string, size int) chan struct{} {
+	semaphore, ok := semaphores[registry]
+	if !ok {
+		semaphore = make(chan struct{}, size)
+		semaphores[registry] = semaphore
+	}
+	return semaphore
+}
+
+// acquire takes a slot of every semaphore, in order, and returns a function
+// releasing them. The global semaphore must come last so that a copy waiting
+// for a busy registry does not hold a global slot.
+func acquire(ctx context.Context, semaphores ...chan struct{}) (release func(), err error) {
+	acquired := []chan struct{}{}
+	release = func() {
+		for _, semaphore := range acquired {
+			<-semaphore
+		}
+	}
+
+	for _, semaphore := range semaphores {
+		select {
+		case semaphore <- struct{}{}:
+			acquired = append(acquired, semaphore)
+		case <-ctx.Done():
+			release()
+			return nil, context.Cause(ctx)
+		}
+	}
+
+	return release, nil
+}
+
+// copies tracks the copies of the mirrors of a mirror resource, or of the
+// synced images of a replicated image set, during one reconciliation.
+type copies struct {
+	pool *CopyPool
+	// owner is a copy of the resource, that the copies running in the background
+	// read while the reconciliation updates the resource itself, and ownerKey
+	// its kind and name.
+	owner    client.Object
+	ownerKey string
+	events   chan<- event.GenericEvent
+	seen     map[copyKey]struct{}
+	// collected holds the copies whose result was collected since the last
+	// acknowledgment.
+	collected []copyKey
+	// window holds the copy windows of the owner, and windowOpensAt the earliest
+	// opening of a window a copy is waiting for.
+	window        kuikv1alpha1.Copy
+	windowOpensAt time.Time
+}
+
+func (r *ImageSetMirrorBaseReconciler) newCopies(obj MirrorObject) *copies {
+	return &copies{
+		pool:     r.CopyPool,
+		owner:    obj.DeepCopyObject().(client.Object),
+		ownerKey: mirrorResourceName(obj),
+		events:   r.copyEvents,
+		seen:     map[copyKey]struct{}{},
+		window:   *obj.MirrorSpec().Copy.DeepCopy(),
+	}
+}
+
+// run copies from to mirror with copy. It returns whether the copy is done and,
+// if so, its drift and error. Copies are submitted to the copy pool, and done
+// in a later reconciliation that collects their result into mirror, to be
+// acknowledged with ack once persisted. Without a copy pool, as in unit tests,
+// copies run inline and are done right away. New copies are deferred while the
+// copy windows are closed.
+func (c *copies) run(ctx context.Context, from string, mirror *kuikv1alpha1.MirrorStatus, copy copyFunc) (done bool, drift string, err error) {
+	key := copyKey{owner: c.ownerKey, from: from, to: mirror.Image}
+	if c.pool != nil {
+		c.seen[key] = struct{}{}
+
+		result, running := c.pool.collect(key)
+		if result != nil {
+			c.collected = append(c.collected, key)
+			*mirror = result.mirror
+			return true, result.drift, result.err
+		} else if running {
+			return false, "", nil
+		}
+	}
+
+	if open, err := c.windowOpen(ctx, mirror); err != nil {
+		return true, "", err
+	} else if !open {
+		return false, "", nil
+	}
+
+	if c.pool == nil {
+		drift, err := copy(ctx, mirror)
+		return true, drift, err
+	}
+
+	sourceRegistry, _, err := internal.RegistryAndPathFromReference(from)
+	if err != nil {
+		return true, "", err
+	}
+	destinationRegistry, _, err := internal.RegistryAndPathFromReference(mirror.Image)
+	if err != nil {
+		return true, "", err
+	}
+
+	log := logf.FromContext(ctx)
+	c.pool.submit(key, sourceRegistry, destinationRegistry, *mirror, func(ctx context.Context, mirror *kuikv1alpha1.MirrorStatus) copyResult {
+		drift, err := copy(logf.IntoContext(ctx, log), mirror)
+		return copyResult{mirror: *mirror, drift: drift, err: err}
+	}, c.owner, c.events)
+
+	return false, "", nil
+}
+
+// ack acknowledges the results collected since the last acknowledgment, once
+// the status of the owner is persisted with them. The results that are not
+// acknowledged, because the status could not be persisted, are collected again
+// by the next reconciliation rather than copied again.
+func (c *copies) ack() {
+	if c.pool == nil {
+		return
+	}
+	c.pool.ack(c.collected...)
+	c.collected = nil
+}
+
+// windowOpen returns whether a new copy to mirror may start now. Otherwise,
+// mirror is marked as waiting for the opening of the next copy window.
+func (c *copies) windowOpen(ctx context.Context, mirror *kuikv1alpha1.MirrorStatus) (bool, error) {
+	open, opensAt, err := c.window.NextWindow(time.Now())
+	if err != nil || open {
+		mirror.WaitingForWindowUntil = nil
+		return open, err
+	}
+
+	logf.FromContext(ctx).V(1).Info("waiting for copy window", "opensAt", opensAt)
+	waitingUntil := metav1.NewTime(opensAt)
+	mirror.WaitingForWindowUntil = &waitingUntil
+	if c.windowOpensAt.IsZero() || opensAt.Before(c.windowOpensAt) {
+		c.windowOpensAt = opensAt
+	}
+	return false, nil
+}
+
+// requeueAfter returns when the owner must be reconciled again to start the
+// copies waiting for a copy window, 0 if none is waiting.
+func (c *copies) requeueAfter() time.Duration {
+	if c.windowOpensAt.IsZero() {
+		return 0
+	}
+	return max(time.Until(c.windowOpensAt), time.Second)
+}
+
+// forgetUnseen cancels and drops the copies of the owner that were not run
+// during this reconciliation, such as the copies of mirrors removed from its
+// spec.
+func (c *copies) forgetUnseen() {
+	if c.pool == nil {
+		return
+	}
+	c.pool.forget(c.ownerKey, func(key copyKey) bool {
+		_, ok := c.seen[key]
+		return ok
+	})
+}
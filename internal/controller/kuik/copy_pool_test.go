@@ -0,0 +1,191 @@
+package kuik
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	"github.com/enix/kube-image-keeper/internal/config"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+var _ = Describe("Copy pool", func() {
+	ctx := context.Background()
+
+	var (
+		pool   *CopyPool
+		events chan event.GenericEvent
+		obj    *kuikv1alpha1.ImageSetMirror
+		r      *ImageSetMirrorBaseReconciler
+	)
+
+	BeforeEach(func() {
+		pool = NewCopyPool(config.Concurrency{MaxConcurrent: 3, PerSourceRegistry: 2, PerDestinationRegistry: 3})
+		events = make(chan event.GenericEvent, 16)
+		obj = &kuikv1alpha1.ImageSetMirror{ObjectMeta: metav1.ObjectMeta{Name: "ism", Namespace: "default"}}
+		r = &ImageSetMirrorBaseReconciler{CopyPool: pool, copyEvents: events}
+	})
+
+	AfterEach(func() {
+		pool.cancel()
+	})
+
+	It("collects the result of a copy in a later reconciliation", func() {
+		copyImage := func(ctx context.Context, mirror *kuikv1alpha1.MirrorStatus) (string, error) {
+			mirror.DestinationDigest = "sha256:abc"
+			return "", nil
+		}
+
+		mirror := &kuikv1alpha1.MirrorStatus{Image: "mirror.example.com/library/nginx:1.27"}
+		done, _, err := r.newCopies(obj).run(ctx, "docker.io/library/nginx:1.27", mirror, copyImage)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(done).To(BeFalse())
+		Expect(mirror.DestinationDigest).To(BeEmpty())
+
+		Eventually(events).Should(Receive(HaveField("Object.GetName()", "ism")))
+
+		done, _, err = r.newCopies(obj).run(ctx, "docker.io/library/nginx:1.27", mirror, copyImage)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(done).To(BeTrue())
+		Expect(mirror.DestinationDigest).To(Equal("sha256:abc"))
+	})
+
+	It("keeps the result of a copy until it is acknowledged", func() {
+		var copied atomic.Int32
+		copyImage := func(ctx context.Context, mirror *kuikv1alpha1.MirrorStatus) (string, error) {
+			copied.Add(1)
+			mirror.DestinationDigest = "sha256:abc"
+			return "", nil
+		}
+
+		mirror := &kuikv1alpha1.MirrorStatus{Image: "mirror.example.com/library/nginx:1.27"}
+		done, _, _ := r.newCopies(obj).run(ctx, "docker.io/library/nginx:1.27", mirror, copyImage)
+		Expect(done).To(BeFalse())
+		Eventually(events).Should(Receive())
+
+		By("collecting the result again when the status could not be persisted")
+		for range 2 {
+			mirror = &kuikv1alpha1.MirrorStatus{Image: "mirror.example.com/library/nginx:1.27"}
+			done, _, err := r.newCopies(obj).run(ctx, "docker.io/library/nginx:1.27", mirror, copyImage)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(done).To(BeTrue())
+			Expect(mirror.DestinationDigest).To(Equal("sha256:abc"))
+		}
+		Expect(copied.Load()).To(Equal(int32(1)))
+
+		By("dropping the result once acknowledged")
+		copies := r.newCopies(obj)
+		done, _, _ = copies.run(ctx, "docker.io/library/nginx:1.27", mirror, copyImage)
+		Expect(done).To(BeTrue())
+		copies.ack()
+		result, running := pool.collect(copyKey{owner: mirrorResourceName(obj), from: "docker.io/library/nginx:1.27", to: mirror.Image})
+		Expect(result).To(BeNil())
+		Expect(running).To(BeFalse())
+	})
+
+	It("reports the error of a failed copy", func() {
+		copyImage := func(ctx context.Context, mirror *kuikv1alpha1.MirrorStatus) (string, error) {
+			return "", errors.New("boom")
+		}
+
+		mirror := &kuikv1alpha1.MirrorStatus{Image: "mirror.example.com/library/nginx:1.27"}
+		done, _, _ := r.newCopies(obj).run(ctx, "docker.io/library/nginx:1.27", mirror, copyImage)
+		Expect(done).To(BeFalse())
+		Eventually(events).Should(Receive())
+
+		done, _, err := r.newCopies(obj).run(ctx, "docker.io/library/nginx:1.27", mirror, copyImage)
+		Expect(done).To(BeTrue())
+		Expect(err).To(MatchError("boom"))
+	})
+
+	It("bounds the number of copies per source registry and globally", func() {
+		var running, maxRunning, maxRunningFromDockerHub atomic.Int32
+		var runningFromDockerHub atomic.Int32
+		release := make(chan struct{})
+
+		copies := r.newCopies(obj)
+		for i := range 6 {
+			source := fmt.Sprintf("docker.io/library/image-%d:1.0", i)
+			if i%2 == 1 {
+				source = fmt.Sprintf("quay.io/library/image-%d:1.0", i)
+			}
+			mirror := &kuikv1alpha1.MirrorStatus{Image: fmt.Sprintf("mirror.example.com/image-%d:1.0", i)}
+			_, _, err := copies.run(ctx, source, mirror, func(ctx context.Context, mirror *kuikv1alpha1.MirrorStatus) (string, error) {
+				n := running.Add(1)
+				defer running.Add(-1)
+				maxRunning.Store(max(maxRunning.Load(), n))
+				if i%2 == 0 {
+					n := runningFromDockerHub.Add(1)
+					defer runningFromDockerHub.Add(-1)
+					maxRunningFromDockerHub.Store(max(maxRunningFromDockerHub.Load(), n))
+				}
+				<-release
+				return "", nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		Eventually(running.Load).Should(BeEquivalentTo(3))
+		Consistently(running.Load, 100*time.Millisecond).Should(BeEquivalentTo(3))
+		close(release)
+
+		for range 6 {
+			Eventually(events).Should(Receive())
+		}
+		Expect(maxRunning.Load()).To(BeEquivalentTo(3))
+		Expect(maxRunningFromDockerHub.Load()).To(BeNumerically("<=", 2))
+	})
+
+	It("cancels the copies of mirrors that are not reconciled anymore", func() {
+		started, canceled := make(chan struct{}), make(chan struct{})
+		mirror := &kuikv1alpha1.MirrorStatus{Image: "mirror.example.com/library/nginx:1.27"}
+		_, _, err := r.newCopies(obj).run(ctx, "docker.io/library/nginx:1.27", mirror, func(ctx context.Context, mirror *kuikv1alpha1.MirrorStatus) (string, error) {
+			close(started)
+			<-ctx.Done()
+			close(canceled)
+			return "", ctx.Err()
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(started).Should(BeClosed())
+
+		r.newCopies(obj).forgetUnseen()
+		Eventually(canceled).Should(BeClosed())
+		Consistently(events, 100*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("defers new copies while the copy windows are closed", func() {
+		copied := atomic.Bool{}
+		copyImage := func(ctx context.Context, mirror *kuikv1alpha1.MirrorStatus) (string, error) {
+			copied.Store(true)
+			return "", nil
+		}
+
+		// A window opening one hour from now
+		opensAt := time.Now().UTC().Add(time.Hour).Truncate(time.Minute)
+		obj.Spec.Copy.Windows = []kuikv1alpha1.CopyWindow{{Start: opensAt.Format("15:04"), End: opensAt.Add(time.Hour).Format("15:04")}}
+
+		mirror := &kuikv1alpha1.MirrorStatus{Image: "mirror.example.com/library/nginx:1.27"}
+		copies := r.newCopies(obj)
+		done, _, err := copies.run(ctx, "docker.io/library/nginx:1.27", mirror, copyImage)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(done).To(BeFalse())
+		Expect(mirror.WaitingForWindowUntil.Time.Equal(opensAt)).To(BeTrue())
+		Expect(copies.requeueAfter()).To(BeNumerically("~", time.Until(opensAt), time.Second))
+		Consistently(events, 100*time.Millisecond).ShouldNot(Receive())
+		Expect(copied.Load()).To(BeFalse())
+
+		obj.Spec.Copy.Windows = nil
+		done, _, err = r.newCopies(obj).run(ctx, "docker.io/library/nginx:1.27", mirror, copyImage)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(done).To(BeFalse())
+		Expect(mirror.WaitingForWindowUntil).To(BeNil())
+		Eventually(events).Should(Receive())
+		Expect(copied.Load()).To(BeTrue())
+	})
+})
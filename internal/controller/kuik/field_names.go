@@ -11,8 +11,11 @@ const (
 	OwnerKindLabel    = "kuik.enix.io/owner-kind"
 	OwnerUIDLabel     = "kuik.enix.io/owner-uid"
 	OwnerNameLabel    = "kuik.enix.io/owner-name"
+	CopyJobLabel      = "kuik.enix.io/copy"
 
 	// Annotation names
 	OriginalImagesAnnotation = "kuik.enix.io/original-images"
 	MirrorPodAnnotation      = "kubernetes.io/config.mirror"
+	CopyFromAnnotation       = "kuik.enix.io/copy-from"
+	CopyToAnnotation         = "kuik.enix.io/copy-to"
 )
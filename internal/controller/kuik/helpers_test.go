@@ -0,0 +1,37 @@
+package kuik
+
+import (
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	"github.com/google/go-containerregistry/pkg/crane"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// pushRandomImage pushes a random image of platform to every reference and
+// returns its digest.
+func pushRandomImage(platform v1.Platform, references ...string) string {
+	image, err := random.Image(256, 1)
+	Expect(err).NotTo(HaveOccurred())
+	image, err = mutate.ConfigFile(image, &v1.ConfigFile{OS: platform.OS, Architecture: platform.Architecture})
+	Expect(err).NotTo(HaveOccurred())
+	for _, reference := range references {
+		Expect(crane.Push(image, reference)).To(Succeed())
+	}
+	digest, err := image.Digest()
+	Expect(err).NotTo(HaveOccurred())
+	return digest.String()
+}
+
+// newMirrors returns the statuses of three mirrors of an image, the first
+// mirrored ones of them being copied.
+func newMirrors(mirrored int) []kuikv1alpha1.MirrorStatus {
+	mirroredAt := metav1.Now()
+	mirrors := []kuikv1alpha1.MirrorStatus{{Image: "a/app"}, {Image: "b/app"}, {Image: "c/app"}}
+	for i := range mirrored {
+		mirrors[i].MirroredAt = &mirroredAt
+	}
+	return mirrors
+}
@@ -0,0 +1,100 @@
+package kuik
+
+import (
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	"github.com/enix/kube-image-keeper/internal/info"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const subsystemMirroring = "mirroring"
+
+// Operations counted by mirrorOperationsTotal.
+const (
+	mirrorOperationMirror   = "mirror"
+	mirrorOperationResync   = "resync"
+	mirrorOperationPrefetch = "prefetch"
+)
+
+var mirrorDriftsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: info.MetricsNamespace,
+	Subsystem: subsystemMirroring,
+	Name:      "drifts_total",
+	Help:      "Number of drifts detected between a mirrored image and its source.",
+}, []string{"namespace", "name", "registry"})
+
+var mirrorOperationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: info.MetricsNamespace,
+	Subsystem: subsystemMirroring,
+	Name:      "operations_total",
+	Help:      "Number of mirror, resync and prefetch operations, by outcome.",
+}, []string{"namespace", "name", "operation", "outcome"})
+
+var copyDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: info.MetricsNamespace,
+	Subsystem: subsystemMirroring,
+	Name:      "copy_duration_seconds",
+	Help:      "Duration of the successful copies of images to their mirrors.",
+	Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+}, []string{"source_registry", "destination_registry"})
+
+var copiedBytesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: info.MetricsNamespace,
+	Subsystem: subsystemMirroring,
+	Name:      "copied_bytes_total",
+	Help:      "Number of bytes uploaded to the mirrors by the successful copies.",
+}, []string{"source_registry", "destination_registry"})
+
+var pendingCopies = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: info.MetricsNamespace,
+	Subsystem: subsystemMirroring,
+	Name:      "pending_copies",
+	Help:      "Number of copies submitted to the copy pool and not done yet, waiting for a slot or running.",
+})
+
+var storageBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: info.MetricsNamespace,
+	Subsystem: subsystemMirroring,
+	Name:      "storage_bytes",
+	Help:      "Total size of the images mirrored by a mirror resource, summed over its mirrors.",
+}, []string{"namespace", "name"})
+
+var unprotectedImages = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: info.MetricsNamespace,
+	Subsystem: subsystemMirroring,
+	Name:      "unprotected_images",
+	Help:      "Number of images in use copied to fewer mirrors than the minReplicas of their mirror resource.",
+}, []string{"namespace", "name"})
+
+func init() {
+	metrics.Registry.MustRegister(mirrorDriftsTotal, mirrorOperationsTotal, copyDurationSeconds, copiedBytesTotal, pendingCopies, storageBytes, unprotectedImages)
+}
+
+// observeMirrorOperation counts a done operation of obj on one of its mirrors.
+func observeMirrorOperation(obj client.Object, operation string, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	mirrorOperationsTotal.WithLabelValues(obj.GetNamespace(), obj.GetName(), operation, outcome).Inc()
+}
+
+// trackedStorage returns the total size of the mirrored images of status.
+func trackedStorage(status *kuikv1alpha1.ImageSetMirrorStatus) int64 {
+	size := int64(0)
+	add := func(mirrors []kuikv1alpha1.MirrorStatus) {
+		for _, mirror := range mirrors {
+			if mirror.MirroredAt != nil {
+				size += mirror.Size
+			}
+		}
+	}
+	for _, matchingImage := range status.MatchingImages {
+		add(matchingImage.Mirrors)
+	}
+	for _, prefetchedImage := range status.PrefetchedImages {
+		add(prefetchedImage.Mirrors)
+	}
+	return size
+}
@@ -0,0 +1,44 @@
+package kuik
+
+import (
+	"errors"
+
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Mirror metrics", func() {
+	It("sums the size of the mirrored images only", func() {
+		mirroredAt := metav1.Now()
+		status := &kuikv1alpha1.ImageSetMirrorStatus{
+			MatchingImages: []kuikv1alpha1.MatchingImage{{
+				Image: "docker.io/library/nginx:1.27",
+				Mirrors: []kuikv1alpha1.MirrorStatus{
+					{Image: "mirror-a.example.com/library/nginx:1.27", MirroredAt: &mirroredAt, Size: 100},
+					{Image: "mirror-b.example.com/library/nginx:1.27", MirroredAt: &mirroredAt, Size: 100},
+					{Image: "mirror-c.example.com/library/nginx:1.27", Size: 100},
+				},
+			}},
+			PrefetchedImages: []kuikv1alpha1.PrefetchedImage{{
+				Image:   "docker.io/library/nginx:1.28",
+				Mirrors: []kuikv1alpha1.MirrorStatus{{Image: "mirror-a.example.com/library/nginx:1.28", MirroredAt: &mirroredAt, Size: 50}},
+			}},
+		}
+
+		Expect(trackedStorage(status)).To(BeEquivalentTo(250))
+	})
+
+	It("counts the operations by outcome", func() {
+		obj := &kuikv1alpha1.ImageSetMirror{ObjectMeta: metav1.ObjectMeta{Name: "metrics", Namespace: "default"}}
+
+		observeMirrorOperation(obj, mirrorOperationMirror, nil)
+		observeMirrorOperation(obj, mirrorOperationMirror, nil)
+		observeMirrorOperation(obj, mirrorOperationMirror, errors.New("boom"))
+
+		Expect(testutil.ToFloat64(mirrorOperationsTotal.WithLabelValues("default", "metrics", mirrorOperationMirror, "success"))).To(BeEquivalentTo(2))
+		Expect(testutil.ToFloat64(mirrorOperationsTotal.WithLabelValues("default", "metrics", mirrorOperationMirror, "failure"))).To(BeEquivalentTo(1))
+	})
+})
@@ -0,0 +1,206 @@
+package kuik
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/distribution/reference"
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	"github.com/enix/kube-image-keeper/internal/config"
+	"github.com/enix/kube-image-keeper/internal/registry"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// cleanupMirror deletes the mirrored image of obj from its mirror registry,
+// without affecting the images still tracked by obj or by any other mirror
+// resource: the deletion is skipped when another one tracks the same tag, and
+// only the tag is deleted when another one tracks another tag of the same
+// manifest. When the registry does not support tag deletion, the manifest is
+// deleted only if no other tracked image references it. Skipped deletions are
+// reported with a DeletionSkipped event. When the usage ledger is enabled, the
+// usages of the image recently recorded by other clusters are taken into
+// account the same way. It returns false if the image could not be deleted.
+func (r *ImageSetMirrorBaseReconciler) cleanupMirror(ctx context.Context, obj MirrorObject, image string) (success bool) {
+	log := logf.FromContext(ctx)
+
+	secret, err := r.getImageSecretFromMirrors(ctx, image, obj.GetNamespace(), obj.MirrorSpec().Mirrors)
+	if err != nil {
+		log.Error(err, "could not read secret for image deletion")
+		return false
+	} else if secret == nil {
+		log.V(1).Info("no secret is configured for deleting image, ignoring")
+		return true
+	}
+	client := registry.NewClient(nil, nil).WithPullSecrets([]corev1.Secret{*secret})
+
+	desc, _, err := client.ReadDescriptor(ctx, http.MethodHead, image)
+	if registry.ErrIsImageNotFound(err) {
+		log.V(1).Info("image is already deleted")
+		return true
+	} else if err != nil {
+		log.Error(err, "could not resolve image for deletion")
+		return false
+	}
+
+	tagUser, digestUser, err := r.mirrorReferences(ctx, obj, image, desc.Digest.String())
+	if err != nil {
+		log.Error(err, "could not list the images tracked by mirror resources")
+		return false
+	} else if tagUser != "" {
+		r.skipDeletion(ctx, obj, image, fmt.Sprintf("the tag is still tracked by %s", tagUser))
+		return true
+	}
+
+	ledger := r.usageLedger()
+	if ledger != nil {
+		clusterTagUser, clusterDigestUser, err := clusterReferences(ctx, client, ledger, image, desc.Digest.String())
+		if err != nil {
+			log.Error(err, "could not list the usages of the image recorded by other clusters")
+			return false
+		} else if clusterTagUser != "" {
+			r.skipDeletion(ctx, obj, image, fmt.Sprintf("the tag is still used by %s", clusterTagUser))
+			return true
+		}
+		if digestUser == "" {
+			digestUser = clusterDigestUser
+		}
+	}
+
+	// Images mirrored by digest have no tag to delete
+	if named, err := reference.ParseNormalizedNamed(image); err == nil && !isDigested(named) {
+		if err := client.DeleteTag(ctx, image); err == nil {
+			r.deleteUsage(ctx, client, ledger, image)
+			return true
+		} else if !errors.Is(err, registry.ErrTagDeletionUnsupported) {
+			log.Error(err, "could not delete image tag")
+			return false
+		}
+	}
+
+	if digestUser != "" {
+		r.skipDeletion(ctx, obj, image, fmt.Sprintf("the registry does not support tag deletion and the manifest %s is still referenced by %s", desc.Digest, digestUser))
+		return true
+	}
+
+	if err := client.DeleteImage(ctx, image); err != nil {
+		log.Error(err, "could not delete image")
+		return false
+	}
+	r.deleteUsage(ctx, client, ledger, image)
+
+	return true
+}
+
+// deleteUsage deletes the usage marker of this cluster for the deleted image,
+// when the usage ledger is enabled. The marker is outdated once the image is
+// not used anymore, so failing to delete it only leaves garbage behind.
+func (r *ImageSetMirrorBaseReconciler) deleteUsage(ctx context.Context, client *registry.Client, ledger *config.UsageLedger, image string) {
+	if ledger == nil {
+		return
+	}
+	if err := client.DeleteUsage(ctx, image, ledger.ClusterID); err != nil {
+		logf.FromContext(ctx).V(1).Info("could not delete the usage marker of the image", "reason", err.Error())
+	}
+}
+
+// skipDeletion reports that image is not deleted from its mirror registry, and
+// why, with a DeletionSkipped event on obj.
+func (r *ImageSetMirrorBaseReconciler) skipDeletion(ctx context.Context, obj MirrorObject, image, reason string) {
+	logf.FromContext(ctx).Info("skipping image deletion", "reason", reason)
+	r.Recorder.Eventf(obj, nil, corev1.EventTypeNormal, "DeletionSkipped", "Cleanup", "%s is not deleted: %s", image, reason)
+}
+
+// mirrorReferences looks for the copied mirrors, other than image in obj,
+// tracked by obj and by every other mirror resource in the repository of image.
+// It returns a description of one of the mirrors tracking the same tag as
+// image, and of one of the mirrors whose destination digest is digest, empty
+// if there is none.
+func (r *ImageSetMirrorBaseReconciler) mirrorReferences(ctx context.Context, obj MirrorObject, image, digest string) (tagUser, digestUser string, err error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", "", err
+	}
+
+	objects, err := r.mirrorObjects(ctx, obj)
+	if err != nil {
+		return "", "", err
+	}
+
+	for _, object := range objects {
+		for _, mirror := range statusMirrors(object.MirrorStatus()) {
+			if mirror.MirroredAt == nil || (object == obj && mirror.Image == image) {
+				continue
+			}
+			mirrorNamed, err := reference.ParseNormalizedNamed(mirror.Image)
+			if err != nil || mirrorNamed.Name() != named.Name() {
+				continue
+			}
+			user := fmt.Sprintf("%s (%s)", mirrorResourceName(object), mirror.Image)
+			if mirror.Image == image {
+				return user, "", nil
+			} else if digestUser == "" && mirror.DestinationDigest == digest {
+				digestUser = user
+			}
+		}
+	}
+
+	return "", digestUser, nil
+}
+
+// mirrorObjects returns obj and every other mirror resource. obj is returned as
+// is rather than as listed, since its status may not be persisted yet.
+func (r *ImageSetMirrorBaseReconciler) mirrorObjects(ctx context.Context, obj MirrorObject) ([]MirrorObject, error) {
+	var cismList kuikv1alpha1.ClusterImageSetMirrorList
+	if err := r.List(ctx, &cismList); err != nil {
+		return nil, err
+	}
+	var ismList kuikv1alpha1.ImageSetMirrorList
+	if err := r.List(ctx, &ismList); err != nil {
+		return nil, err
+	}
+
+	objects := []MirrorObject{obj}
+	for i := range cismList.Items {
+		if cismList.Items[i].UID != obj.GetUID() {
+			objects = append(objects, &cismList.Items[i])
+		}
+	}
+	for i := range ismList.Items {
+		if ismList.Items[i].UID != obj.GetUID() {
+			objects = append(objects, &ismList.Items[i])
+		}
+	}
+	return objects, nil
+}
+
+// statusMirrors returns the mirrors of the matching and prefetched images of
+// status.
+func statusMirrors(status *kuikv1alpha1.ImageSetMirrorStatus) []kuikv1alpha1.MirrorStatus {
+	mirrors := []kuikv1alpha1.MirrorStatus{}
+	for _, matchingImage := range status.MatchingImages {
+		mirrors = append(mirrors, matchingImage.Mirrors...)
+	}
+	for _, prefetchedImage := range status.PrefetchedImages {
+		mirrors = append(mirrors, prefetchedImage.Mirrors...)
+	}
+	return mirrors
+}
+
+// mirrorResourceName returns the kind and the name of obj, with its namespace
+// for ImageSetMirrors.
+func mirrorResourceName(obj metav1.Object) string {
+	if obj.GetNamespace() == "" {
+		return "ClusterImageSetMirror " + obj.GetName()
+	}
+	return "ImageSetMirror " + obj.GetNamespace() + "/" + obj.GetName()
+}
+
+// isDigested reports whether named references an image by digest.
+func isDigested(named reference.Named) bool {
+	_, ok := named.(reference.Digested)
+	return ok
+}
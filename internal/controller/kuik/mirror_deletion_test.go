@@ -0,0 +1,222 @@
+package kuik
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	"github.com/enix/kube-image-keeper/internal/config"
+	"github.com/enix/kube-image-keeper/internal/registry"
+	"github.com/google/go-containerregistry/pkg/crane"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Mirror deletion", func() {
+	ctx := context.Background()
+	mirroredAt := metav1.Now()
+
+	var (
+		server             *httptest.Server
+		host, digest       string
+		tagDeletionAllowed bool
+		recorder           *events.FakeRecorder
+		cfg                *config.Config
+	)
+
+	BeforeEach(func() {
+		handler := ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0)))
+		tagDeletionAllowed = true
+		// Every tag shares the same manifest, which a registry deletes along with its tags
+		manifestDeleted := atomic.Bool{}
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodDelete && !strings.Contains(r.URL.Path, "sha256:") && !tagDeletionAllowed {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			} else if manifestDeleted.Load() && strings.Contains(r.URL.Path, "/manifests/") {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			handler.ServeHTTP(w, r)
+			if r.Method == http.MethodDelete && strings.Contains(r.URL.Path, "/manifests/sha256:") {
+				manifestDeleted.Store(true)
+			}
+		}))
+		host = strings.TrimPrefix(server.URL, "http://")
+
+		image, err := random.Image(256, 1)
+		Expect(err).NotTo(HaveOccurred())
+		for _, tag := range []string{"1.0", "latest"} {
+			Expect(crane.Push(image, host+"/mirror/app:"+tag)).To(Succeed())
+		}
+		imageDigest, err := image.Digest()
+		Expect(err).NotTo(HaveOccurred())
+		digest = imageDigest.String()
+		recorder = events.NewFakeRecorder(10)
+		cfg = nil
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	newImageSetMirror := func(name string, mirrors ...string) *kuikv1alpha1.ImageSetMirror {
+		ism := &kuikv1alpha1.ImageSetMirror{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name)},
+			Spec: kuikv1alpha1.ImageSetMirrorSpec{ImageSetMirrorBase: kuikv1alpha1.ImageSetMirrorBase{
+				Mirrors: kuikv1alpha1.Mirrors{{Registry: host, Path: "mirror", CredentialSecret: &kuikv1alpha1.CredentialSecret{Name: "mirror"}}},
+			}},
+		}
+		for _, mirror := range mirrors {
+			ism.Status.MatchingImages = append(ism.Status.MatchingImages, kuikv1alpha1.MatchingImage{
+				Image:   "docker.io/library/app:" + strings.Split(mirror, ":")[1],
+				Mirrors: []kuikv1alpha1.MirrorStatus{{Image: host + "/mirror/" + mirror, MirroredAt: &mirroredAt, DestinationDigest: digest}},
+			})
+		}
+		return ism
+	}
+
+	cleanup := func(obj *kuikv1alpha1.ImageSetMirror, others ...client.Object) bool {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "mirror", Namespace: "default"},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{}}`)},
+		}
+		r := &ImageSetMirrorBaseReconciler{
+			Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(append(others, obj, secret)...).Build(),
+			Scheme:   scheme.Scheme,
+			Recorder: recorder,
+			Config:   cfg,
+		}
+		return r.cleanupMirror(ctx, obj, host+"/mirror/app:1.0")
+	}
+
+	exists := func(tag string) bool {
+		_, err := crane.Head(host + "/mirror/app:" + tag)
+		return err == nil
+	}
+
+	It("deletes only the tag when another resource tracks the same manifest", func() {
+		Expect(cleanup(newImageSetMirror("ism", "app:1.0"), newImageSetMirror("other", "app:latest"))).To(BeTrue())
+		Expect(exists("1.0")).To(BeFalse())
+		Expect(exists("latest")).To(BeTrue())
+	})
+
+	It("skips the deletion of a tag tracked by another resource", func() {
+		Expect(cleanup(newImageSetMirror("ism", "app:1.0"), newImageSetMirror("other", "app:1.0"))).To(BeTrue())
+		Expect(exists("1.0")).To(BeTrue())
+		Expect(recorder.Events).To(Receive(And(ContainSubstring("DeletionSkipped"), ContainSubstring("ImageSetMirror default/other"))))
+	})
+
+	It("skips the deletion of a shared manifest when the registry cannot delete tags", func() {
+		tagDeletionAllowed = false
+		Expect(cleanup(newImageSetMirror("ism", "app:1.0", "app:latest"))).To(BeTrue())
+		Expect(exists("1.0")).To(BeTrue())
+		Expect(exists("latest")).To(BeTrue())
+		Expect(recorder.Events).To(Receive(And(ContainSubstring("DeletionSkipped"), ContainSubstring("does not support tag deletion"))))
+	})
+
+	It("deletes the manifest when the registry cannot delete tags and nothing else references it", func() {
+		tagDeletionAllowed = false
+		Expect(cleanup(newImageSetMirror("ism", "app:1.0"))).To(BeTrue())
+		_, err := crane.Head(host + "/mirror/app@" + digest)
+		Expect(err).To(HaveOccurred())
+		Expect(recorder.Events).NotTo(Receive())
+	})
+
+	DescribeTable("honors the deletion policy when the resource is deleted",
+		func(policy kuikv1alpha1.DeletionPolicy, tagDeletion bool, expectedTags []string, expectedEvents ...string) {
+			tagDeletionAllowed = tagDeletion
+			ism := newImageSetMirror("ism", "app:1.0", "app:latest")
+			ism.Spec.DeletionPolicy = policy
+			ism.Status.MatchingImages[1].UnusedSince = &mirroredAt
+			ism.Finalizers = []string{imageSetMirrorFinalizer}
+			ism.DeletionTimestamp = &mirroredAt
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "mirror", Namespace: "default"},
+				Type:       corev1.SecretTypeDockerConfigJson,
+				Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{}}`)},
+			}
+			r := &ImageSetMirrorBaseReconciler{
+				Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(ism, secret).Build(),
+				Scheme:   scheme.Scheme,
+				Recorder: recorder,
+			}
+
+			_, err := r.reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(ism)}, &kuikv1alpha1.ImageSetMirror{})
+			Expect(err).NotTo(HaveOccurred())
+			tags := []string{}
+			for _, tag := range []string{"1.0", "latest"} {
+				if exists(tag) {
+					tags = append(tags, tag)
+				}
+			}
+			Expect(tags).To(Equal(expectedTags))
+			for _, expectedEvent := range expectedEvents {
+				Expect(recorder.Events).To(Receive(ContainSubstring(expectedEvent)))
+			}
+			Expect(recorder.Events).NotTo(Receive())
+		},
+		Entry("deletes every image by default", kuikv1alpha1.DeletionPolicy(""), true, []string{}, "ImagesDeleted"),
+		Entry("deletes every image with Delete", kuikv1alpha1.DeletionPolicyDelete, true, []string{}, "ImagesDeleted"),
+		Entry("retains every image with Retain", kuikv1alpha1.DeletionPolicyRetain, true, []string{"1.0", "latest"}, "ImagesRetained"),
+		Entry("retains the images in use with RetainInUse", kuikv1alpha1.DeletionPolicyRetainInUse, true, []string{"1.0"}, "ImagesDeleted", "ImagesRetained"),
+		Entry("deletes the manifest shared by its own tags when the registry cannot delete tags", kuikv1alpha1.DeletionPolicyDelete, false, []string{}, "ImagesDeleted"),
+		Entry("keeps the manifest shared with a retained tag when the registry cannot delete tags", kuikv1alpha1.DeletionPolicyRetainInUse, false, []string{"1.0", "latest"}, "DeletionSkipped", "ImagesDeleted", "ImagesRetained"),
+	)
+
+	Context("with the usage ledger", func() {
+		BeforeEach(func() {
+			var err error
+			cfg, err = config.LoadDefault()
+			Expect(err).NotTo(HaveOccurred())
+			cfg.Mirroring.UsageLedger.ClusterID = "local"
+		})
+
+		recordUsage := func(cluster, tag string, lastUsed time.Time) {
+			Expect(registry.NewClient(nil, nil).RecordUsage(ctx, host+"/mirror/app:"+tag, cluster, lastUsed)).To(Succeed())
+		}
+
+		It("skips the deletion of a tag recently used by another cluster", func() {
+			recordUsage("remote", "1.0", time.Now().Add(-time.Hour))
+			Expect(cleanup(newImageSetMirror("ism", "app:1.0"))).To(BeTrue())
+			Expect(exists("1.0")).To(BeTrue())
+			Expect(recorder.Events).To(Receive(And(ContainSubstring("DeletionSkipped"), ContainSubstring("cluster remote"))))
+		})
+
+		It("deletes a tag whose usages by other clusters are stale, with the usage of this cluster", func() {
+			recordUsage("remote", "1.0", time.Now().Add(-2*cfg.Mirroring.UsageLedger.TTL))
+			recordUsage("local", "1.0", time.Now())
+			Expect(cleanup(newImageSetMirror("ism", "app:1.0"))).To(BeTrue())
+			Expect(exists("1.0")).To(BeFalse())
+
+			usages, err := registry.NewClient(nil, nil).ListUsages(ctx, host+"/mirror/app:latest")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(usages).To(ConsistOf(HaveField("Cluster", "remote")))
+		})
+
+		It("skips the deletion of a manifest recently used by another cluster when the registry cannot delete tags", func() {
+			tagDeletionAllowed = false
+			recordUsage("remote", "latest", time.Now())
+			Expect(cleanup(newImageSetMirror("ism", "app:1.0"))).To(BeTrue())
+			Expect(exists("1.0")).To(BeTrue())
+			Expect(recorder.Events).To(Receive(And(ContainSubstring("DeletionSkipped"), ContainSubstring("cluster remote"))))
+		})
+	})
+})
@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"iter"
 	"maps"
+	"net/http"
 	"path"
 	"slices"
 	"strings"
@@ -15,6 +17,7 @@ import (
 	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
 	"github.com/enix/kube-image-keeper/internal"
 	"github.com/enix/kube-image-keeper/internal/config"
+	"github.com/enix/kube-image-keeper/internal/copier"
 	"github.com/enix/kube-image-keeper/internal/filter"
 	"github.com/enix/kube-image-keeper/internal/registry"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
@@ -30,6 +33,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
@@ -61,9 +65,15 @@ type ImageSetMirrorBaseReconciler struct {
 	Scheme   *runtime.Scheme
 	Config   *config.Config
 	Recorder events.EventRecorder
+	// CopyPool runs the copies in the background. Without it, copies run
+	// inline during the reconciliation.
+	CopyPool *CopyPool
+	// BandwidthLimiter throttles the uploads of the copies to the mirrors.
+	BandwidthLimiter *registry.BandwidthLimiter
 
 	platforms       []v1.Platform
 	globalPodFilter filter.PodFilter
+	copyEvents      chan event.GenericEvent
 }
 
 // reconcile is the shared reconciliation loop for both mirror kinds. The
@@ -88,21 +98,65 @@ func (r *ImageSetMirrorBaseReconciler) reconcile(ctx context.Context, req ctrl.R
 
 	if !obj.GetDeletionTimestamp().IsZero() {
 		if controllerutil.ContainsFinalizer(obj, imageSetMirrorFinalizer) {
-			log.Info("deleting images from cache")
+			policy := spec.DeletionPolicy
+			if policy == "" {
+				policy = kuikv1alpha1.DeletionPolicyDelete
+			}
+			log.Info("deleting images from cache", "deletionPolicy", policy)
+
+			// The mirrors deleted in this pass must not keep each other from being deleted, only the retained ones do
+			retainedObj := obj.DeepCopyObject().(MirrorObject)
+			retainedStatus := retainedObj.MirrorStatus()
+			retainedStatus.MatchingImages = slices.DeleteFunc(retainedStatus.MatchingImages, func(matchingImage kuikv1alpha1.MatchingImage) bool {
+				return !policy.Retains(matchingImage.UnusedSince == nil)
+			})
+			if !policy.Retains(false) {
+				retainedStatus.PrefetchedImages = nil
+			}
 
-			for _, matchingImages := range status.MatchingImages {
-				for _, mirror := range matchingImages.Mirrors {
+			deleted, retained := 0, 0
+			cleanupMirrors := func(mirrors []kuikv1alpha1.MirrorStatus, inUse bool) error {
+				for _, mirror := range mirrors {
 					cleanupLog := log.WithValues("image", mirror.Image)
 					if mirror.MirroredAt.IsZero() {
 						cleanupLog.V(1).Info("image not mirrored yet, skipping deletion")
 						continue
 					}
+					if policy.Retains(inUse) {
+						cleanupLog.V(1).Info("retaining image according to the deletion policy")
+						retained++
+						continue
+					}
 					cleanupLog.V(1).Info("deleting image")
-					if !r.cleanupMirror(logf.IntoContext(ctx, cleanupLog), mirror.Image, namespace, spec.Mirrors) {
-						return ctrl.Result{}, errors.New("could not cleanup mirrors")
+					if !r.cleanupMirror(logf.IntoContext(ctx, cleanupLog), retainedObj, mirror.Image) {
+						r.Recorder.Eventf(obj, nil, corev1.EventTypeWarning, "CleanupFailed", "Delete", "could not delete %s from its mirror", mirror.Image)
+						return errors.New("could not cleanup mirrors")
 					}
+					deleted++
 				}
+				return nil
+			}
+			for _, matchingImage := range status.MatchingImages {
+				if err := cleanupMirrors(matchingImage.Mirrors, matchingImage.UnusedSince == nil); err != nil {
+					return ctrl.Result{}, err
+				}
+			}
+			// Prefetched images are not used by any pod yet
+			for _, prefetchedImage := range status.PrefetchedImages {
+				if err := cleanupMirrors(prefetchedImage.Mirrors, false); err != nil {
+					return ctrl.Result{}, err
+				}
+			}
+			if deleted > 0 {
+				r.Recorder.Eventf(obj, nil, corev1.EventTypeNormal, "ImagesDeleted", "Delete", "%d mirrored image(s) deleted according to the %s deletion policy", deleted, policy)
 			}
+			if retained > 0 {
+				r.Recorder.Eventf(obj, nil, corev1.EventTypeNormal, "ImagesRetained", "Delete", "%d mirrored image(s) retained according to the %s deletion policy", retained, policy)
+			}
+			// No copy is run during this reconciliation, so every copy of obj is forgotten
+			r.newCopies(obj).forgetUnseen()
+			storageBytes.DeleteLabelValues(namespace, obj.GetName())
+			unprotectedImages.DeleteLabelValues(namespace, obj.GetName())
 
 			log.Info("removing finalizer")
 			err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
@@ -124,18 +178,20 @@ func (r *ImageSetMirrorBaseReconciler) reconcile(ctx context.Context, req ctrl.R
 	if err := r.List(ctx, &pods, &client.ListOptions{Namespace: namespace}); err != nil {
 		return ctrl.Result{}, err
 	}
+	templatePods, err := listTemplatePods(ctx, r.Client, r.Config, namespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	// Template pods come first so that live pods, which carry the running digests, win when matching images.
+	pods.Items = append(templatePods, pods.Items...)
 
 	podMatcher, err := obj.PodMatcher()
 	if err != nil {
-		log.Error(err, "invalid filter; skipping reconcile until spec is fixed")
-		r.Recorder.Eventf(obj, nil, corev1.EventTypeWarning, "InvalidFilter", "ReconcileSkipped", "filter is invalid: %v", err)
-		return ctrl.Result{}, nil
+		return ctrl.Result{}, r.skipInvalidFilter(ctx, obj, err)
 	}
 	imageFilter, err := obj.ImageFilter()
 	if err != nil {
-		log.Error(err, "invalid filter; skipping reconcile until spec is fixed")
-		r.Recorder.Eventf(obj, nil, corev1.EventTypeWarning, "InvalidFilter", "ReconcileSkipped", "filter is invalid: %v", err)
-		return ctrl.Result{}, nil
+		return ctrl.Result{}, r.skipInvalidFilter(ctx, obj, err)
 	}
 	pods.Items = slices.DeleteFunc(pods.Items, func(p corev1.Pod) bool {
 		return !podMatcher(&p) || !r.globalPodFilter.Match(&p)
@@ -160,11 +216,16 @@ func (r *ImageSetMirrorBaseReconciler) reconcile(ctx context.Context, req ctrl.R
 		return ctrl.Result{}, err
 	}
 
+	staticImages := resolveStaticImages(ctx, r.Recorder, obj, spec.Images, func(repository string) ([]corev1.Secret, error) {
+		return r.getSourcePullSecrets(ctx, namespace, spec.SourceCredentials, nil, repository)
+	})
+
 	original := obj.DeepCopyObject().(client.Object)
-	podsByMatchingImages, err := mergePreviousAndCurrentMatchingImages(logf.IntoContext(ctx, log), pods.Items, obj, mirrorPrefixes, imageFilter)
+	podsByMatchingImages, err := mergePreviousAndCurrentMatchingImages(logf.IntoContext(ctx, log), pods.Items, obj, mirrorPrefixes, imageFilter, staticImages)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
+	r.syncPrefetchedImages(ctx, obj, podsByMatchingImages, imageFilter)
 
 	if err := r.Status().Patch(ctx, obj, client.MergeFrom(original)); err != nil {
 		return ctrl.Result{}, err
@@ -172,6 +233,11 @@ func (r *ImageSetMirrorBaseReconciler) reconcile(ctx context.Context, req ctrl.R
 
 	someDeletionFailed := false
 	requeueAfter := time.Duration(0)
+	// In dry run mode, the deletions are only planned in a report
+	var dryRunPlan *cleanupPlan
+	if r.cleanupDryRun(spec) {
+		dryRunPlan = newCleanupPlan()
+	}
 	matchingImagesAfterCleanup := []kuikv1alpha1.MatchingImage{}
 	for i := range status.MatchingImages {
 		matchingImage := &status.MatchingImages[i]
@@ -185,12 +251,21 @@ func (r *ImageSetMirrorBaseReconciler) reconcile(ctx context.Context, req ctrl.R
 		for j := range matchingImage.Mirrors {
 			mirror := &matchingImage.Mirrors[j]
 
-			cleanupEnabled := spec.Cleanup.Enabled
+			cleanupEnabled := spec.Cleanup.Enabled || dryRunPlan != nil
 			retentionDuration := spec.Cleanup.Retention.Duration // TODO: merge retention options
 			deleteAfter := retentionDuration - time.Since(matchingImage.UnusedSince.Time)
 			if !cleanupEnabled {
 				mirrorsAfterCleanup = append(mirrorsAfterCleanup, *mirror)
 				continue
+			} else if dryRunPlan != nil {
+				if mirror.MirroredAt != nil {
+					dryRunPlan.add(mirror.Image, kuikv1alpha1.CleanupReasonRetention, matchingImage.UnusedSince.Add(retentionDuration))
+				}
+				if deleteAfter > 0 && (requeueAfter == 0 || deleteAfter < requeueAfter) {
+					requeueAfter = deleteAfter
+				}
+				mirrorsAfterCleanup = append(mirrorsAfterCleanup, *mirror)
+				continue
 			} else if deleteAfter > 0 {
 				if requeueAfter == 0 || deleteAfter < requeueAfter {
 					requeueAfter = deleteAfter
@@ -202,7 +277,7 @@ func (r *ImageSetMirrorBaseReconciler) reconcile(ctx context.Context, req ctrl.R
 			cleanupLog := log.WithValues("image", mirror.Image)
 			cleanupLog.Info("image is unused for more than the retention duration, deleting it", "retentionDuration", retentionDuration)
 			if mirror.MirroredAt != nil {
-				if !r.cleanupMirror(logf.IntoContext(ctx, cleanupLog), mirror.Image, namespace, spec.Mirrors) {
+				if !r.cleanupMirror(logf.IntoContext(ctx, cleanupLog), obj, mirror.Image) {
 					mirrorsAfterCleanup = append(mirrorsAfterCleanup, *mirror)
 					someDeletionFailed = true
 				}
@@ -217,11 +292,22 @@ func (r *ImageSetMirrorBaseReconciler) reconcile(ctx context.Context, req ctrl.R
 
 	original = obj.DeepCopyObject().(client.Object)
 	status.MatchingImages = matchingImagesAfterCleanup
+	var capacityErr error
+	if dryRunPlan != nil {
+		capacityErr = r.planCapacityEvictions(ctx, obj, dryRunPlan)
+	} else {
+		var evictionFailed bool
+		evictionFailed, capacityErr = r.enforceCapacity(ctx, obj)
+		someDeletionFailed = someDeletionFailed || evictionFailed
+	}
 	if err := r.Status().Patch(ctx, obj, client.MergeFrom(original)); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	someMirrorFailed := false
+	// The copy runs on its own copy of the spec since obj is updated while it is running
+	copySpec := spec.DeepCopy()
+	copies := r.newCopies(obj)
+
 	for i := range status.MatchingImages {
 		matchingImage := &status.MatchingImages[i]
 		original = obj.DeepCopyObject().(client.Object)
@@ -230,38 +316,145 @@ func (r *ImageSetMirrorBaseReconciler) reconcile(ctx context.Context, req ctrl.R
 			continue
 		}
 
+		from := matchingImage.Image
 		for j := range matchingImage.Mirrors {
 			mirror := &matchingImage.Mirrors[j]
+			mirrorLog := log.WithValues("from", from, "to", mirror.Image)
 
-			if mirror.MirroredAt == nil {
-				mirrorLog := log.WithValues("from", matchingImage.Image, "to", mirror.Image)
-				mirrorLog.Info("mirroring image")
+			if after, parked := retryAfter(mirror, obj.GetGeneration()); parked {
+				mirrorLog.V(1).Info("image failed permanently, waiting for the spec to change", "error", mirror.LastError)
+				continue
+			} else if after > 0 {
+				if requeueAfter == 0 || after < requeueAfter {
+					requeueAfter = after
+				}
+				continue
+			}
 
-				err := r.mirrorImage(ctx, namespace, spec.Mirrors, podsByMatchingImages, matchingImage.Image, mirror)
+			if mirror.MirroredAt == nil {
+				mirrored := slices.Clone(matchingImage.Mirrors)
+				done, _, err := copies.run(logf.IntoContext(ctx, mirrorLog), from, mirror, func(ctx context.Context, mirror *kuikv1alpha1.MirrorStatus) (string, error) {
+					logf.FromContext(ctx).Info("mirroring image")
+					if err := r.mirrorImage(ctx, namespace, copySpec, podsByMatchingImages, from, mirror, mirrored); err != nil {
+						return "", err
+					}
+					r.markCopy(ctx, copies.owner, copySpec, mirror)
+					return "", nil
+				})
+				if !done {
+					if mirror.WaitingForWindowUntil == nil {
+						mirrorLog.V(1).Info("image is being mirrored")
+					}
+					continue
+				}
+				observeMirrorOperation(obj, mirrorOperationMirror, err)
+				nextAttemptAfter := recordOutcome(obj.GetGeneration(), spec.MinReplicas, matchingImage.Mirrors, mirror, err)
+				if nextAttemptAfter > 0 && (requeueAfter == 0 || nextAttemptAfter < requeueAfter) {
+					requeueAfter = nextAttemptAfter
+				}
 				if err != nil {
-					mirrorLog.Error(err, "could not mirror image")
-					someMirrorFailed = true
-					mirror.LastError = err.Error()
+					mirrorLog.Error(err, "could not mirror image", "attempts", mirror.Attempts, "retryAfter", nextAttemptAfter, "permanent", mirror.ParkedAtGeneration != 0)
 				} else {
 					mirrorLog.Info("successfully mirrored image")
-					mirror.LastError = ""
 				}
+				continue
+			}
+
+			resyncAfter, resyncEnabled, err := nextResync(&spec.Resync, matchingImage.Image, mirror)
+			if err != nil {
+				mirrorLog.Error(err, "invalid resync policy; skipping resync until spec is fixed")
+				continue
+			} else if !resyncEnabled {
+				continue
+			} else if resyncAfter > 0 {
+				if requeueAfter == 0 || resyncAfter < requeueAfter {
+					requeueAfter = resyncAfter
+				}
+				continue
+			}
+
+			done, drift, err := copies.run(logf.IntoContext(ctx, mirrorLog), from, mirror, func(ctx context.Context, mirror *kuikv1alpha1.MirrorStatus) (string, error) {
+				logf.FromContext(ctx).V(1).Info("checking mirror for drift")
+				drift, err := r.resyncImage(ctx, namespace, copySpec, podsByMatchingImages, from, mirror)
+				if err == nil && drift != "" {
+					r.markCopy(ctx, copies.owner, copySpec, mirror)
+				}
+				return drift, err
+			})
+			if !done {
+				if mirror.WaitingForWindowUntil == nil {
+					mirrorLog.V(1).Info("mirror is being resynced")
+				}
+				continue
+			}
+			observeMirrorOperation(obj, mirrorOperationResync, err)
+			if drift != "" {
+				mirrorLog.Info("mirror drifted from its source", "drift", drift)
+				r.Recorder.Eventf(obj, nil, corev1.EventTypeNormal, "DriftDetected", "Resync", "%s drifted from %s: %s", mirror.Image, matchingImage.Image, drift)
+				if registryName, _, err := internal.RegistryAndPathFromReference(matchingImage.Image); err == nil {
+					mirrorDriftsTotal.WithLabelValues(namespace, obj.GetName(), registryName).Inc()
+				}
+			}
+			nextAttemptAfter := recordOutcome(obj.GetGeneration(), spec.MinReplicas, matchingImage.Mirrors, mirror, err)
+			if err != nil {
+				mirrorLog.Error(err, "could not resync image", "attempts", mirror.Attempts, "retryAfter", nextAttemptAfter, "permanent", mirror.ParkedAtGeneration != 0)
+				if nextAttemptAfter > 0 && (requeueAfter == 0 || nextAttemptAfter < requeueAfter) {
+					requeueAfter = nextAttemptAfter
+				}
+				continue
+			}
+			if drift != "" {
+				mirrorLog.Info("successfully resynced image")
+			}
+			if requeueAfter == 0 || spec.Resync.GetInterval() < requeueAfter {
+				requeueAfter = spec.Resync.GetInterval()
 			}
 		}
 
 		if err := r.Status().Patch(ctx, obj, client.MergeFrom(original)); err != nil {
 			return ctrl.Result{}, err
 		}
+		copies.ack()
 	}
 
-	if someDeletionFailed {
-		return ctrl.Result{}, errors.New("one or more image(s) could not be deleted")
+	// Prefetched images come last so that they never delay the images in use
+	original = obj.DeepCopyObject().(client.Object)
+	prefetchRequeueAfter, somePrefetchDeletionFailed := r.reconcilePrefetchedImages(ctx, obj, podsByMatchingImages, copies, dryRunPlan)
+	someDeletionFailed = someDeletionFailed || somePrefetchDeletionFailed
+	status.CleanupReport = dryRunPlan.report()
+	copies.forgetUnseen()
+	sweepRequeueAfter := r.sweepOrphans(ctx, obj)
+	usageRequeueAfter := r.recordUsage(ctx, obj)
+	setFilterValidCondition(&status.Conditions, obj.GetGeneration(), nil)
+	setCredentialsResolvedCondition(&status.Conditions, obj.GetGeneration(), checkSecretsExist(ctx, r.Client, namespace, mirrorCredentialSecrets(spec)))
+	unprotected := updateReplicas(status, spec.MinReplicas)
+	setMirroringCompleteCondition(&status.Conditions, obj.GetGeneration(), status, spec.MinReplicas)
+	setCleanupHealthyCondition(&status.Conditions, obj.GetGeneration(), someDeletionFailed, capacityErr)
+	setReadyCondition(&status.Conditions, obj.GetGeneration(), mirrorConditionTypes...)
+	if err := r.Status().Patch(ctx, obj, client.MergeFrom(original)); err != nil {
+		return ctrl.Result{}, err
+	}
+	copies.ack()
+	if prefetchRequeueAfter > 0 && (requeueAfter == 0 || prefetchRequeueAfter < requeueAfter) {
+		requeueAfter = prefetchRequeueAfter
+	}
+	if sweepRequeueAfter > 0 && (requeueAfter == 0 || sweepRequeueAfter < requeueAfter) {
+		requeueAfter = sweepRequeueAfter
+	}
+	if usageRequeueAfter > 0 && (requeueAfter == 0 || usageRequeueAfter < requeueAfter) {
+		requeueAfter = usageRequeueAfter
+	}
+	storageBytes.WithLabelValues(namespace, obj.GetName()).Set(float64(trackedStorage(status)))
+	unprotectedImages.WithLabelValues(namespace, obj.GetName()).Set(float64(unprotected))
+	if windowRequeueAfter := copies.requeueAfter(); windowRequeueAfter > 0 && (requeueAfter == 0 || windowRequeueAfter < requeueAfter) {
+		requeueAfter = windowRequeueAfter
 	}
 
-	if someMirrorFailed {
-		return ctrl.Result{}, errors.New("one or more image(s) could not be mirrored")
+	if someDeletionFailed {
+		return ctrl.Result{}, errors.New("one or more image(s) could not be deleted")
 	}
 
+	// Failed copies are retried on their own backoff, or parked until the spec changes, as part of requeueAfter
 	if requeueAfter > 0 {
 		return ctrl.Result{RequeueAfter: requeueAfter}, nil
 	}
@@ -269,9 +462,21 @@ func (r *ImageSetMirrorBaseReconciler) reconcile(ctx context.Context, req ctrl.R
 	return ctrl.Result{}, nil
 }
 
+// skipInvalidFilter reports the invalid filter of obj, whose reconciliation is
+// skipped until its spec is fixed.
+func (r *ImageSetMirrorBaseReconciler) skipInvalidFilter(ctx context.Context, obj MirrorObject, err error) error {
+	logf.FromContext(ctx).Error(err, "invalid filter; skipping reconcile until spec is fixed")
+	r.Recorder.Eventf(obj, nil, corev1.EventTypeWarning, "InvalidFilter", "ReconcileSkipped", "filter is invalid: %v", err)
+
+	original := obj.DeepCopyObject().(client.Object)
+	setFilterValidCondition(&obj.MirrorStatus().Conditions, obj.GetGeneration(), err)
+	return r.Status().Patch(ctx, obj, client.MergeFrom(original))
+}
+
 // setupController wires the shared controller plumbing (rate limiter, generation
-// predicate, pod watch). The concrete reconciler supplies its kind name, an empty
-// object for the For() type, the pod mapper, and itself as the Reconciler.
+// predicate, pod, workload template and copy pool watches). The concrete
+// reconciler supplies its kind name, an empty object for the For() type, the pod
+// mapper, and itself as the Reconciler.
 func (r *ImageSetMirrorBaseReconciler) setupController(mgr ctrl.Manager, name string, obj client.Object, mapPod handler.TypedMapFunc[*corev1.Pod, reconcile.Request], rec reconcile.Reconciler) error {
 	r.setupPlatforms()
 	if err := r.setupGlobalPodFilter(); err != nil {
@@ -280,7 +485,8 @@ func (r *ImageSetMirrorBaseReconciler) setupController(mgr ctrl.Manager, name st
 	if r.Recorder == nil {
 		r.Recorder = mgr.GetEventRecorder(name)
 	}
-	return ctrl.NewControllerManagedBy(mgr).
+	r.copyEvents = make(chan event.GenericEvent)
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(obj).
 		Named(name).
 		WithOptions(controller.Options{
@@ -288,7 +494,8 @@ func (r *ImageSetMirrorBaseReconciler) setupController(mgr ctrl.Manager, name st
 		}).
 		WithEventFilter(predicate.GenerationChangedPredicate{}).
 		WatchesRawSource(source.TypedKind(mgr.GetCache(), &corev1.Pod{}, handler.TypedEnqueueRequestsFromMapFunc(mapPod))).
-		Complete(rec)
+		WatchesRawSource(source.Channel(r.copyEvents, &handler.EnqueueRequestForObject{}))
+	return watchWorkloadTemplates(b, r.Config, mapPod).Complete(rec)
 }
 
 // enqueueForPod is the shared pod-mapper body. The concrete reconciler supplies a
@@ -363,14 +570,20 @@ func (r *ImageSetMirrorBaseReconciler) setupGlobalPodFilter() error {
 }
 
 func (r *ImageSetMirrorBaseReconciler) setupPlatforms() {
-	r.platforms = make([]v1.Platform, len(r.Config.Mirroring.Platforms))
-	for i, p := range r.Config.Mirroring.Platforms {
-		r.platforms[i] = v1.Platform{
+	r.platforms = configuredPlatforms(r.Config)
+}
+
+// configuredPlatforms returns the platforms copied by the mirroring.
+func configuredPlatforms(cfg *config.Config) []v1.Platform {
+	platforms := make([]v1.Platform, len(cfg.Mirroring.Platforms))
+	for i, p := range cfg.Mirroring.Platforms {
+		platforms[i] = v1.Platform{
 			OS:           p.OS,
 			Architecture: p.Architecture,
 			Variant:      p.Variant,
 		}
 	}
+	return platforms
 }
 
 func (r *ImageSetMirrorBaseReconciler) getPullSecret(ctx context.Context, namespace, name string, secret *corev1.Secret) error {
@@ -381,16 +594,62 @@ func (r *ImageSetMirrorBaseReconciler) getPullSecret(ctx context.Context, namesp
 	return nil
 }
 
-func (r *ImageSetMirrorBaseReconciler) getPullSecretsFromPods(ctx context.Context, podsByMatchingImages map[string]*corev1.Pod, image string) ([]corev1.Secret, error) {
-	var secrets []corev1.Secret
+// getSourcePullSecrets returns the candidate secrets to pull image from its
+// source, in the order they must be tried: the source credentials of the mirror
+// resource, longest prefix first, then the imagePullSecrets of the pod using the
+// image and finally those of its ServiceAccount. Missing pod and ServiceAccount
+// secrets are skipped since they are not under the control of the mirror
+// resource, but a missing source credential is an error.
+func (r *ImageSetMirrorBaseReconciler) getSourcePullSecrets(ctx context.Context, namespace string, sourceCredentials kuikv1alpha1.SourceCredentials, podsByMatchingImages map[string]*corev1.Pod, image string) ([]corev1.Secret, error) {
+	log := logf.FromContext(ctx)
+	secrets := []corev1.Secret{}
+	seen := map[client.ObjectKey]struct{}{}
 
-	if pod, ok := podsByMatchingImages[image]; ok {
-		secrets = make([]corev1.Secret, len(pod.Spec.ImagePullSecrets))
+	addSecret := func(key client.ObjectKey) error {
+		if _, ok := seen[key]; ok {
+			return nil
+		}
+		seen[key] = struct{}{}
 
-		for i, imagePullSecret := range pod.Spec.ImagePullSecrets {
-			if err := r.getPullSecret(ctx, pod.Namespace, imagePullSecret.Name, &secrets[i]); err != nil {
-				return nil, err
-			}
+		secret := corev1.Secret{}
+		if err := r.getPullSecret(ctx, key.Namespace, key.Name, &secret); err != nil {
+			return err
+		}
+		secrets = append(secrets, secret)
+		return nil
+	}
+
+	for _, credentialSecret := range sourceCredentials.GetCredentialSecretsForImage(image) {
+		// This allows to use the same code for both ClusterImageSetMirror and ImageSetMirror
+		secretNamespace := namespace
+		if secretNamespace == "" {
+			secretNamespace = credentialSecret.Namespace
+		}
+		if err := addSecret(client.ObjectKey{Namespace: secretNamespace, Name: credentialSecret.Name}); err != nil {
+			return nil, err
+		}
+	}
+
+	pod, ok := podsByMatchingImages[image]
+	if !ok {
+		return secrets, nil
+	}
+
+	imagePullSecrets := slices.Clone(pod.Spec.ImagePullSecrets)
+	serviceAccountName := pod.Spec.ServiceAccountName
+	if serviceAccountName == "" {
+		serviceAccountName = "default"
+	}
+	serviceAccount := &corev1.ServiceAccount{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: pod.Namespace, Name: serviceAccountName}, serviceAccount); err != nil {
+		log.V(1).Info("could not read pod service account", "pod", klog.KObj(pod), "serviceAccount", serviceAccountName, "error", err)
+	} else {
+		imagePullSecrets = append(imagePullSecrets, serviceAccount.ImagePullSecrets...)
+	}
+
+	for _, imagePullSecret := range imagePullSecrets {
+		if err := addSecret(client.ObjectKey{Namespace: pod.Namespace, Name: imagePullSecret.Name}); err != nil {
+			log.V(1).Info("could not read image pull secret", "pod", klog.KObj(pod), "secret", imagePullSecret.Name, "error", err)
 		}
 	}
 
@@ -417,90 +676,273 @@ func (r *ImageSetMirrorBaseReconciler) getImageSecretFromMirrors(ctx context.Con
 	return secret, nil
 }
 
-func (r *ImageSetMirrorBaseReconciler) mirrorImage(ctx context.Context, namespace string, mirrors kuikv1alpha1.Mirrors, podsByMatchingImages map[string]*corev1.Pod, from string, to *kuikv1alpha1.MirrorStatus) (err error) {
-	srcSecrets, err := r.getPullSecretsFromPods(ctx, podsByMatchingImages, from)
+// getMirroringSecrets returns the secrets to pull from from and to push to to.
+func (r *ImageSetMirrorBaseReconciler) getMirroringSecrets(ctx context.Context, namespace string, spec *kuikv1alpha1.ImageSetMirrorBase, podsByMatchingImages map[string]*corev1.Pod, from, to string) (srcSecrets, destSecrets []corev1.Secret, err error) {
+	srcSecrets, err = r.getSourcePullSecrets(ctx, namespace, spec.SourceCredentials, podsByMatchingImages, from)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	destSecrets := make([]corev1.Secret, 1)
-	if secret, err := r.getImageSecretFromMirrors(ctx, to.Image, namespace, mirrors); err != nil {
-		return err
+	destSecrets = make([]corev1.Secret, 1)
+	if secret, err := r.getImageSecretFromMirrors(ctx, to, namespace, spec.Mirrors); err != nil {
+		return nil, nil, err
 	} else if secret != nil {
 		destSecrets[0] = *secret
 	}
 
+	return srcSecrets, destSecrets, nil
+}
+
+// mirrorImage copies from to the mirror to, from the first available of the
+// alternatives of from holding a digest known for it from the pod using it or
+// from the other mirrors of from, mirrored.
+func (r *ImageSetMirrorBaseReconciler) mirrorImage(ctx context.Context, namespace string, spec *kuikv1alpha1.ImageSetMirrorBase, podsByMatchingImages map[string]*corev1.Pod, from string, to *kuikv1alpha1.MirrorStatus, mirrored []kuikv1alpha1.MirrorStatus) (err error) {
+	srcSecrets, destSecrets, err := r.getMirroringSecrets(ctx, namespace, spec, podsByMatchingImages, from, to.Image)
+	if err != nil {
+		return err
+	}
+
 	defer func() {
 		if err != nil {
 			client := registry.NewClient(nil, nil).WithPullSecrets(destSecrets)
-			_, destErr := client.GetDescriptor(ctx, to.Image)
+			destDesc, destErr := client.GetDescriptor(ctx, to.Image)
 			if destErr == nil {
 				logf.FromContext(ctx).V(1).Info("could not mirror image, but the image seems to be already mirrored")
 				err = nil
 				now := metav1.NewTime(time.Now())
 				to.MirroredAt = &now
+				to.LastSyncedAt = &now
+				to.DestinationDigest = destDesc.Digest.String()
 			}
 		}
 	}()
 
-	client := registry.NewClient(nil, nil).WithPullSecrets(srcSecrets)
-	srcDesc, err := client.GetDescriptor(ctx, from)
+	// Copy the build the cluster actually runs rather than whatever the tag points to now: the tag may have
+	// moved since the pods started. The destination tag then points to that digest.
+	source := from
+	runningDigest := ""
+	pod := podsByMatchingImages[from]
+	if pod != nil {
+		if runningDigest = runningImageDigest(pod, from); runningDigest != "" {
+			if source, err = withDigest(from, runningDigest); err != nil {
+				return err
+			}
+			logf.FromContext(ctx).V(1).Info("mirroring the digest running in the cluster", "digest", runningDigest)
+		}
+	}
+
+	sourceDigest, digests := knownDigests(runningDigest, mirrored)
+	alternative, alternativeSecrets, err := r.alternativeSource(ctx, namespace, pod, from, to.Image, digests, srcSecrets)
 	if err != nil {
 		return err
+	} else if alternative != "" {
+		logf.FromContext(ctx).Info("mirroring from an alternative source", "source", alternative)
+		if err := r.copyImage(ctx, spec, alternativeSecrets, destSecrets, alternative, to); err != nil {
+			return err
+		}
+		// The mirror is synced with the original image, whatever the digest of the alternative
+		to.SourceDigest = sourceDigest
+		to.CopiedFrom = alternative
+		return nil
 	}
 
-	// FIXME: if a platform is added or removed, already mirrored images are not updated consequently
-	if err := client.WithTimeout(0).WithPullSecrets(destSecrets).CopyImage(ctx, srcDesc, to.Image, r.platforms); err != nil {
+	if err := r.copyImage(ctx, spec, srcSecrets, destSecrets, source, to); err != nil {
 		return err
 	}
+	to.CopiedFrom = ""
+	return nil
+}
 
-	now := metav1.NewTime(time.Now())
-	to.MirroredAt = &now
+// copyImage copies source to the mirror, in the manager or in a Job according
+// to the copy mode, and records the source and destination digests.
+func (r *ImageSetMirrorBaseReconciler) copyImage(ctx context.Context, spec *kuikv1alpha1.ImageSetMirrorBase, srcSecrets, destSecrets []corev1.Secret, source string, to *kuikv1alpha1.MirrorStatus) error {
+	var result *copier.Result
+	var err error
+	start := time.Now()
+	if spec.Copy.Mode == kuikv1alpha1.CopyModeJob {
+		result, err = r.copyImageInJob(ctx, &spec.Copy, srcSecrets, destSecrets, source, to.Image)
+	} else {
+		result, err = copier.Copy(ctx, srcSecrets, destSecrets, source, to.Image, r.platforms, spec.Copy.Referrers, r.BandwidthLimiter)
+	}
+	if err != nil {
+		return err
+	}
 
+	recordCopy(source, to, result, start)
 	return nil
 }
 
-func (r *ImageSetMirrorBaseReconciler) cleanupMirror(ctx context.Context, image, namespace string, mirrors kuikv1alpha1.Mirrors) (success bool) {
-	log := logf.FromContext(ctx)
+// recordCopy records into to the result of the copy of source started at
+// start, and observes it in the copy metrics.
+func recordCopy(source string, to *kuikv1alpha1.MirrorStatus, result *copier.Result, start time.Time) {
+	now := metav1.NewTime(time.Now())
+	duration := now.Sub(start)
+	to.MirroredAt = &now
+	to.LastSyncedAt = &now
+	to.SourceDigest = result.SourceDigest
+	to.DestinationDigest = result.DestinationDigest
+	to.Size = result.Size
+	to.Layers = result.Layers
+	to.CopiedBytes = result.UploadedBytes
+	to.Referrers = result.Referrers
+	to.CopyDuration = &metav1.Duration{Duration: duration.Round(time.Millisecond)}
+
+	sourceRegistry, _, sourceErr := internal.RegistryAndPathFromReference(source)
+	destinationRegistry, _, destinationErr := internal.RegistryAndPathFromReference(to.Image)
+	if sourceErr == nil && destinationErr == nil {
+		copyDurationSeconds.WithLabelValues(sourceRegistry, destinationRegistry).Observe(duration.Seconds())
+		copiedBytesTotal.WithLabelValues(sourceRegistry, destinationRegistry).Add(float64(result.UploadedBytes))
+	}
+}
 
-	secret, err := r.getImageSecretFromMirrors(ctx, image, namespace, mirrors)
+// resyncImage compares the current digests of the source tag and of the mirror
+// with the ones recorded at the last sync, and copies the source tag again when
+// either of them drifted. As when it is mirrored, an image running in the
+// cluster follows the digest its pods run rather than the tag, which may have
+// moved since they started: the mirror drifts when the pods run another digest.
+// A digest that was never recorded is not considered as a drift, it is recorded
+// as the reference for the next checks. It returns a description of the drift,
+// empty if the mirror is in sync.
+func (r *ImageSetMirrorBaseReconciler) resyncImage(ctx context.Context, namespace string, spec *kuikv1alpha1.ImageSetMirrorBase, podsByMatchingImages map[string]*corev1.Pod, from string, to *kuikv1alpha1.MirrorStatus) (drift string, err error) {
+	srcSecrets, destSecrets, err := r.getMirroringSecrets(ctx, namespace, spec, podsByMatchingImages, from, to.Image)
 	if err != nil {
-		log.Error(err, "could not read secret for image deletion")
-		return false
-	} else if secret == nil {
-		log.V(1).Info("no secret is configured for deleting image, ignoring")
-		return true
+		return "", err
+	}
+
+	source, sourceName, srcDigest := from, "source tag", ""
+	if pod := podsByMatchingImages[from]; pod != nil {
+		srcDigest = runningImageDigest(pod, from)
+	}
+	if srcDigest != "" {
+		if source, err = withDigest(from, srcDigest); err != nil {
+			return "", err
+		}
+		sourceName = "image running in the cluster"
+	} else {
+		srcDesc, _, err := registry.NewClient(nil, nil).WithPullSecrets(srcSecrets).ReadDescriptor(ctx, http.MethodHead, from)
+		if err != nil {
+			return "", err
+		}
+		srcDigest = srcDesc.Digest.String()
+	}
+
+	destDigest := ""
+	if destDesc, _, err := registry.NewClient(nil, nil).WithPullSecrets(destSecrets).ReadDescriptor(ctx, http.MethodHead, to.Image); err == nil {
+		destDigest = destDesc.Digest.String()
+	} else if !registry.ErrIsImageNotFound(err) {
+		return "", err
 	}
 
-	if err := registry.NewClient(nil, nil).WithPullSecrets([]corev1.Secret{*secret}).DeleteImage(ctx, image); err != nil {
-		log.Error(err, "could not delete image")
-		return false
+	switch {
+	case to.SourceDigest != "" && srcDigest != to.SourceDigest:
+		drift = fmt.Sprintf("%s moved from %s to %s", sourceName, to.SourceDigest, srcDigest)
+	case destDigest == "":
+		drift = "mirrored image is missing from the destination"
+	case to.DestinationDigest != "" && destDigest != to.DestinationDigest:
+		drift = fmt.Sprintf("mirrored image changed from %s to %s", to.DestinationDigest, destDigest)
 	}
 
-	return true
+	if drift == "" {
+		now := metav1.NewTime(time.Now())
+		to.LastSyncedAt = &now
+		to.SourceDigest = srcDigest
+		to.DestinationDigest = destDigest
+		return "", nil
+	}
+
+	return drift, r.copyImage(ctx, spec, srcSecrets, destSecrets, source, to)
+}
+
+// nextResync returns how long to wait before checking the mirror of image for
+// drift, and false if the resync policy does not apply to image.
+func nextResync(resync *kuikv1alpha1.Resync, image string, mirror *kuikv1alpha1.MirrorStatus) (time.Duration, bool, error) {
+	if match, err := resync.Matches(image); err != nil || !match {
+		return 0, false, err
+	}
+
+	lastSyncedAt := mirror.LastSyncedAt
+	if lastSyncedAt == nil {
+		lastSyncedAt = mirror.MirroredAt
+	}
+
+	return resync.GetInterval() - time.Since(lastSyncedAt.Time), true, nil
+}
+
+// runningImageDigest returns the digest of image as reported by the runtime in
+// the pod container statuses, or an empty string if no running container of
+// the pod uses image or if the runtime did not report a repository digest.
+func runningImageDigest(pod *corev1.Pod, image string) string {
+	containerImages := map[string]string{}
+	for _, container := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+		if named, err := reference.ParseNormalizedNamed(container.Image); err == nil {
+			containerImages[container.Name] = named.String()
+		}
+	}
+
+	for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+		if containerImages[status.Name] != image {
+			continue
+		}
+		// ImageID is either a repository digest (e.g. docker.io/library/nginx@sha256:...), possibly
+		// prefixed by docker-pullable://, or a bare image ID which is not a manifest digest.
+		_, digest, ok := strings.Cut(status.ImageID, "@")
+		if !ok {
+			continue
+		}
+		if _, err := v1.NewHash(digest); err == nil {
+			return digest
+		}
+	}
+
+	return ""
 }
 
-func mergePreviousAndCurrentMatchingImages(ctx context.Context, pods []corev1.Pod, obj MirrorObject, mirrorPrefixes map[string][]string, imageFilter filter.Filter) (map[string]*corev1.Pod, error) {
+// withDigest pins image, which may be tagged, to digest.
+func withDigest(image, digest string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", err
+	}
+	canonical, err := reference.ParseNormalizedNamed(reference.TrimNamed(named).String() + "@" + digest)
+	if err != nil {
+		return "", err
+	}
+	return canonical.String(), nil
+}
+
+// mergePreviousAndCurrentMatchingImages merges the images matching in pods and
+// the resolved static images of obj with the ones already in its status. Static
+// images bypass the image filter and are always considered in use.
+func mergePreviousAndCurrentMatchingImages(ctx context.Context, pods []corev1.Pod, obj MirrorObject, mirrorPrefixes map[string][]string, imageFilter filter.Filter, staticImages []string) (map[string]*corev1.Pod, error) {
+	log := logf.FromContext(ctx)
 	spec, status := obj.MirrorSpec(), obj.MirrorStatus()
 	podsByMatchingImages := podsByNormalizedMatchingImages(ctx, imageFilter, mirrorPrefixes, pods)
 
 	matchingImagesMap := map[string]kuikv1alpha1.MatchingImage{}
-	for matchingImage := range podsByMatchingImages {
-		mirrors := []kuikv1alpha1.MirrorStatus{}
-		for _, mirror := range spec.Mirrors {
-			matchingImageWithoutRegistry := strings.SplitN(matchingImage, "/", 2)[1]
-			mirrors = append(mirrors, kuikv1alpha1.MirrorStatus{
-				Image: path.Join(mirror.Registry, mirror.Path, matchingImageWithoutRegistry),
-			})
-		}
+	addMatchingImage := func(matchingImage string) {
 		matchingImagesMap[matchingImage] = kuikv1alpha1.MatchingImage{
 			Image:   matchingImage,
-			Mirrors: mirrors,
+			Mirrors: newMirrorStatuses(spec.Mirrors, matchingImage),
 		}
 	}
+	for matchingImage := range podsByMatchingImages {
+		addMatchingImage(matchingImage)
+	}
 
 	inUseImages := podsInUseImages(ctx, pods)
-	if err := updateUnusedSince(ctx, matchingImagesMap, inUseImages, status, imageFilter); err != nil {
+	relevantMirrorPrefixes := append(slices.Clone(mirrorPrefixes[""]), mirrorPrefixes[obj.GetNamespace()]...)
+	for _, image := range staticImages {
+		if slices.ContainsFunc(relevantMirrorPrefixes, func(mirrorPrefix string) bool {
+			return strings.HasPrefix(image, mirrorPrefix)
+		}) {
+			log.V(1).Info("filtering out static image to prevent mirror loop", "image", image)
+			continue
+		}
+		addMatchingImage(image)
+		inUseImages[image] = struct{}{}
+	}
+
+	if err := updateUnusedSince(ctx, matchingImagesMap, inUseImages, status, imageFilter, spec.Images); err != nil {
 		return nil, err
 	}
 
@@ -512,6 +954,19 @@ func mergePreviousAndCurrentMatchingImages(ctx context.Context, pods []corev1.Po
 	return podsByMatchingImages, nil
 }
 
+// newMirrorStatuses returns the status of the mirrors of image, which are not
+// mirrored yet.
+func newMirrorStatuses(mirrors kuikv1alpha1.Mirrors, image string) []kuikv1alpha1.MirrorStatus {
+	imageWithoutRegistry := strings.SplitN(image, "/", 2)[1]
+	statuses := []kuikv1alpha1.MirrorStatus{}
+	for _, mirror := range mirrors {
+		statuses = append(statuses, kuikv1alpha1.MirrorStatus{
+			Image: path.Join(mirror.Registry, mirror.Path, imageWithoutRegistry),
+		})
+	}
+	return statuses
+}
+
 func podsByNormalizedMatchingImages(ctx context.Context, filter filter.Filter, mirrorPrefixes map[string][]string, pods []corev1.Pod) map[string]*corev1.Pod {
 	log := logf.FromContext(ctx)
 
@@ -607,7 +1062,7 @@ func podsInUseImages(ctx context.Context, pods []corev1.Pod) map[string]struct{}
 	return inUse
 }
 
-func updateUnusedSince(ctx context.Context, matchingImagesMap map[string]kuikv1alpha1.MatchingImage, inUseImages map[string]struct{}, ismStatus *kuikv1alpha1.ImageSetMirrorStatus, imageFilter filter.Filter) error {
+func updateUnusedSince(ctx context.Context, matchingImagesMap map[string]kuikv1alpha1.MatchingImage, inUseImages map[string]struct{}, ismStatus *kuikv1alpha1.ImageSetMirrorStatus, imageFilter filter.Filter, staticImages kuikv1alpha1.StaticImages) error {
 	log := logf.FromContext(ctx)
 	unusedSinceNotMatching := metav1.Time{Time: (time.Time{}).Add(time.Hour)}
 
@@ -617,6 +1072,9 @@ func updateUnusedSince(ctx context.Context, matchingImagesMap map[string]kuikv1a
 		named, match, err := internal.NormalizeAndMatch(imageFilter, img.Image)
 		if err != nil {
 			return err
+		} else if staticImages.Matches(named.String()) {
+			// Static images are pinned, even when their tags could not be listed during this reconciliation.
+			img.UnusedSince = nil
 		} else if !match {
 			// The image isn't matching anymore, which is different from matching but stopped to be used in the cluster.
 			// Thus, we set UnusedSince to 0001-01-01 01:00:00 +0000 UTC to trigger instant expiry and deletion.
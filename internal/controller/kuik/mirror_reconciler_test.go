@@ -3,14 +3,23 @@ package kuik
 import (
 	"context"
 	"fmt"
+	"io"
+	"log"
+	"net/http/httptest"
+	"regexp"
 	"slices"
+	"strings"
 	"time"
 
 	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	"github.com/google/go-containerregistry/pkg/crane"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
@@ -104,7 +113,7 @@ var _ = Describe("Issue #567: rewritten pods keep the original image in use", fu
 			pods := []corev1.Pod{newRewrittenPod("pod-2")}
 			mirrorPrefixes := map[string][]string{"": {mirrorPrefix}}
 
-			_, err := mergePreviousAndCurrentMatchingImages(ctx, pods, obj, mirrorPrefixes, obj.Spec.ImageFilter.MustBuild())
+			_, err := mergePreviousAndCurrentMatchingImages(ctx, pods, obj, mirrorPrefixes, obj.Spec.ImageFilter.MustBuild(), nil)
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(obj.Status.MatchingImages).To(HaveLen(1))
@@ -133,10 +142,52 @@ var _ = Describe("Issue #567: rewritten pods keep the original image in use", fu
 			pods := []corev1.Pod{newRewrittenPod("pod-2")}
 			mirrorPrefixes := map[string][]string{"": {mirrorPrefix}}
 
-			_, err := mergePreviousAndCurrentMatchingImages(ctx, pods, obj, mirrorPrefixes, obj.Spec.ImageFilter.MustBuild())
+			_, err := mergePreviousAndCurrentMatchingImages(ctx, pods, obj, mirrorPrefixes, obj.Spec.ImageFilter.MustBuild(), nil)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(obj.Status.MatchingImages).To(BeEmpty())
 		})
+
+		It("mirrors static images without pods and keeps them in use", func() {
+			unusedSince := metav1.NewTime(time.Now().Add(-time.Minute))
+			obj := &kuikv1alpha1.ImageSetMirror{
+				Spec: kuikv1alpha1.ImageSetMirrorSpec{
+					ImageSetMirrorBase: kuikv1alpha1.ImageSetMirrorBase{
+						ImageFilter: kuikv1alpha1.ImageFilterDefinition{
+							Include: []string{`a\.example\.com/.*`},
+						},
+						Mirrors: kuikv1alpha1.Mirrors{
+							{Registry: "b.example.com"},
+						},
+						Images: kuikv1alpha1.StaticImages{
+							{Image: "c.example.com/static:1.0"},
+							{Image: "c.example.com/tagged", Tags: `1\..*`},
+							{Image: mirrorPrefix + "/loop:1.0"},
+						},
+					},
+				},
+				Status: kuikv1alpha1.ImageSetMirrorStatus{
+					MatchingImages: []kuikv1alpha1.MatchingImage{
+						{Image: "c.example.com/tagged:1.0", UnusedSince: &unusedSince},
+					},
+				},
+			}
+			mirrorPrefixes := map[string][]string{"": {mirrorPrefix}}
+			staticImages := []string{"c.example.com/static:1.0", mirrorPrefix + "/loop:1.0"}
+
+			_, err := mergePreviousAndCurrentMatchingImages(ctx, nil, obj, mirrorPrefixes, obj.Spec.ImageFilter.MustBuild(), staticImages)
+			Expect(err).NotTo(HaveOccurred())
+
+			images := map[string]kuikv1alpha1.MatchingImage{}
+			for _, image := range obj.Status.MatchingImages {
+				images[image.Image] = image
+			}
+			Expect(images).To(HaveLen(2), "static images under a mirror prefix must be filtered out")
+			Expect(images).To(HaveKey("c.example.com/static:1.0"))
+			Expect(images["c.example.com/static:1.0"].UnusedSince).To(BeNil())
+			Expect(images["c.example.com/static:1.0"].Mirrors).To(ConsistOf(kuikv1alpha1.MirrorStatus{Image: "b.example.com/static:1.0"}))
+			Expect(images["c.example.com/tagged:1.0"].UnusedSince).To(BeNil(),
+				"a static image must stay pinned when its tags could not be listed")
+		})
 	})
 })
 
@@ -224,6 +275,7 @@ var _ = Describe("Mirror reconcile skips on an invalid image filter", func() {
 		c := fake.NewClientBuilder().
 			WithScheme(scheme.Scheme).
 			WithObjects(obj).
+			WithStatusSubresource(obj).
 			Build()
 		base := ImageSetMirrorBaseReconciler{Client: c, Scheme: scheme.Scheme, Recorder: events.NewFakeRecorder(10)}
 		if _, ok := obj.(*kuikv1alpha1.ClusterImageSetMirror); ok {
@@ -232,8 +284,8 @@ var _ = Describe("Mirror reconcile skips on an invalid image filter", func() {
 		return &ImageSetMirrorReconciler{base}, c
 	}
 
-	DescribeTable("does not panic and leaves the object untouched",
-		func(obj client.Object) {
+	DescribeTable("does not panic, leaves the spec untouched and reports the invalid filter",
+		func(obj MirrorObject) {
 			r, c := newFakeReconciler(obj)
 			key := client.ObjectKeyFromObject(obj)
 
@@ -244,6 +296,13 @@ var _ = Describe("Mirror reconcile skips on an invalid image filter", func() {
 			Expect(c.Get(ctx, key, obj)).To(Succeed())
 			Expect(controllerutil.ContainsFinalizer(obj, imageSetMirrorFinalizer)).To(BeFalse(),
 				"reconcile must skip before any mutation when the filter is invalid")
+
+			filterValid := meta.FindStatusCondition(obj.MirrorStatus().Conditions, kuikv1alpha1.ConditionFilterValid)
+			Expect(filterValid).NotTo(BeNil())
+			Expect(filterValid.Status).To(Equal(metav1.ConditionFalse))
+			Expect(filterValid.Reason).To(Equal(reasonInvalidFilter))
+			Expect(filterValid.ObservedGeneration).To(Equal(obj.GetGeneration()))
+			Expect(meta.IsStatusConditionFalse(obj.MirrorStatus().Conditions, kuikv1alpha1.ConditionReady)).To(BeTrue())
 		},
 		Entry("ImageSetMirror", &kuikv1alpha1.ImageSetMirror{
 			ObjectMeta: metav1.ObjectMeta{Name: "ism-bad-filter", Namespace: "default"},
@@ -256,6 +315,337 @@ var _ = Describe("Mirror reconcile skips on an invalid image filter", func() {
 	)
 })
 
+// Source secrets are tried in order: explicit source credentials of the mirror
+// resource first, then the pod imagePullSecrets, then those of its
+// ServiceAccount. Pod and ServiceAccount secrets that cannot be read are skipped.
+var _ = Describe("Mirror source pull secrets", func() {
+	const image = "docker.io/enix/private:v1"
+	ctx := context.Background()
+
+	newSecret := func(name string) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+	}
+	secretNames := func(secrets []corev1.Secret) []string {
+		names := []string{}
+		for _, secret := range secrets {
+			names = append(names, secret.Name)
+		}
+		return names
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: corev1.PodSpec{
+			ServiceAccountName: "app",
+			ImagePullSecrets:   []corev1.LocalObjectReference{{Name: "pod"}, {Name: "missing"}, {Name: "shared"}},
+			Containers:         []corev1.Container{{Name: "app", Image: image}},
+		},
+	}
+	serviceAccount := &corev1.ServiceAccount{
+		ObjectMeta:       metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		ImagePullSecrets: []corev1.LocalObjectReference{{Name: "shared"}, {Name: "service-account"}},
+	}
+	sourceCredentials := kuikv1alpha1.SourceCredentials{
+		{Registry: "docker.io", CredentialSecret: kuikv1alpha1.CredentialSecret{Name: "registry"}},
+		{Registry: "docker.io", Path: "/enix", CredentialSecret: kuikv1alpha1.CredentialSecret{Name: "enix"}},
+		{Registry: "quay.io", CredentialSecret: kuikv1alpha1.CredentialSecret{Name: "quay"}},
+	}
+
+	newReconciler := func(objs ...client.Object) *ImageSetMirrorBaseReconciler {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objs...).Build()
+		return &ImageSetMirrorBaseReconciler{Client: c, Scheme: scheme.Scheme}
+	}
+
+	It("returns source credentials, pod and service account secrets in order", func() {
+		r := newReconciler(serviceAccount, newSecret("registry"), newSecret("enix"), newSecret("quay"),
+			newSecret("pod"), newSecret("shared"), newSecret("service-account"))
+
+		secrets, err := r.getSourcePullSecrets(ctx, "default", sourceCredentials, map[string]*corev1.Pod{image: pod}, image)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(secretNames(secrets)).To(Equal([]string{"enix", "registry", "pod", "shared", "service-account"}))
+	})
+
+	It("uses the source credentials alone when no pod matches the image", func() {
+		r := newReconciler(newSecret("registry"), newSecret("enix"))
+
+		secrets, err := r.getSourcePullSecrets(ctx, "default", sourceCredentials, nil, image)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(secretNames(secrets)).To(Equal([]string{"enix", "registry"}))
+	})
+
+	It("fails when a source credential secret is missing", func() {
+		r := newReconciler(newSecret("registry"))
+
+		_, err := r.getSourcePullSecrets(ctx, "default", sourceCredentials, nil, image)
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("reads source credentials from their own namespace for cluster-scoped resources", func() {
+		secret := newSecret("registry")
+		secret.Namespace = "kuik-system"
+		r := newReconciler(secret)
+
+		clusterSourceCredentials := kuikv1alpha1.SourceCredentials{
+			{Registry: "docker.io", CredentialSecret: kuikv1alpha1.CredentialSecret{Name: "registry", Namespace: "kuik-system"}},
+		}
+		secrets, err := r.getSourcePullSecrets(ctx, "", clusterSourceCredentials, nil, image)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(secretNames(secrets)).To(Equal([]string{"registry"}))
+	})
+})
+
+// The mirror controller copies the digest the pods are running, as reported by
+// the runtime in the container statuses, rather than the current tag target.
+var _ = Describe("Mirror running digest", func() {
+	const (
+		image  = "docker.io/library/nginx:1.25"
+		digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	)
+
+	newPod := func(imageID string) *corev1.Pod {
+		return &corev1.Pod{
+			Spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{{Name: "init", Image: "busybox"}},
+				Containers:     []corev1.Container{{Name: "app", Image: "nginx:1.25"}},
+			},
+			Status: corev1.PodStatus{
+				InitContainerStatuses: []corev1.ContainerStatus{{Name: "init", ImageID: "docker.io/library/busybox@sha256:fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"}},
+				ContainerStatuses:     []corev1.ContainerStatus{{Name: "app", ImageID: imageID}},
+			},
+		}
+	}
+
+	DescribeTable("runningImageDigest",
+		func(imageID, expected string) {
+			Expect(runningImageDigest(newPod(imageID), image)).To(Equal(expected))
+		},
+		Entry("containerd repository digest", "docker.io/library/nginx@"+digest, digest),
+		Entry("docker pullable repository digest", "docker-pullable://nginx@"+digest, digest),
+		Entry("bare image ID", digest, ""),
+		Entry("container not started yet", "", ""),
+	)
+
+	It("ignores containers running other images", func() {
+		Expect(runningImageDigest(newPod("docker.io/library/nginx@"+digest), "docker.io/library/redis:7")).To(BeEmpty())
+	})
+
+	It("pins a tagged image to a digest", func() {
+		Expect(withDigest(image, digest)).To(Equal("docker.io/library/nginx@" + digest))
+		_, err := withDigest(image, "sha256:invalid")
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+// Mirrors whose resync policy applies are compared with their source on an
+// interval and copied again when the source tag, or the digest running in the
+// cluster, moved or the mirror changed.
+var _ = Describe("Mirror resync", func() {
+	ctx := context.Background()
+	platform := v1.Platform{OS: "linux", Architecture: "amd64"}
+
+	var (
+		server   *httptest.Server
+		from, to string
+		r        *ImageSetMirrorBaseReconciler
+		spec     *kuikv1alpha1.ImageSetMirrorBase
+	)
+
+	BeforeEach(func() {
+		server = httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+		host := strings.TrimPrefix(server.URL, "http://")
+		from, to = host+"/src/app:latest", host+"/mirror/src/app:latest"
+
+		r = &ImageSetMirrorBaseReconciler{
+			Client:    fake.NewClientBuilder().WithScheme(scheme.Scheme).Build(),
+			Scheme:    scheme.Scheme,
+			platforms: []v1.Platform{platform},
+		}
+		spec = &kuikv1alpha1.ImageSetMirrorBase{Resync: kuikv1alpha1.Resync{Policy: kuikv1alpha1.ResyncPolicyInterval}}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("records the digests and reports no drift while in sync", func() {
+		sourceDigest := pushRandomImage(platform, from)
+		mirror := &kuikv1alpha1.MirrorStatus{Image: to}
+		Expect(r.mirrorImage(ctx, "", spec, nil, from, mirror, nil)).To(Succeed())
+		Expect(mirror.SourceDigest).To(Equal(sourceDigest))
+		Expect(mirror.DestinationDigest).To(Equal(sourceDigest))
+		Expect(mirror.LastSyncedAt).NotTo(BeNil())
+
+		lastSyncedAt := mirror.LastSyncedAt.DeepCopy()
+		drift, err := r.resyncImage(ctx, "", spec, nil, from, mirror)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drift).To(BeEmpty())
+		Expect(mirror.LastSyncedAt.Before(lastSyncedAt)).To(BeFalse())
+	})
+
+	It("copies the source again when the source tag moved", func() {
+		pushRandomImage(platform, from)
+		mirror := &kuikv1alpha1.MirrorStatus{Image: to}
+		Expect(r.mirrorImage(ctx, "", spec, nil, from, mirror, nil)).To(Succeed())
+
+		movedDigest := pushRandomImage(platform, from)
+		drift, err := r.resyncImage(ctx, "", spec, nil, from, mirror)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drift).To(ContainSubstring("source tag moved"))
+		Expect(mirror.SourceDigest).To(Equal(movedDigest))
+		Expect(mirror.DestinationDigest).To(Equal(movedDigest))
+
+		digest, err := crane.Digest(to)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(digest).To(Equal(movedDigest))
+	})
+
+	It("follows the digest running in the cluster rather than the source tag", func() {
+		newPod := func(digest string) map[string]*corev1.Pod {
+			return map[string]*corev1.Pod{from: {
+				Spec:   corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: from}}},
+				Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{Name: "app", ImageID: strings.TrimSuffix(from, ":latest") + "@" + digest}}},
+			}}
+		}
+		runningDigest := pushRandomImage(platform, from)
+		mirror := &kuikv1alpha1.MirrorStatus{Image: to}
+		Expect(r.mirrorImage(ctx, "", spec, newPod(runningDigest), from, mirror, nil)).To(Succeed())
+
+		By("keeping the mirror on the running digest when the source tag moved")
+		pushRandomImage(platform, from)
+		drift, err := r.resyncImage(ctx, "", spec, newPod(runningDigest), from, mirror)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drift).To(BeEmpty())
+		Expect(mirror.SourceDigest).To(Equal(runningDigest))
+		digest, err := crane.Digest(to)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(digest).To(Equal(runningDigest))
+
+		By("copying the new running digest once the pods run it")
+		newDigest := pushRandomImage(platform, from)
+		drift, err = r.resyncImage(ctx, "", spec, newPod(newDigest), from, mirror)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drift).To(ContainSubstring("image running in the cluster moved"))
+		Expect(mirror.SourceDigest).To(Equal(newDigest))
+		digest, err = crane.Digest(to)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(digest).To(Equal(newDigest))
+	})
+
+	It("copies the source again when the mirror was overwritten", func() {
+		sourceDigest := pushRandomImage(platform, from)
+		mirror := &kuikv1alpha1.MirrorStatus{Image: to}
+		Expect(r.mirrorImage(ctx, "", spec, nil, from, mirror, nil)).To(Succeed())
+
+		pushRandomImage(platform, to)
+		drift, err := r.resyncImage(ctx, "", spec, nil, from, mirror)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drift).To(ContainSubstring("mirrored image changed"))
+		Expect(mirror.DestinationDigest).To(Equal(sourceDigest))
+	})
+
+	It("schedules the next check relative to the last sync", func() {
+		lastSyncedAt := metav1.NewTime(time.Now().Add(-45 * time.Minute))
+		mirror := &kuikv1alpha1.MirrorStatus{Image: to, MirroredAt: &lastSyncedAt}
+
+		after, enabled, err := nextResync(&spec.Resync, from, mirror)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(enabled).To(BeTrue())
+		Expect(after).To(BeNumerically("~", 15*time.Minute, time.Minute))
+
+		_, enabled, err = nextResync(&kuikv1alpha1.Resync{}, from, mirror)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(enabled).To(BeFalse())
+	})
+})
+
+// When the original image is not available, the mirror controller copies it
+// from the first of its alternatives holding a digest known for it, in the
+// order the webhook routes pods to them.
+var _ = Describe("Mirror alternative source", func() {
+	ctx := context.Background()
+	platform := v1.Platform{OS: "linux", Architecture: "amd64"}
+
+	var (
+		server                 *httptest.Server
+		from, mirror1, mirror2 string
+		r                      *ImageSetMirrorBaseReconciler
+		spec                   *kuikv1alpha1.ImageSetMirrorBase
+	)
+
+	BeforeEach(func() {
+		server = httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+		host := strings.TrimPrefix(server.URL, "http://")
+		from, mirror1, mirror2 = host+"/src/app:latest", host+"/mirror1/src/app:latest", host+"/mirror2/src/app:latest"
+
+		ism := &kuikv1alpha1.ImageSetMirror{
+			ObjectMeta: metav1.ObjectMeta{Name: "ism", Namespace: "default"},
+			Spec: kuikv1alpha1.ImageSetMirrorSpec{
+				ImageSetMirrorBase: kuikv1alpha1.ImageSetMirrorBase{
+					Mirrors: kuikv1alpha1.Mirrors{{Registry: host, Path: "mirror1"}, {Registry: host, Path: "mirror2"}},
+				},
+				Filter: kuikv1alpha1.Filter{Include: []kuikv1alpha1.FilterItem{{Image: regexp.QuoteMeta(host) + "/src/.*"}}},
+			},
+		}
+		r = &ImageSetMirrorBaseReconciler{
+			Client:    fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(ism).Build(),
+			Scheme:    scheme.Scheme,
+			platforms: []v1.Platform{platform},
+		}
+		spec = &ism.Spec.ImageSetMirrorBase
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	mirroredTo := func(image, digest string) []kuikv1alpha1.MirrorStatus {
+		syncedAt := metav1.Now()
+		return []kuikv1alpha1.MirrorStatus{
+			{Image: image, SourceDigest: digest, DestinationDigest: digest, MirroredAt: &syncedAt, LastSyncedAt: &syncedAt},
+			{Image: mirror2},
+		}
+	}
+
+	It("copies from the original image when it is available", func() {
+		digest := pushRandomImage(platform, from, mirror1)
+		mirror := &kuikv1alpha1.MirrorStatus{Image: mirror2, CopiedFrom: "stale"}
+		Expect(r.mirrorImage(ctx, "default", spec, nil, from, mirror, mirroredTo(mirror1, digest))).To(Succeed())
+		Expect(mirror.SourceDigest).To(Equal(digest))
+		Expect(mirror.CopiedFrom).To(BeEmpty())
+	})
+
+	It("copies from a mirror holding the known digest when the original image is not available", func() {
+		digest := pushRandomImage(platform, mirror1)
+		mirror := &kuikv1alpha1.MirrorStatus{Image: mirror2}
+		Expect(r.mirrorImage(ctx, "default", spec, nil, from, mirror, mirroredTo(mirror1, digest))).To(Succeed())
+		Expect(mirror.SourceDigest).To(Equal(digest))
+		Expect(mirror.DestinationDigest).To(Equal(digest))
+		Expect(mirror.CopiedFrom).To(Equal(strings.TrimSuffix(mirror1, ":latest") + "@" + digest))
+
+		copied, err := crane.Digest(mirror2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(copied).To(Equal(digest))
+	})
+
+	It("does not copy from a mirror holding another digest", func() {
+		digest := pushRandomImage(platform, mirror1)
+		pushRandomImage(platform, mirror1)
+		mirror := &kuikv1alpha1.MirrorStatus{Image: mirror2}
+		Expect(r.mirrorImage(ctx, "default", spec, nil, from, mirror, mirroredTo(mirror1, digest))).NotTo(Succeed())
+		Expect(mirror.MirroredAt).To(BeNil())
+
+		_, err := crane.Digest(mirror2)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("does not look for another source when no digest is known for the original image", func() {
+		pushRandomImage(platform, mirror1)
+		mirror := &kuikv1alpha1.MirrorStatus{Image: mirror2}
+		Expect(r.mirrorImage(ctx, "default", spec, nil, from, mirror, nil)).NotTo(Succeed())
+		Expect(mirror.MirroredAt).To(BeNil())
+	})
+})
+
 // The API server rejects setting both spec.filter and the deprecated
 // spec.imageFilter on the same resource (the documented mutual exclusion),
 // exercised through the real envtest client which enforces the CEL rule.
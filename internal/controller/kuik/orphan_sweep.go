@@ -0,0 +1,231 @@
+package kuik
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/distribution/reference"
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	"github.com/enix/kube-image-keeper/internal/registry"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// markCopy attaches a copy marker owned by obj to the image copied to to when
+// the orphan sweep of spec is enabled, so that it can be swept once it is not
+// tracked anymore. A missing marker only keeps the image from being swept, so
+// failures are logged and ignored.
+func (r *ImageSetMirrorBaseReconciler) markCopy(ctx context.Context, obj metav1.Object, spec *kuikv1alpha1.ImageSetMirrorBase, to *kuikv1alpha1.MirrorStatus) {
+	if !spec.OrphanSweep.Enabled {
+		return
+	}
+	log := logf.FromContext(ctx)
+
+	client, err := r.mirrorRegistryClient(ctx, obj, spec.Mirrors, to.Image)
+	if err != nil {
+		log.Error(err, "could not read secret for marking copied image")
+		return
+	}
+	if err := client.MarkCopy(ctx, to.Image, mirrorResourceName(obj)); err != nil {
+		log.Error(err, "could not mark copied image, it will never be swept")
+	}
+}
+
+// sweepOrphans looks in the mirrors of obj, when its orphan sweep is enabled
+// and due, for the tags marked as copied by obj that no mirror resource tracks
+// anymore. They are recorded in the status of obj, and deleted once their grace
+// period is over unless the sweep, or the cleanup of every mirror resource, is
+// in dry run mode. Sweep errors are recorded
+// in the status rather than failing the reconciliation. It returns when the
+// next sweep is due.
+func (r *ImageSetMirrorBaseReconciler) sweepOrphans(ctx context.Context, obj MirrorObject) (requeueAfter time.Duration) {
+	spec, status := obj.MirrorSpec(), obj.MirrorStatus()
+	sweep := &spec.OrphanSweep
+	if !sweep.Enabled {
+		status.OrphanSweep = nil
+		return 0
+	}
+
+	now := time.Now()
+	if status.OrphanSweep != nil && status.OrphanSweep.LastSweepTime != nil {
+		if nextSweep := status.OrphanSweep.LastSweepTime.Add(sweep.GetInterval()); now.Before(nextSweep) {
+			return nextSweep.Sub(now)
+		}
+	}
+
+	// The global cleanup dry run covers the deletions made during the life of a resource, orphans included. Only the
+	// deletion policy, applied when the resource is deleted, is not affected by it.
+	dryRun := sweep.DryRun || (r.Config != nil && r.Config.Mirroring.Cleanup.DryRun)
+	log := logf.FromContext(ctx).WithValues("dryRun", dryRun)
+	log.V(1).Info("sweeping orphaned images")
+
+	previousFoundAt := map[string]metav1.Time{}
+	if status.OrphanSweep != nil {
+		for _, orphan := range status.OrphanSweep.Orphans {
+			previousFoundAt[orphan.Image+"@"+orphan.Digest] = orphan.FoundAt
+		}
+	}
+
+	orphans, err := r.findOrphans(ctx, obj)
+	errs := []error{}
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	remaining := []kuikv1alpha1.Orphan{}
+	deleted := 0
+	for _, orphan := range orphans {
+		if foundAt, ok := previousFoundAt[orphan.Image+"@"+orphan.Digest]; ok {
+			orphan.FoundAt = foundAt
+		}
+		if dryRun || now.Sub(orphan.FoundAt.Time) < sweep.GetGracePeriod() {
+			remaining = append(remaining, orphan)
+			continue
+		}
+
+		cleanupLog := log.WithValues("image", orphan.Image)
+		cleanupLog.Info("image is orphaned since the end of its grace period, deleting it")
+		if r.cleanupMirror(logf.IntoContext(ctx, cleanupLog), obj, orphan.Image) {
+			deleted++
+		} else {
+			errs = append(errs, fmt.Errorf("could not delete orphaned image %s", orphan.Image))
+			remaining = append(remaining, orphan)
+		}
+	}
+
+	if dryRun && len(orphans) > 0 {
+		r.Recorder.Eventf(obj, nil, corev1.EventTypeNormal, "OrphansFound", "Sweep", "%d orphaned image(s) found in the mirrors, not deleted in dry run mode", len(orphans))
+	} else if deleted > 0 {
+		r.Recorder.Eventf(obj, nil, corev1.EventTypeNormal, "OrphansDeleted", "Sweep", "%d orphaned image(s) deleted from the mirrors", deleted)
+	}
+
+	sweptAt := metav1.NewTime(now)
+	status.OrphanSweep = &kuikv1alpha1.OrphanSweepStatus{
+		LastSweepTime: &sweptAt,
+		OrphanCount:   len(orphans),
+		Orphans:       remaining[:min(len(remaining), kuikv1alpha1.MaxOrphans)],
+	}
+	if err := errors.Join(errs...); err != nil {
+		log.Error(err, "orphan sweep failed")
+		status.OrphanSweep.LastError = err.Error()
+	}
+
+	return sweep.GetInterval()
+}
+
+// findOrphans lists the tags of the repositories under the mirror prefixes of
+// obj that are marked as copied by obj and tracked by no mirror resource,
+// sorted by image. Mirrors without credentials are not swept, as they are not
+// cleaned up either.
+func (r *ImageSetMirrorBaseReconciler) findOrphans(ctx context.Context, obj MirrorObject) ([]kuikv1alpha1.Orphan, error) {
+	spec := obj.MirrorSpec()
+	owner := mirrorResourceName(obj)
+	now := metav1.Now()
+
+	objects, err := r.mirrorObjects(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+	tracked := map[string]struct{}{}
+	for _, object := range objects {
+		for _, mirror := range statusMirrors(object.MirrorStatus()) {
+			if tag, ok := normalizedTag(mirror.Image); ok {
+				tracked[tag] = struct{}{}
+			}
+		}
+	}
+
+	orphans := []kuikv1alpha1.Orphan{}
+	errs := []error{}
+	swept := map[string]struct{}{}
+	for _, mirror := range spec.Mirrors {
+		prefix := mirror.Prefix()
+		if _, ok := swept[prefix]; ok {
+			continue
+		}
+		swept[prefix] = struct{}{}
+
+		secret, err := r.getImageSecretFromMirrors(ctx, prefix, obj.GetNamespace(), spec.Mirrors)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not read secret for %s: %w", prefix, err))
+			continue
+		} else if secret == nil {
+			continue
+		}
+		client := registry.NewClient(nil, nil).WithPullSecrets([]corev1.Secret{*secret})
+
+		repositories, err := client.ListRepositories(ctx, prefix)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not list the repositories of %s: %w", prefix, err))
+			continue
+		}
+		for _, repository := range repositories {
+			tags, err := client.ListTags(ctx, repository)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("could not list the tags of %s: %w", repository, err))
+				continue
+			}
+			for _, tag := range tags {
+				// Tags of the referrers tag schema and of the usage ledger hold markers
+				if strings.HasPrefix(tag, "sha256-") || strings.HasPrefix(tag, registry.UsageMarkerTagPrefix) {
+					continue
+				}
+				image := repository + ":" + tag
+				if normalized, ok := normalizedTag(image); !ok {
+					continue
+				} else if _, ok := tracked[normalized]; ok {
+					continue
+				}
+
+				orphan, err := orphanedCopy(ctx, client, image, owner)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("could not check %s: %w", image, err))
+				} else if orphan != nil {
+					orphan.FoundAt = now
+					orphans = append(orphans, *orphan)
+				}
+			}
+		}
+	}
+
+	slices.SortFunc(orphans, func(a, b kuikv1alpha1.Orphan) int {
+		return strings.Compare(a.Image, b.Image)
+	})
+	return orphans, errors.Join(errs...)
+}
+
+// orphanedCopy returns image as an orphan if it is marked as copied by owner,
+// nil otherwise.
+func orphanedCopy(ctx context.Context, client *registry.Client, image, owner string) (*kuikv1alpha1.Orphan, error) {
+	desc, _, err := client.ReadDescriptor(ctx, http.MethodHead, image)
+	if registry.ErrIsImageNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if marked, err := client.IsMarkedCopy(ctx, image, owner); err != nil || !marked {
+		return nil, err
+	}
+	return &kuikv1alpha1.Orphan{Image: image, Digest: desc.Digest.String()}, nil
+}
+
+// normalizedTag returns the normalized name and tag of image, and false if it
+// is not a tagged image reference.
+func normalizedTag(image string) (string, bool) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", false
+	}
+	tagged, ok := named.(reference.Tagged)
+	if !ok {
+		return "", false
+	}
+	return named.Name() + ":" + tagged.Tag(), true
+}
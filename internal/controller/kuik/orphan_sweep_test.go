@@ -0,0 +1,147 @@
+package kuik
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	"github.com/enix/kube-image-keeper/internal/config"
+	"github.com/google/go-containerregistry/pkg/crane"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Orphan sweep", func() {
+	ctx := context.Background()
+	mirroredAt := metav1.Now()
+
+	var (
+		server   *httptest.Server
+		host     string
+		ism      *kuikv1alpha1.ImageSetMirror
+		r        *ImageSetMirrorBaseReconciler
+		recorder *events.FakeRecorder
+	)
+
+	BeforeEach(func() {
+		server = httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+		host = strings.TrimPrefix(server.URL, "http://")
+
+		ism = &kuikv1alpha1.ImageSetMirror{
+			ObjectMeta: metav1.ObjectMeta{Name: "ism", Namespace: "default", UID: types.UID("ism")},
+			Spec: kuikv1alpha1.ImageSetMirrorSpec{ImageSetMirrorBase: kuikv1alpha1.ImageSetMirrorBase{
+				Mirrors:     kuikv1alpha1.Mirrors{{Registry: host, Path: "mirror", CredentialSecret: &kuikv1alpha1.CredentialSecret{Name: "mirror"}}},
+				OrphanSweep: kuikv1alpha1.OrphanSweep{Enabled: true},
+			}},
+		}
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "mirror", Namespace: "default"},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{}}`)},
+		}
+		recorder = events.NewFakeRecorder(10)
+		r = &ImageSetMirrorBaseReconciler{
+			Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(ism, secret).Build(),
+			Scheme:   scheme.Scheme,
+			Recorder: recorder,
+		}
+
+		// tracked and orphaned are copied by ism, unmarked is not, and shared is an unmarked tag of the manifest of tracked
+		for _, tag := range []string{"tracked", "orphaned", "unmarked"} {
+			image, err := random.Image(256, 1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(crane.Push(image, host+"/mirror/app:"+tag)).To(Succeed())
+			if tag != "unmarked" {
+				r.markCopy(ctx, ism, &ism.Spec.ImageSetMirrorBase, &kuikv1alpha1.MirrorStatus{Image: host + "/mirror/app:" + tag})
+			}
+		}
+		Expect(crane.Tag(host+"/mirror/app:tracked", "shared")).To(Succeed())
+		ism.Status.MatchingImages = []kuikv1alpha1.MatchingImage{{
+			Image:   "docker.io/library/app:tracked",
+			Mirrors: []kuikv1alpha1.MirrorStatus{{Image: host + "/mirror/app:tracked", MirroredAt: &mirroredAt}},
+		}}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	exists := func(tag string) bool {
+		_, err := crane.Head(host + "/mirror/app:" + tag)
+		return err == nil
+	}
+
+	orphanImages := func() []string {
+		images := []string{}
+		for _, orphan := range ism.Status.OrphanSweep.Orphans {
+			images = append(images, orphan.Image)
+		}
+		return images
+	}
+
+	It("deletes the orphaned copies once their grace period is over", func() {
+		Expect(r.sweepOrphans(ctx, ism)).To(Equal(kuikv1alpha1.DefaultOrphanSweepInterval))
+		Expect(ism.Status.OrphanSweep.LastError).To(BeEmpty())
+		Expect(ism.Status.OrphanSweep.OrphanCount).To(Equal(1))
+		Expect(orphanImages()).To(Equal([]string{host + "/mirror/app:orphaned"}))
+		Expect(exists("orphaned")).To(BeTrue())
+
+		Expect(r.sweepOrphans(ctx, ism)).To(BeNumerically("<=", kuikv1alpha1.DefaultOrphanSweepInterval))
+		Expect(exists("orphaned")).To(BeTrue(), "no sweep is run before the interval is over")
+
+		longAgo := metav1.NewTime(time.Now().Add(-2 * kuikv1alpha1.DefaultOrphanSweepInterval))
+		ism.Status.OrphanSweep.LastSweepTime = &longAgo
+		ism.Status.OrphanSweep.Orphans[0].FoundAt = longAgo
+		r.sweepOrphans(ctx, ism)
+		Expect(ism.Status.OrphanSweep.LastError).To(BeEmpty())
+		Expect(ism.Status.OrphanSweep.Orphans).To(BeEmpty())
+		Expect(exists("orphaned")).To(BeFalse())
+		Expect(exists("tracked")).To(BeTrue())
+		Expect(exists("unmarked")).To(BeTrue())
+		Expect(exists("shared")).To(BeTrue())
+		Expect(recorder.Events).To(Receive(ContainSubstring("OrphansDeleted")))
+	})
+
+	It("only reports the orphaned copies in dry run mode", func() {
+		ism.Spec.OrphanSweep.DryRun = true
+		longAgo := metav1.NewTime(time.Now().Add(-2 * kuikv1alpha1.DefaultOrphanSweepGracePeriod))
+		ism.Status.OrphanSweep = &kuikv1alpha1.OrphanSweepStatus{LastSweepTime: &longAgo}
+
+		r.sweepOrphans(ctx, ism)
+		Expect(orphanImages()).To(Equal([]string{host + "/mirror/app:orphaned"}))
+		Expect(exists("orphaned")).To(BeTrue())
+		Expect(recorder.Events).To(Receive(ContainSubstring("OrphansFound")))
+	})
+
+	It("does not delete the orphaned copies when the cleanup of every resource is in dry run mode", func() {
+		r.Config = &config.Config{Mirroring: config.Mirroring{Cleanup: config.Cleanup{DryRun: true}}}
+		r.sweepOrphans(ctx, ism)
+
+		longAgo := metav1.NewTime(time.Now().Add(-2 * kuikv1alpha1.DefaultOrphanSweepInterval))
+		ism.Status.OrphanSweep.LastSweepTime = &longAgo
+		ism.Status.OrphanSweep.Orphans[0].FoundAt = longAgo
+		r.sweepOrphans(ctx, ism)
+		Expect(orphanImages()).To(Equal([]string{host + "/mirror/app:orphaned"}))
+		Expect(exists("orphaned")).To(BeTrue())
+		Expect(recorder.Events).To(Receive(ContainSubstring("OrphansFound")))
+	})
+
+	It("forgets the sweep status once disabled", func() {
+		r.sweepOrphans(ctx, ism)
+		ism.Spec.OrphanSweep.Enabled = false
+		Expect(r.sweepOrphans(ctx, ism)).To(BeZero())
+		Expect(ism.Status.OrphanSweep).To(BeNil())
+	})
+})
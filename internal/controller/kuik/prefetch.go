@@ -0,0 +1,251 @@
+package kuik
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/distribution/reference"
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	"github.com/enix/kube-image-keeper/internal/filter"
+	"github.com/enix/kube-image-keeper/internal/registry"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// syncPrefetchedImages updates the prefetched images of obj with the newest tags
+// following the tags of its matching images in use, according to its prefetch
+// policy. Prefetched images that are not among the tags to prefetch anymore are
+// marked as unused, except those of the repositories whose tags could not be
+// listed. Prefetched images that became matching images hand their mirrors over
+// to them, so they are not copied again.
+func (r *ImageSetMirrorBaseReconciler) syncPrefetchedImages(ctx context.Context, obj MirrorObject, podsByMatchingImages map[string]*corev1.Pod, imageFilter filter.Filter) {
+	log := logf.FromContext(ctx)
+	spec, status := obj.MirrorSpec(), obj.MirrorStatus()
+	now := metav1.NewTime(time.Now())
+
+	matchingImages := map[string]*kuikv1alpha1.MatchingImage{}
+	for i := range status.MatchingImages {
+		matchingImages[status.MatchingImages[i].Image] = &status.MatchingImages[i]
+	}
+
+	// Tags to prefetch, keyed by prefetched image, with the matching image they are prefetched for as value
+	prefetch := map[string]string{}
+	listedTags := map[string][]string{}
+	unlistedRepositories := map[string]struct{}{}
+	for _, matchingImage := range status.MatchingImages {
+		if !spec.Prefetch.Enabled || matchingImage.UnusedSince != nil {
+			continue
+		}
+
+		named, err := reference.ParseNormalizedNamed(matchingImage.Image)
+		if err != nil {
+			continue
+		}
+		tagged, ok := named.(reference.Tagged)
+		if !ok {
+			continue
+		}
+
+		repository := named.Name()
+		if _, unlisted := unlistedRepositories[repository]; unlisted {
+			continue
+		}
+		tags, listed := listedTags[repository]
+		if !listed {
+			tags, err = r.listSourceTags(ctx, obj, podsByMatchingImages, matchingImage.Image, repository)
+			if err != nil {
+				log.Error(err, "could not list tags to prefetch", "repository", repository)
+				r.Recorder.Eventf(obj, nil, corev1.EventTypeWarning, "PrefetchFailed", "ListTags", "could not list the tags of %s: %v", repository, err)
+				unlistedRepositories[repository] = struct{}{}
+				continue
+			}
+			listedTags[repository] = tags
+		}
+
+		for _, tag := range spec.Prefetch.Tags(tagged.Tag(), tags) {
+			prefetchedImage, err := reference.WithTag(reference.TrimNamed(named), tag)
+			if err != nil {
+				continue
+			}
+			image := prefetchedImage.String()
+			if _, isMatching := matchingImages[image]; isMatching || !imageFilter.Match(image) {
+				continue
+			}
+			if _, ok := prefetch[image]; !ok {
+				prefetch[image] = matchingImage.Image
+			}
+		}
+	}
+
+	prefetchedImages := []kuikv1alpha1.PrefetchedImage{}
+	for _, prefetchedImage := range status.PrefetchedImages {
+		if matchingImage, isMatching := matchingImages[prefetchedImage.Image]; isMatching {
+			handOverMirrors(prefetchedImage.Mirrors, matchingImage.Mirrors)
+			log.V(1).Info("prefetched image is now a matching image", "image", prefetchedImage.Image)
+			continue
+		}
+
+		if prefetchedFor, ok := prefetch[prefetchedImage.Image]; ok {
+			delete(prefetch, prefetchedImage.Image)
+			prefetchedImage.For = prefetchedFor
+			prefetchedImage.UnusedSince = nil
+			prefetchedImage.Mirrors = mergeMirrors(prefetchedImage.Mirrors, newMirrorStatuses(spec.Mirrors, prefetchedImage.Image))
+		} else if named, err := reference.ParseNormalizedNamed(prefetchedImage.Image); err == nil && spec.Prefetch.Enabled {
+			if _, unlisted := unlistedRepositories[named.Name()]; !unlisted && prefetchedImage.UnusedSince == nil {
+				prefetchedImage.UnusedSince = &now
+				log.Info("image is not to be prefetched anymore, marking it as unused", "image", prefetchedImage.Image)
+			}
+		} else if prefetchedImage.UnusedSince == nil {
+			prefetchedImage.UnusedSince = &now
+			log.Info("prefetching is disabled, marking prefetched image as unused", "image", prefetchedImage.Image)
+		}
+
+		prefetchedImages = append(prefetchedImages, prefetchedImage)
+	}
+
+	for image, prefetchedFor := range prefetch {
+		log.Info("discovered new image to prefetch", "image", image, "for", prefetchedFor)
+		prefetchedImages = append(prefetchedImages, kuikv1alpha1.PrefetchedImage{
+			Image:   image,
+			For:     prefetchedFor,
+			Mirrors: newMirrorStatuses(spec.Mirrors, image),
+		})
+	}
+
+	status.PrefetchedImages = prefetchedImages
+}
+
+// listSourceTags lists the tags of repository with the source pull secrets of
+// matchingImage.
+func (r *ImageSetMirrorBaseReconciler) listSourceTags(ctx context.Context, obj MirrorObject, podsByMatchingImages map[string]*corev1.Pod, matchingImage, repository string) ([]string, error) {
+	secrets, err := r.getSourcePullSecrets(ctx, obj.GetNamespace(), obj.MirrorSpec().SourceCredentials, podsByMatchingImages, matchingImage)
+	if err != nil {
+		return nil, err
+	}
+	return registry.NewClient(nil, nil).WithPullSecrets(secrets).ListTags(ctx, repository)
+}
+
+// handOverMirrors copies the status of the prefetched mirrors to the mirrors of
+// the same image that are not mirrored yet.
+func handOverMirrors(prefetchedMirrors, mirrors []kuikv1alpha1.MirrorStatus) {
+	for i := range mirrors {
+		if mirrors[i].MirroredAt != nil {
+			continue
+		}
+		for _, prefetchedMirror := range prefetchedMirrors {
+			if prefetchedMirror.Image == mirrors[i].Image && prefetchedMirror.MirroredAt != nil {
+				mirrors[i] = prefetchedMirror
+			}
+		}
+	}
+}
+
+// reconcilePrefetchedImages mirrors the prefetched images in use and, when the
+// cleanup is enabled, deletes the mirrors of the ones unused for longer than the
+// prefetch retention. In dry run mode, their deletion is only added to
+// dryRunPlan. It returns when the
+// prefetched images must be reconciled again, and whether some of them could
+// not be deleted.
+func (r *ImageSetMirrorBaseReconciler) reconcilePrefetchedImages(ctx context.Context, obj MirrorObject, podsByMatchingImages map[string]*corev1.Pod, copies *copies, dryRunPlan *cleanupPlan) (requeueAfter time.Duration, someDeletionFailed bool) {
+	log := logf.FromContext(ctx)
+	namespace := obj.GetNamespace()
+	spec, status := obj.MirrorSpec(), obj.MirrorStatus()
+	retention := spec.Prefetch.Retention.Duration
+	copySpec := spec.DeepCopy()
+
+	prefetchedImages := []kuikv1alpha1.PrefetchedImage{}
+	for _, prefetchedImage := range status.PrefetchedImages {
+		if prefetchedImage.UnusedSince != nil {
+			if !spec.Cleanup.Enabled && dryRunPlan == nil {
+				prefetchedImages = append(prefetchedImages, prefetchedImage)
+				continue
+			}
+			deleteAfter := retention - time.Since(prefetchedImage.UnusedSince.Time)
+			if dryRunPlan != nil {
+				for _, mirror := range prefetchedImage.Mirrors {
+					if mirror.MirroredAt != nil {
+						dryRunPlan.add(mirror.Image, kuikv1alpha1.CleanupReasonRetention, prefetchedImage.UnusedSince.Add(retention))
+					}
+				}
+			}
+			if deleteAfter > 0 || dryRunPlan != nil {
+				if deleteAfter > 0 && (requeueAfter == 0 || deleteAfter < requeueAfter) {
+					requeueAfter = deleteAfter
+				}
+				prefetchedImages = append(prefetchedImages, prefetchedImage)
+				continue
+			}
+
+			mirrorsAfterCleanup := []kuikv1alpha1.MirrorStatus{}
+			for _, mirror := range prefetchedImage.Mirrors {
+				if mirror.MirroredAt == nil {
+					continue
+				}
+				cleanupLog := log.WithValues("image", mirror.Image)
+				cleanupLog.Info("prefetched image is unused for more than the prefetch retention duration, deleting it", "retentionDuration", retention)
+				if !r.cleanupMirror(logf.IntoContext(ctx, cleanupLog), obj, mirror.Image) {
+					mirrorsAfterCleanup = append(mirrorsAfterCleanup, mirror)
+					someDeletionFailed = true
+				}
+			}
+			if len(mirrorsAfterCleanup) > 0 {
+				prefetchedImage.Mirrors = mirrorsAfterCleanup
+				prefetchedImages = append(prefetchedImages, prefetchedImage)
+			}
+			continue
+		}
+
+		// Pull secrets of the pod using the image the tag is prefetched for
+		pods := map[string]*corev1.Pod{}
+		if pod, ok := podsByMatchingImages[prefetchedImage.For]; ok {
+			pods[prefetchedImage.Image] = pod
+		}
+
+		for i := range prefetchedImage.Mirrors {
+			mirror := &prefetchedImage.Mirrors[i]
+			if mirror.MirroredAt != nil {
+				continue
+			} else if after, parked := retryAfter(mirror, obj.GetGeneration()); parked {
+				continue
+			} else if after > 0 {
+				if requeueAfter == 0 || after < requeueAfter {
+					requeueAfter = after
+				}
+				continue
+			}
+
+			mirrorLog := log.WithValues("from", prefetchedImage.Image, "to", mirror.Image)
+			mirrored := slices.Clone(prefetchedImage.Mirrors)
+			done, _, err := copies.run(logf.IntoContext(ctx, mirrorLog), prefetchedImage.Image, mirror, func(ctx context.Context, mirror *kuikv1alpha1.MirrorStatus) (string, error) {
+				logf.FromContext(ctx).Info("prefetching image")
+				if err := r.mirrorImage(ctx, namespace, copySpec, pods, prefetchedImage.Image, mirror, mirrored); err != nil {
+					return "", err
+				}
+				r.markCopy(ctx, copies.owner, copySpec, mirror)
+				return "", nil
+			})
+			if !done {
+				if mirror.WaitingForWindowUntil == nil {
+					mirrorLog.V(1).Info("image is being prefetched")
+				}
+				continue
+			}
+			observeMirrorOperation(obj, mirrorOperationPrefetch, err)
+			nextAttemptAfter := recordOutcome(obj.GetGeneration(), spec.MinReplicas, prefetchedImage.Mirrors, mirror, err)
+			if nextAttemptAfter > 0 && (requeueAfter == 0 || nextAttemptAfter < requeueAfter) {
+				requeueAfter = nextAttemptAfter
+			}
+			if err != nil {
+				mirrorLog.Error(err, "could not prefetch image", "attempts", mirror.Attempts, "retryAfter", nextAttemptAfter, "permanent", mirror.ParkedAtGeneration != 0)
+			} else {
+				mirrorLog.Info("successfully prefetched image")
+			}
+		}
+		prefetchedImages = append(prefetchedImages, prefetchedImage)
+	}
+
+	status.PrefetchedImages = prefetchedImages
+	return requeueAfter, someDeletionFailed
+}
@@ -0,0 +1,177 @@
+package kuik
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	"github.com/google/go-containerregistry/pkg/crane"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Mirror prefetch", func() {
+	ctx := context.Background()
+	platform := v1.Platform{OS: "linux", Architecture: "amd64"}
+
+	var (
+		server   *httptest.Server
+		host     string
+		r        *ImageSetMirrorBaseReconciler
+		recorder *events.FakeRecorder
+		obj      *kuikv1alpha1.ImageSetMirror
+	)
+
+	pushTags := func(repository string, tags ...string) {
+		image, err := random.Image(256, 1)
+		Expect(err).NotTo(HaveOccurred())
+		image, err = mutate.ConfigFile(image, &v1.ConfigFile{OS: platform.OS, Architecture: platform.Architecture})
+		Expect(err).NotTo(HaveOccurred())
+		for _, tag := range tags {
+			Expect(crane.Push(image, host+"/"+repository+":"+tag)).To(Succeed())
+		}
+	}
+
+	matchingImage := func(image string) kuikv1alpha1.MatchingImage {
+		return kuikv1alpha1.MatchingImage{Image: image, Mirrors: newMirrorStatuses(obj.Spec.Mirrors, image)}
+	}
+
+	prefetchedImages := func() map[string]kuikv1alpha1.PrefetchedImage {
+		images := map[string]kuikv1alpha1.PrefetchedImage{}
+		for _, image := range obj.Status.PrefetchedImages {
+			images[image.Image] = image
+		}
+		return images
+	}
+
+	BeforeEach(func() {
+		server = httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+		host = strings.TrimPrefix(server.URL, "http://")
+
+		recorder = events.NewFakeRecorder(10)
+		r = &ImageSetMirrorBaseReconciler{
+			Client:    fake.NewClientBuilder().WithScheme(scheme.Scheme).Build(),
+			Scheme:    scheme.Scheme,
+			Recorder:  recorder,
+			platforms: []v1.Platform{platform},
+		}
+		obj = &kuikv1alpha1.ImageSetMirror{
+			Spec: kuikv1alpha1.ImageSetMirrorSpec{
+				ImageSetMirrorBase: kuikv1alpha1.ImageSetMirrorBase{
+					ImageFilter: kuikv1alpha1.ImageFilterDefinition{Include: []string{".*"}},
+					Mirrors:     kuikv1alpha1.Mirrors{{Registry: host, Path: "/mirror"}},
+					Prefetch:    kuikv1alpha1.Prefetch{Enabled: true, Count: 2},
+				},
+			},
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("prefetches the newest tags of the same minor version and hands them over once in use", func() {
+		pushTags("src/app", "1.27.0", "1.27.1", "1.27.2", "1.27.3", "1.28.0", "latest")
+		obj.Status.MatchingImages = []kuikv1alpha1.MatchingImage{matchingImage(host + "/src/app:1.27.1")}
+
+		r.syncPrefetchedImages(ctx, obj, nil, obj.Spec.ImageFilter.MustBuild())
+		Expect(prefetchedImages()).To(HaveLen(2))
+		Expect(prefetchedImages()).To(HaveKey(host + "/src/app:1.27.2"))
+		Expect(prefetchedImages()).To(HaveKey(host + "/src/app:1.27.3"))
+		Expect(prefetchedImages()[host+"/src/app:1.27.3"].For).To(Equal(host + "/src/app:1.27.1"))
+
+		requeueAfter, failed := r.reconcilePrefetchedImages(ctx, obj, nil, r.newCopies(obj), nil)
+		Expect(failed).To(BeFalse())
+		Expect(requeueAfter).To(BeZero())
+		Expect(prefetchedImages()[host+"/src/app:1.27.3"].Mirrors[0].MirroredAt).NotTo(BeNil())
+		_, err := crane.Digest(host + "/mirror/src/app:1.27.3")
+		Expect(err).NotTo(HaveOccurred())
+
+		By("keeping the tags that are not among the newest anymore while the cleanup is disabled")
+		pushTags("src/app", "1.27.4")
+		r.syncPrefetchedImages(ctx, obj, nil, obj.Spec.ImageFilter.MustBuild())
+		Expect(prefetchedImages()[host+"/src/app:1.27.2"].UnusedSince).NotTo(BeNil())
+		Expect(prefetchedImages()[host+"/src/app:1.27.4"].UnusedSince).To(BeNil())
+		_, failed = r.reconcilePrefetchedImages(ctx, obj, nil, r.newCopies(obj), nil)
+		Expect(failed).To(BeFalse())
+		Expect(prefetchedImages()).To(HaveKey(host + "/src/app:1.27.2"))
+		_, err = crane.Digest(host + "/mirror/src/app:1.27.2")
+		Expect(err).NotTo(HaveOccurred())
+
+		By("dropping them once the retention elapsed with the cleanup enabled")
+		obj.Spec.Cleanup.Enabled = true
+		_, failed = r.reconcilePrefetchedImages(ctx, obj, nil, r.newCopies(obj), nil)
+		Expect(failed).To(BeFalse())
+		Expect(prefetchedImages()).To(HaveLen(2))
+		Expect(prefetchedImages()).NotTo(HaveKey(host + "/src/app:1.27.2"))
+
+		By("handing the mirrors over to the matching image once the prefetched tag is in use")
+		obj.Status.MatchingImages = append(obj.Status.MatchingImages, matchingImage(host+"/src/app:1.27.3"))
+		r.syncPrefetchedImages(ctx, obj, nil, obj.Spec.ImageFilter.MustBuild())
+		Expect(prefetchedImages()).NotTo(HaveKey(host + "/src/app:1.27.3"))
+		Expect(obj.Status.MatchingImages[1].Mirrors[0].MirroredAt).NotTo(BeNil())
+	})
+
+	It("only plans the deletion of the unused prefetched images in dry run mode", func() {
+		obj.Namespace = "default"
+		obj.Spec.Mirrors[0].CredentialSecret = &kuikv1alpha1.CredentialSecret{Name: "mirror"}
+		r.Client = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "mirror", Namespace: "default"},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{}}`)},
+		}).Build()
+		pushTags("mirror/src/app", "1.27.2")
+		unusedSince := metav1.NewTime(time.Now().Add(-time.Hour))
+		mirroredAt := metav1.Now()
+		obj.Status.PrefetchedImages = []kuikv1alpha1.PrefetchedImage{{
+			Image:       host + "/src/app:1.27.2",
+			For:         host + "/src/app:1.27.1",
+			UnusedSince: &unusedSince,
+			Mirrors:     []kuikv1alpha1.MirrorStatus{{Image: host + "/mirror/src/app:1.27.2", MirroredAt: &mirroredAt}},
+		}}
+
+		plan := newCleanupPlan()
+		_, failed := r.reconcilePrefetchedImages(ctx, obj, nil, r.newCopies(obj), plan)
+		Expect(failed).To(BeFalse())
+		Expect(prefetchedImages()).To(HaveKey(host + "/src/app:1.27.2"))
+		_, err := crane.Digest(host + "/mirror/src/app:1.27.2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.report().Deletions).To(ConsistOf(kuikv1alpha1.PlannedDeletion{
+			Image:    host + "/mirror/src/app:1.27.2",
+			Reason:   kuikv1alpha1.CleanupReasonRetention,
+			DeleteAt: unusedSince,
+		}))
+	})
+
+	It("keeps the prefetched images of a repository whose tags cannot be listed", func() {
+		obj.Status.MatchingImages = []kuikv1alpha1.MatchingImage{matchingImage(host + "/missing/app:1.0.0")}
+		obj.Status.PrefetchedImages = []kuikv1alpha1.PrefetchedImage{{Image: host + "/missing/app:1.0.1", For: host + "/missing/app:1.0.0"}}
+
+		r.syncPrefetchedImages(ctx, obj, nil, obj.Spec.ImageFilter.MustBuild())
+		Expect(prefetchedImages()).To(HaveLen(1))
+		Expect(prefetchedImages()[host+"/missing/app:1.0.1"].UnusedSince).To(BeNil())
+		Eventually(recorder.Events).Should(Receive(ContainSubstring("PrefetchFailed")))
+	})
+
+	It("marks every prefetched image as unused when prefetching is disabled", func() {
+		obj.Spec.Prefetch.Enabled = false
+		obj.Status.MatchingImages = []kuikv1alpha1.MatchingImage{matchingImage(host + "/src/app:1.27.1")}
+		obj.Status.PrefetchedImages = []kuikv1alpha1.PrefetchedImage{{Image: host + "/src/app:1.27.2", For: host + "/src/app:1.27.1"}}
+
+		r.syncPrefetchedImages(ctx, obj, nil, obj.Spec.ImageFilter.MustBuild())
+		Expect(prefetchedImages()[host+"/src/app:1.27.2"].UnusedSince).NotTo(BeNil())
+	})
+})
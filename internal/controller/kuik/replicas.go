@@ -0,0 +1,44 @@
+package kuik
+
+import (
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+)
+
+// replicas returns the number of mirrors an image is copied to.
+func replicas(mirrors []kuikv1alpha1.MirrorStatus) int {
+	count := 0
+	for _, mirror := range mirrors {
+		if mirror.MirroredAt != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// isProtected reports whether an image copied to mirrors is protected, i.e.
+// copied to at least minReplicas of them. An image is never protected when
+// minReplicas is 0, every mirror being required.
+func isProtected(minReplicas int32, mirrors []kuikv1alpha1.MirrorStatus) bool {
+	return minReplicas > 0 && replicas(mirrors) >= int(minReplicas)
+}
+
+// updateReplicas records the number of mirrors each image of status is copied
+// to, and returns the number of images in use that are not protected by
+// minReplicas, 0 if it is not set.
+func updateReplicas(status *kuikv1alpha1.ImageSetMirrorStatus, minReplicas int32) (unprotected int) {
+	for i := range status.MatchingImages {
+		matchingImage := &status.MatchingImages[i]
+		matchingImage.Replicas = replicas(matchingImage.Mirrors)
+		if minReplicas > 0 && matchingImage.UnusedSince == nil && !isProtected(minReplicas, matchingImage.Mirrors) {
+			unprotected++
+		}
+	}
+	for i := range status.PrefetchedImages {
+		prefetchedImage := &status.PrefetchedImages[i]
+		prefetchedImage.Replicas = replicas(prefetchedImage.Mirrors)
+		if minReplicas > 0 && prefetchedImage.UnusedSince == nil && !isProtected(minReplicas, prefetchedImage.Mirrors) {
+			unprotected++
+		}
+	}
+	return unprotected
+}
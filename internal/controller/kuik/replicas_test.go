@@ -0,0 +1,38 @@
+package kuik
+
+import (
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// An image is protected once copied to minReplicas of its mirrors, the copies
+// to its other mirrors being best effort.
+var _ = Describe("Mirror replicas", func() {
+	mirroredAt := metav1.Now()
+
+	It("protects the images copied to minReplicas mirrors", func() {
+		Expect(isProtected(0, newMirrors(3))).To(BeFalse())
+		Expect(isProtected(2, newMirrors(1))).To(BeFalse())
+		Expect(isProtected(2, newMirrors(2))).To(BeTrue())
+		Expect(isProtected(4, newMirrors(3))).To(BeFalse())
+	})
+
+	It("records the replicas of the images and counts the images in use not protected", func() {
+		status := &kuikv1alpha1.ImageSetMirrorStatus{
+			MatchingImages: []kuikv1alpha1.MatchingImage{
+				{Image: "app:1", Mirrors: newMirrors(2)},
+				{Image: "app:2", Mirrors: newMirrors(1)},
+				{Image: "app:3", Mirrors: newMirrors(0), UnusedSince: &mirroredAt},
+			},
+			PrefetchedImages: []kuikv1alpha1.PrefetchedImage{{Image: "app:4", Mirrors: newMirrors(0)}},
+		}
+
+		Expect(updateReplicas(status, 2)).To(Equal(2))
+		Expect(status.MatchingImages[0].Replicas).To(Equal(2))
+		Expect(status.MatchingImages[1].Replicas).To(Equal(1))
+		Expect(status.PrefetchedImages[0].Replicas).To(BeZero())
+		Expect(updateReplicas(status, 0)).To(BeZero())
+	})
+})
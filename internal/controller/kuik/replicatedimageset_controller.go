@@ -0,0 +1,265 @@
+package kuik
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	"github.com/enix/kube-image-keeper/internal/config"
+	"github.com/enix/kube-image-keeper/internal/filter"
+	"github.com/enix/kube-image-keeper/internal/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// credentialsRecheckInterval is the delay after which the credentials of a
+// ReplicatedImageSet are checked again when some of them could not be resolved,
+// since the creation of the missing secrets does not trigger a reconciliation.
+const credentialsRecheckInterval = time.Minute
+
+// ReplicatedObject is the common interface implemented by *ReplicatedImageSet
+// and *ClusterReplicatedImageSet, so that both kinds are reconciled by
+// ReplicatedImageSetBaseReconciler.
+type ReplicatedObject interface {
+	client.Object
+	ReplicatedSpec() *kuikv1alpha1.ReplicatedImageSetBase
+	ReplicatedStatus() *kuikv1alpha1.ReplicatedImageSetStatus
+	PodMatcher() (func(pod *corev1.Pod) bool, error)
+}
+
+// ReplicatedImageSetBaseReconciler reports the state of the upstreams of
+// ReplicatedImageSets and ClusterReplicatedImageSets. Images are routed to
+// their upstreams by the pod webhook: this reconciler validates the upstreams,
+// probes their registries every Config.Routing.UpstreamProbe.Interval, counts
+// the images the matching pods pull from each of them and copies these images
+// to the upstreams with sync enabled.
+type ReplicatedImageSetBaseReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Config   *config.Config
+	Recorder events.EventRecorder
+	// BandwidthLimiter throttles the uploads of the copies to the upstreams with sync enabled.
+	BandwidthLimiter *registry.BandwidthLimiter
+	// CopyPool runs the copies to the upstreams with sync enabled in the
+	// background. Without it, copies run inline, as in unit tests.
+	CopyPool *CopyPool
+
+	platforms       []v1.Platform
+	globalPodFilter filter.PodFilter
+	copyEvents      chan event.GenericEvent
+	// ping checks that a registry is reachable, registry.Client.Ping by default.
+	ping func(ctx context.Context, registry string) error
+}
+
+func (r *ReplicatedImageSetBaseReconciler) reconcile(ctx context.Context, req ctrl.Request, obj ReplicatedObject) (ctrl.Result, error) {
+	log := logf.FromContext(ctx)
+
+	if err := r.Get(ctx, req.NamespacedName, obj); client.IgnoreNotFound(err) != nil {
+		return ctrl.Result{}, err
+	} else if err != nil || !obj.GetDeletionTimestamp().IsZero() {
+		// No copy is run for a deleted resource, so every copy of obj is forgotten
+		obj.SetName(req.Name)
+		obj.SetNamespace(req.Namespace)
+		r.newCopies(obj).forgetUnseen()
+		return ctrl.Result{}, nil
+	}
+
+	spec, status := obj.ReplicatedSpec(), obj.ReplicatedStatus()
+	original := obj.DeepCopyObject().(client.Object)
+
+	filterErrs := []error{}
+	podMatcher, err := obj.PodMatcher()
+	if err != nil {
+		filterErrs = append(filterErrs, err)
+	}
+
+	// Empty namespace (cluster-scoped objects) lists pods cluster-wide.
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods, &client.ListOptions{Namespace: obj.GetNamespace()}); err != nil {
+		return ctrl.Result{}, err
+	}
+	pods.Items = slices.DeleteFunc(pods.Items, func(p corev1.Pod) bool {
+		return podMatcher == nil || !podMatcher(&p) || !r.globalPodFilter.Match(&p)
+	})
+	images := map[string]struct{}{}
+	for i := range pods.Items {
+		for image := range normalizedImageNamesFromPod(&pods.Items[i]) {
+			images[image] = struct{}{}
+		}
+	}
+
+	now := time.Now()
+	probeInterval := r.Config.Routing.UpstreamProbe.Interval
+	nextProbe := probeInterval
+	probes := map[string]error{}
+	credentialErrs := []error{}
+	upstreams := make([]kuikv1alpha1.UpstreamStatus, len(spec.Upstreams))
+	imageFilters := make([]filter.Filter, len(spec.Upstreams))
+	invalidRewrite := false
+	for i := range spec.Upstreams {
+		upstream := &spec.Upstreams[i]
+		upstreamStatus := &upstreams[i]
+		if i < len(status.Upstreams) && status.Upstreams[i].Registry == upstream.Registry && status.Upstreams[i].Path == upstream.Path {
+			*upstreamStatus = status.Upstreams[i]
+		}
+		upstreamStatus.Registry = upstream.Registry
+		upstreamStatus.Path = upstream.Path
+
+		upstreamStatus.Error = ""
+		if imageFilters[i], err = compileUpstreamFilter(upstream); err != nil {
+			upstreamStatus.Error = err.Error()
+			filterErrs = append(filterErrs, fmt.Errorf("upstreams[%d]: %w", i, err))
+		}
+		invalidRewrite = invalidRewrite || upstream.Rewrite.Validate() != nil
+
+		upstreamStatus.CredentialSecretError = ""
+		if err := checkSecretsExist(ctx, r.Client, obj.GetNamespace(), []*kuikv1alpha1.CredentialSecret{upstream.CredentialSecret}); err != nil {
+			upstreamStatus.CredentialSecretError = err.Error()
+			credentialErrs = append(credentialErrs, fmt.Errorf("upstreams[%d]: %w", i, err))
+		}
+
+		upstreamStatus.RoutedImages = 0
+		for image := range images {
+			if strings.HasPrefix(image, upstream.Prefix()+"/") {
+				upstreamStatus.RoutedImages++
+			}
+		}
+
+		if upstream.DiscardAlternative {
+			upstreamStatus.Reachable, upstreamStatus.LastProbe, upstreamStatus.ProbeError = nil, nil, ""
+			continue
+		}
+		if upstreamStatus.LastProbe != nil {
+			if probeAfter := probeInterval - now.Sub(upstreamStatus.LastProbe.Time); probeAfter > 0 {
+				nextProbe = min(nextProbe, probeAfter)
+				continue
+			}
+		}
+
+		probeErr, probed := probes[upstream.Registry]
+		if !probed {
+			log.V(1).Info("probing upstream registry", "registry", upstream.Registry)
+			probeErr = r.ping(ctx, upstream.Registry)
+			probes[upstream.Registry] = probeErr
+		}
+		reachable := probeErr == nil
+		upstreamStatus.Reachable = &reachable
+		upstreamStatus.LastProbe = &metav1.Time{Time: now}
+		upstreamStatus.ProbeError = ""
+		if probeErr != nil {
+			upstreamStatus.ProbeError = probeErr.Error()
+		}
+	}
+	// Rewrite rules that do not compile are already reported by their upstream
+	if err := spec.ValidateRewrites(); err != nil && !invalidRewrite {
+		filterErrs = append(filterErrs, err)
+	}
+	copies := r.newCopies(obj)
+	syncRequeueAfter := r.syncUpstreams(ctx, obj, images, imageFilters, upstreams, copies)
+	copies.forgetUnseen()
+	status.Upstreams = upstreams
+
+	filterErr := errors.Join(filterErrs...)
+	if filterErr != nil {
+		log.Error(filterErr, "invalid filter; the invalid parts are ignored until spec is fixed")
+		r.Recorder.Eventf(obj, nil, corev1.EventTypeWarning, "InvalidFilter", "Validate", "filter is invalid: %v", filterErr)
+	}
+	setFilterValidCondition(&status.Conditions, obj.GetGeneration(), filterErr)
+	setCredentialsResolvedCondition(&status.Conditions, obj.GetGeneration(), errors.Join(credentialErrs...))
+	setReadyCondition(&status.Conditions, obj.GetGeneration(), kuikv1alpha1.ConditionFilterValid, kuikv1alpha1.ConditionCredentialsResolved)
+
+	if err := r.Status().Patch(ctx, obj, client.MergeFrom(original)); err != nil {
+		return ctrl.Result{}, err
+	}
+	copies.ack()
+
+	requeueAfter := nextProbe
+	if !meta.IsStatusConditionTrue(status.Conditions, kuikv1alpha1.ConditionCredentialsResolved) {
+		requeueAfter = min(requeueAfter, credentialsRecheckInterval)
+	}
+	if syncRequeueAfter > 0 {
+		requeueAfter = min(requeueAfter, syncRequeueAfter)
+	}
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// compileUpstreamFilter returns the image filter of upstream, or the error of
+// its image filter or of its rewrite rule, for which the pod webhook ignores the
+// upstream.
+func compileUpstreamFilter(upstream *kuikv1alpha1.ReplicatedUpstream) (filter.Filter, error) {
+	imageFilter, err := upstream.ImageFilter.BuildWithRegistry(upstream.Registry)
+	if err != nil {
+		return nil, err
+	}
+	if err := upstream.Rewrite.Validate(); err != nil {
+		return nil, err
+	}
+	return imageFilter, nil
+}
+
+// setupController sets up the controller of the kind of obj with the Manager.
+func (r *ReplicatedImageSetBaseReconciler) setupController(mgr ctrl.Manager, name string, obj client.Object, rec reconcile.Reconciler) error {
+	f, err := compileGlobalPodFilter(r.Config)
+	if err != nil {
+		return err
+	}
+	r.globalPodFilter = f
+	r.platforms = configuredPlatforms(r.Config)
+	if r.Recorder == nil {
+		r.Recorder = mgr.GetEventRecorder(name)
+	}
+	if r.ping == nil {
+		r.ping = registry.NewClient(nil, nil).WithTimeout(r.Config.Routing.UpstreamProbe.Timeout).Ping
+	}
+	r.copyEvents = make(chan event.GenericEvent)
+	return ctrl.NewControllerManagedBy(mgr).
+		For(obj).
+		Named(name).
+		WithEventFilter(predicate.GenerationChangedPredicate{}).
+		WatchesRawSource(source.Channel(r.copyEvents, &handler.EnqueueRequestForObject{})).
+		Complete(rec)
+}
+
+// ReplicatedImageSetReconciler reconciles a ReplicatedImageSet object.
+type ReplicatedImageSetReconciler struct {
+	ReplicatedImageSetBaseReconciler
+}
+
+func (r *ReplicatedImageSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	return r.reconcile(ctx, req, &kuikv1alpha1.ReplicatedImageSet{})
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ReplicatedImageSetReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return r.setupController(mgr, "kuik-replicatedimageset", &kuikv1alpha1.ReplicatedImageSet{}, r)
+}
+
+// ClusterReplicatedImageSetReconciler reconciles a ClusterReplicatedImageSet object.
+type ClusterReplicatedImageSetReconciler struct {
+	ReplicatedImageSetBaseReconciler
+}
+
+func (r *ClusterReplicatedImageSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	return r.reconcile(ctx, req, &kuikv1alpha1.ClusterReplicatedImageSet{})
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ClusterReplicatedImageSetReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return r.setupController(mgr, "kuik-clusterreplicatedimageset", &kuikv1alpha1.ClusterReplicatedImageSet{}, r)
+}
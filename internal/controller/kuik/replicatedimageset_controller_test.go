@@ -0,0 +1,431 @@
+package kuik
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	"github.com/enix/kube-image-keeper/internal/config"
+	"github.com/google/go-containerregistry/pkg/crane"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("ReplicatedImageSet conditions", func() {
+	ctx := context.Background()
+
+	newFakeReconciler := func(objs ...client.Object) (reconcile.Reconciler, client.Client) {
+		c := fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithObjects(objs...).
+			WithStatusSubresource(objs[0]).
+			Build()
+		base := ReplicatedImageSetBaseReconciler{
+			Client:   c,
+			Scheme:   scheme.Scheme,
+			Config:   &config.Config{Routing: config.Routing{UpstreamProbe: config.UpstreamProbe{Interval: 5 * time.Minute}}},
+			Recorder: events.NewFakeRecorder(10),
+			ping:     func(ctx context.Context, registry string) error { return nil },
+		}
+		if _, ok := objs[0].(*kuikv1alpha1.ClusterReplicatedImageSet); ok {
+			return &ClusterReplicatedImageSetReconciler{base}, c
+		}
+		return &ReplicatedImageSetReconciler{base}, c
+	}
+
+	reconcileConditions := func(objs ...client.Object) ([]metav1.Condition, reconcile.Result) {
+		r, c := newFakeReconciler(objs...)
+		obj := objs[0].(ReplicatedObject)
+		key := client.ObjectKeyFromObject(obj)
+
+		res, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Get(ctx, key, obj)).To(Succeed())
+		return obj.ReplicatedStatus().Conditions, res
+	}
+
+	upstreams := func(credentialSecret *kuikv1alpha1.CredentialSecret, imageFilter ...string) []kuikv1alpha1.ReplicatedUpstream {
+		return []kuikv1alpha1.ReplicatedUpstream{
+			{ImageReference: kuikv1alpha1.ImageReference{Registry: "docker.io"}, ImageFilter: kuikv1alpha1.ImageFilterDefinition{Include: imageFilter}},
+			{ImageReference: kuikv1alpha1.ImageReference{Registry: "mirror.gcr.io"}, CredentialSecret: credentialSecret},
+		}
+	}
+
+	It("is ready when the filters compile and the credential secrets exist", func() {
+		ris := &kuikv1alpha1.ReplicatedImageSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "ris", Namespace: "default", Generation: 3},
+			Spec: kuikv1alpha1.ReplicatedImageSetSpec{ReplicatedImageSetBase: kuikv1alpha1.ReplicatedImageSetBase{
+				// The namespace of the secret is ignored for namespaced resources
+				Upstreams: upstreams(&kuikv1alpha1.CredentialSecret{Name: "gcr", Namespace: "other"}, ".*"),
+			}},
+		}
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "gcr", Namespace: "default"}}
+
+		conditions, res := reconcileConditions(ris, secret)
+		Expect(res.RequeueAfter).To(Equal(5 * time.Minute))
+		for _, conditionType := range []string{kuikv1alpha1.ConditionFilterValid, kuikv1alpha1.ConditionCredentialsResolved, kuikv1alpha1.ConditionReady} {
+			condition := meta.FindStatusCondition(conditions, conditionType)
+			Expect(condition).NotTo(BeNil(), conditionType)
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue), conditionType)
+			Expect(condition.ObservedGeneration).To(BeEquivalentTo(3), conditionType)
+		}
+	})
+
+	It("reports an invalid upstream image filter", func() {
+		ris := &kuikv1alpha1.ReplicatedImageSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "ris", Namespace: "default"},
+			Spec: kuikv1alpha1.ReplicatedImageSetSpec{ReplicatedImageSetBase: kuikv1alpha1.ReplicatedImageSetBase{
+				Upstreams: upstreams(nil, "["),
+			}},
+		}
+
+		conditions, _ := reconcileConditions(ris)
+		filterValid := meta.FindStatusCondition(conditions, kuikv1alpha1.ConditionFilterValid)
+		Expect(filterValid.Status).To(Equal(metav1.ConditionFalse))
+		Expect(filterValid.Reason).To(Equal(reasonInvalidFilter))
+		Expect(filterValid.Message).To(ContainSubstring("upstreams[0]"))
+		Expect(meta.IsStatusConditionTrue(conditions, kuikv1alpha1.ConditionCredentialsResolved)).To(BeTrue())
+
+		ready := meta.FindStatusCondition(conditions, kuikv1alpha1.ConditionReady)
+		Expect(ready.Status).To(Equal(metav1.ConditionFalse))
+		Expect(ready.Reason).To(Equal(reasonInvalidFilter))
+	})
+
+	It("reports a missing credential secret and checks it again later", func() {
+		cris := &kuikv1alpha1.ClusterReplicatedImageSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "cris"},
+			Spec: kuikv1alpha1.ClusterReplicatedImageSetSpec{ReplicatedImageSetBase: kuikv1alpha1.ReplicatedImageSetBase{
+				Upstreams: upstreams(&kuikv1alpha1.CredentialSecret{Name: "gcr", Namespace: "kuik-system"}),
+			}},
+		}
+		// Same name, but not in the namespace of the credential secret
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "gcr", Namespace: "default"}}
+
+		conditions, res := reconcileConditions(cris, secret)
+		Expect(res.RequeueAfter).To(Equal(credentialsRecheckInterval))
+		Expect(meta.IsStatusConditionTrue(conditions, kuikv1alpha1.ConditionFilterValid)).To(BeTrue())
+
+		credentialsResolved := meta.FindStatusCondition(conditions, kuikv1alpha1.ConditionCredentialsResolved)
+		Expect(credentialsResolved.Status).To(Equal(metav1.ConditionFalse))
+		Expect(credentialsResolved.Reason).To(Equal(reasonSecretNotFound))
+
+		ready := meta.FindStatusCondition(conditions, kuikv1alpha1.ConditionReady)
+		Expect(ready.Status).To(Equal(metav1.ConditionFalse))
+		Expect(ready.Reason).To(Equal(reasonSecretNotFound))
+	})
+})
+
+var _ = Describe("Mirror conditions", func() {
+	now := metav1.Now()
+
+	DescribeTable("sets MirroringComplete from the mirrors of the images in use",
+		func(status kuikv1alpha1.ImageSetMirrorStatus, expectedStatus metav1.ConditionStatus, expectedReason string) {
+			conditions := []metav1.Condition{}
+			setMirroringCompleteCondition(&conditions, 1, &status, 0)
+			condition := meta.FindStatusCondition(conditions, kuikv1alpha1.ConditionMirroringComplete)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(expectedStatus))
+			Expect(condition.Reason).To(Equal(expectedReason))
+		},
+		Entry("without images", kuikv1alpha1.ImageSetMirrorStatus{}, metav1.ConditionTrue, reasonMirrored),
+		Entry("with every mirror copied", kuikv1alpha1.ImageSetMirrorStatus{
+			MatchingImages: []kuikv1alpha1.MatchingImage{{Image: "a", Mirrors: []kuikv1alpha1.MirrorStatus{{Image: "m/a", MirroredAt: &now}}}},
+		}, metav1.ConditionTrue, reasonMirrored),
+		Entry("ignoring the mirrors of unused images", kuikv1alpha1.ImageSetMirrorStatus{
+			MatchingImages: []kuikv1alpha1.MatchingImage{{Image: "a", UnusedSince: &now, Mirrors: []kuikv1alpha1.MirrorStatus{{Image: "m/a"}}}},
+		}, metav1.ConditionTrue, reasonMirrored),
+		Entry("with a pending mirror", kuikv1alpha1.ImageSetMirrorStatus{
+			MatchingImages: []kuikv1alpha1.MatchingImage{{Image: "a", Mirrors: []kuikv1alpha1.MirrorStatus{{Image: "m/a", MirroredAt: &now}, {Image: "n/a"}}}},
+		}, metav1.ConditionFalse, reasonMirroring),
+		Entry("with a prefetched image waiting for a copy window", kuikv1alpha1.ImageSetMirrorStatus{
+			PrefetchedImages: []kuikv1alpha1.PrefetchedImage{{Image: "a", Mirrors: []kuikv1alpha1.MirrorStatus{{Image: "m/a", WaitingForWindowUntil: &now}}}},
+		}, metav1.ConditionFalse, reasonWaitingForWindow),
+		Entry("with a failed mirror", kuikv1alpha1.ImageSetMirrorStatus{
+			MatchingImages: []kuikv1alpha1.MatchingImage{{Image: "a", Mirrors: []kuikv1alpha1.MirrorStatus{{Image: "m/a", MirroredAt: &now, LastError: "boom"}, {Image: "n/a"}}}},
+		}, metav1.ConditionFalse, reasonMirroringFailed),
+	)
+
+	It("does not fail MirroringComplete on the best effort mirrors of protected images", func() {
+		status := kuikv1alpha1.ImageSetMirrorStatus{
+			MatchingImages: []kuikv1alpha1.MatchingImage{{Image: "a", Mirrors: []kuikv1alpha1.MirrorStatus{{Image: "m/a", MirroredAt: &now}, {Image: "n/a", LastError: "boom"}}}},
+		}
+
+		conditions := []metav1.Condition{}
+		setMirroringCompleteCondition(&conditions, 1, &status, 1)
+		condition := meta.FindStatusCondition(conditions, kuikv1alpha1.ConditionMirroringComplete)
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		Expect(condition.Message).To(Equal("1 of 2 mirror(s) up to date, 1 best effort mirror(s) failed"))
+
+		setMirroringCompleteCondition(&conditions, 1, &status, 2)
+		Expect(meta.IsStatusConditionFalse(conditions, kuikv1alpha1.ConditionMirroringComplete)).To(BeTrue())
+	})
+
+	It("keeps the reason of the first unhealthy condition in Ready", func() {
+		conditions := []metav1.Condition{}
+		setFilterValidCondition(&conditions, 1, nil)
+		setCredentialsResolvedCondition(&conditions, 1, nil)
+		setMirroringCompleteCondition(&conditions, 1, &kuikv1alpha1.ImageSetMirrorStatus{}, 0)
+		setCleanupHealthyCondition(&conditions, 1, true, nil)
+
+		setReadyCondition(&conditions, 1, mirrorConditionTypes...)
+		ready := meta.FindStatusCondition(conditions, kuikv1alpha1.ConditionReady)
+		Expect(ready.Status).To(Equal(metav1.ConditionFalse))
+		Expect(ready.Reason).To(Equal(reasonCleanupFailed))
+
+		setCleanupHealthyCondition(&conditions, 2, false, nil)
+		setReadyCondition(&conditions, 2, mirrorConditionTypes...)
+		Expect(meta.IsStatusConditionTrue(conditions, kuikv1alpha1.ConditionReady)).To(BeTrue())
+	})
+})
+
+var _ = Describe("ReplicatedImageSet upstreams", func() {
+	ctx := context.Background()
+
+	var (
+		c      client.Client
+		r      *ReplicatedImageSetReconciler
+		pinged []string
+	)
+
+	newPod := func(name, namespace string, images ...string) *corev1.Pod {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+		for i, image := range images {
+			pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: fmt.Sprintf("c%d", i), Image: image})
+		}
+		return pod
+	}
+
+	BeforeEach(func() {
+		ris := &kuikv1alpha1.ReplicatedImageSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "ris", Namespace: "default"},
+			Spec: kuikv1alpha1.ReplicatedImageSetSpec{ReplicatedImageSetBase: kuikv1alpha1.ReplicatedImageSetBase{
+				Upstreams: []kuikv1alpha1.ReplicatedUpstream{
+					{ImageReference: kuikv1alpha1.ImageReference{Registry: "docker.io", Path: "library"}, ImageFilter: kuikv1alpha1.ImageFilterDefinition{Include: []string{".*"}}},
+					{ImageReference: kuikv1alpha1.ImageReference{Registry: "down.example.com", Path: "library"}},
+					{ImageReference: kuikv1alpha1.ImageReference{Registry: "down.example.com", Path: "other"}, Rewrite: &kuikv1alpha1.UpstreamRewrite{Match: "(", Replacement: "x"}},
+					{ImageReference: kuikv1alpha1.ImageReference{Registry: "gone.example.com"}, DiscardAlternative: true},
+				},
+			}},
+		}
+		objs := []client.Object{
+			ris,
+			newPod("nginx", "default", "nginx:1.27", "down.example.com/library/redis:7"),
+			newPod("nginx-2", "default", "docker.io/library/nginx:1.27", "docker.io/library/busybox:1.36"),
+			newPod("elsewhere", "other", "docker.io/library/postgres:16"),
+		}
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objs...).WithStatusSubresource(ris).Build()
+
+		pinged = nil
+		r = &ReplicatedImageSetReconciler{ReplicatedImageSetBaseReconciler{
+			Client:   c,
+			Scheme:   scheme.Scheme,
+			Config:   &config.Config{Routing: config.Routing{UpstreamProbe: config.UpstreamProbe{Interval: 5 * time.Minute}}},
+			Recorder: events.NewFakeRecorder(10),
+			ping: func(ctx context.Context, registry string) error {
+				pinged = append(pinged, registry)
+				if registry == "down.example.com" {
+					return errors.New("connection refused")
+				}
+				return nil
+			},
+		}}
+	})
+
+	reconcileUpstreams := func() []kuikv1alpha1.UpstreamStatus {
+		key := client.ObjectKey{Name: "ris", Namespace: "default"}
+		_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		ris := &kuikv1alpha1.ReplicatedImageSet{}
+		Expect(c.Get(ctx, key, ris)).To(Succeed())
+		return ris.Status.Upstreams
+	}
+
+	It("reports the validity, reachability and routed images of each upstream", func() {
+		upstreams := reconcileUpstreams()
+		Expect(upstreams).To(HaveLen(4))
+
+		Expect(upstreams[0].Registry).To(Equal("docker.io"))
+		Expect(upstreams[0].Error).To(BeEmpty())
+		Expect(upstreams[0].Reachable).To(HaveValue(BeTrue()))
+		Expect(upstreams[0].LastProbe).NotTo(BeNil())
+		Expect(upstreams[0].RoutedImages).To(Equal(2), "nginx:1.27 counts once, postgres is used out of scope")
+
+		Expect(upstreams[1].Reachable).To(HaveValue(BeFalse()))
+		Expect(upstreams[1].ProbeError).To(Equal("connection refused"))
+		Expect(upstreams[1].RoutedImages).To(Equal(1))
+
+		Expect(upstreams[2].Error).To(ContainSubstring("rewrite"))
+		Expect(upstreams[2].RoutedImages).To(BeZero())
+
+		Expect(upstreams[3].Reachable).To(BeNil(), "discarded upstreams are not probed")
+		Expect(upstreams[3].LastProbe).To(BeNil())
+
+		Expect(pinged).To(ConsistOf("docker.io", "down.example.com"), "registries are probed once per reconciliation")
+	})
+
+	It("reports the rewrite rules that do not capture the groups another upstream needs", func() {
+		key := client.ObjectKey{Name: "ris", Namespace: "default"}
+		ris := &kuikv1alpha1.ReplicatedImageSet{}
+		Expect(c.Get(ctx, key, ris)).To(Succeed())
+		ris.Spec.Upstreams[2].Rewrite = &kuikv1alpha1.UpstreamRewrite{Match: "(?P<name>.*)", Replacement: "${name}"}
+		Expect(c.Update(ctx, ris)).To(Succeed())
+
+		upstreams := reconcileUpstreams()
+		Expect(upstreams[2].Error).To(BeEmpty())
+		Expect(c.Get(ctx, key, ris)).To(Succeed())
+		filterValid := meta.FindStatusCondition(ris.Status.Conditions, kuikv1alpha1.ConditionFilterValid)
+		Expect(filterValid).NotTo(BeNil())
+		Expect(filterValid.Status).To(Equal(metav1.ConditionFalse))
+		Expect(filterValid.Message).To(ContainSubstring(`upstreams[0] needs group "repository" which is not captured by upstreams[2]`))
+	})
+
+	It("probes the registries again only once the probe interval elapsed", func() {
+		reconcileUpstreams()
+		pinged = nil
+		reconcileUpstreams()
+		Expect(pinged).To(BeEmpty())
+
+		r.Config.Routing.UpstreamProbe.Interval = time.Nanosecond
+		upstreams := reconcileUpstreams()
+		Expect(pinged).To(ConsistOf("docker.io", "down.example.com"))
+		Expect(upstreams[1].Reachable).To(HaveValue(BeFalse()))
+	})
+})
+
+var _ = Describe("ReplicatedImageSet sync", func() {
+	ctx := context.Background()
+	platform := v1.Platform{OS: "linux", Architecture: "amd64"}
+
+	var (
+		server   *httptest.Server
+		host     string
+		c        client.Client
+		r        *ReplicatedImageSetReconciler
+		recorder *events.FakeRecorder
+	)
+
+	BeforeEach(func() {
+		server = httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+		host = strings.TrimPrefix(server.URL, "http://")
+
+		ris := &kuikv1alpha1.ReplicatedImageSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "ris", Namespace: "default", Generation: 1},
+			Spec: kuikv1alpha1.ReplicatedImageSetSpec{ReplicatedImageSetBase: kuikv1alpha1.ReplicatedImageSetBase{
+				Upstreams: []kuikv1alpha1.ReplicatedUpstream{
+					{ImageReference: kuikv1alpha1.ImageReference{Registry: host, Path: "primary"}, ImageFilter: kuikv1alpha1.ImageFilterDefinition{Include: []string{".*"}}},
+					{ImageReference: kuikv1alpha1.ImageReference{Registry: host, Path: "secondary"}, ImageFilter: kuikv1alpha1.ImageFilterDefinition{Include: []string{".*"}}, Sync: true},
+					{ImageReference: kuikv1alpha1.ImageReference{Registry: host, Path: "readonly"}, ImageFilter: kuikv1alpha1.ImageFilterDefinition{Include: []string{".*"}}},
+				},
+			}},
+		}
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: host + "/primary/app:latest"}}},
+		}
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(ris, pod).WithStatusSubresource(ris).Build()
+
+		recorder = events.NewFakeRecorder(10)
+		r = &ReplicatedImageSetReconciler{ReplicatedImageSetBaseReconciler{
+			Client:    c,
+			Scheme:    scheme.Scheme,
+			Config:    &config.Config{Routing: config.Routing{UpstreamProbe: config.UpstreamProbe{Interval: 5 * time.Minute}}},
+			Recorder:  recorder,
+			platforms: []v1.Platform{platform},
+			ping:      func(ctx context.Context, registry string) error { return nil },
+		}}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	reconcileUpstreams := func() []kuikv1alpha1.UpstreamStatus {
+		key := client.ObjectKey{Name: "ris", Namespace: "default"}
+		_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		ris := &kuikv1alpha1.ReplicatedImageSet{}
+		Expect(c.Get(ctx, key, ris)).To(Succeed())
+		return ris.Status.Upstreams
+	}
+
+	It("copies the images in use to the upstreams with sync enabled only", func() {
+		digest := pushRandomImage(platform, host+"/primary/app:latest")
+
+		upstreams := reconcileUpstreams()
+		Expect(upstreams[0].SyncedImages).To(BeEmpty(), "images are not synced to the upstream they are pulled from")
+		Expect(upstreams[2].SyncedImages).To(BeEmpty())
+		Expect(upstreams[1].SyncedImages).To(HaveLen(1))
+		synced := upstreams[1].SyncedImages[0]
+		Expect(synced.Image).To(Equal(host + "/secondary/app:latest"))
+		Expect(synced.From).To(Equal(host + "/primary/app:latest"))
+		Expect(synced.LastError).To(BeEmpty())
+		Expect(synced.MirroredAt).NotTo(BeNil())
+		Expect(synced.SourceDigest).To(Equal(digest))
+		Expect(synced.DestinationDigest).To(Equal(digest))
+		Expect(recorder.Events).To(Receive(ContainSubstring("missing from the upstream")))
+
+		_, err := crane.Head(host + "/readonly/app:latest")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("copies the source again only when it moved", func() {
+		pushRandomImage(platform, host+"/primary/app:latest")
+		reconcileUpstreams()
+		Expect(recorder.Events).To(Receive())
+
+		upstreams := reconcileUpstreams()
+		Expect(recorder.Events).NotTo(Receive(), "the images are in sync")
+		Expect(upstreams[1].SyncedImages[0].LastSyncedAt).NotTo(BeNil())
+
+		movedDigest := pushRandomImage(platform, host+"/primary/app:latest")
+		upstreams = reconcileUpstreams()
+		Expect(recorder.Events).To(Receive(ContainSubstring("source tag moved")))
+		Expect(upstreams[1].SyncedImages[0].DestinationDigest).To(Equal(movedDigest))
+	})
+
+	It("reports the images that could not be synced", func() {
+		upstreams := reconcileUpstreams()
+		Expect(upstreams[1].SyncedImages).To(HaveLen(1))
+		Expect(upstreams[1].SyncedImages[0].LastError).NotTo(BeEmpty(), "the source image does not exist")
+		Expect(upstreams[1].SyncedImages[0].Attempts).To(Equal(1))
+
+		pushRandomImage(platform, host+"/primary/app:latest")
+		upstreams = reconcileUpstreams()
+		Expect(upstreams[1].SyncedImages[0].MirroredAt).To(BeNil(), "a missing source is not retried until the spec changes")
+		Expect(upstreams[1].SyncedImages[0].Attempts).To(Equal(1))
+	})
+
+	It("runs the copies in the copy pool", func() {
+		pool := NewCopyPool(config.Concurrency{MaxConcurrent: 1, PerSourceRegistry: 1, PerDestinationRegistry: 1})
+		defer pool.cancel()
+		copyEvents := make(chan event.GenericEvent, 1)
+		r.CopyPool, r.copyEvents = pool, copyEvents
+		digest := pushRandomImage(platform, host+"/primary/app:latest")
+
+		upstreams := reconcileUpstreams()
+		Expect(upstreams[1].SyncedImages).To(HaveLen(1))
+		Expect(upstreams[1].SyncedImages[0].MirroredAt).To(BeNil())
+
+		Eventually(copyEvents).Should(Receive(HaveField("Object.GetName()", "ris")))
+		upstreams = reconcileUpstreams()
+		Expect(upstreams[1].SyncedImages[0].MirroredAt).NotTo(BeNil())
+		Expect(upstreams[1].SyncedImages[0].DestinationDigest).To(Equal(digest))
+	})
+})
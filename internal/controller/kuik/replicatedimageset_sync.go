@@ -0,0 +1,220 @@
+package kuik
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	"github.com/enix/kube-image-keeper/internal/copier"
+	"github.com/enix/kube-image-keeper/internal/filter"
+	"github.com/enix/kube-image-keeper/internal/registry"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// syncUpstreams copies the images in use that are pulled from an upstream of obj
+// to every other valid upstream with sync enabled, and records the outcome in
+// the SyncedImages of the destination upstreams. imageFilters are the compiled
+// filters of the upstreams, nil for the invalid ones. Copies run in the copy
+// pool through copies, and failed ones are retried with the same backoff as
+// the copies to the mirrors. It returns when a failed copy must be retried, 0
+// if none must.
+func (r *ReplicatedImageSetBaseReconciler) syncUpstreams(ctx context.Context, obj ReplicatedObject, images map[string]struct{}, imageFilters []filter.Filter, upstreams []kuikv1alpha1.UpstreamStatus, copies *copies) (requeueAfter time.Duration) {
+	log := logf.FromContext(ctx)
+	namespace := obj.GetNamespace()
+	spec := obj.ReplicatedSpec()
+
+	// expected maps the images to sync to each upstream to the image they are
+	// copied from and to the index of its upstream.
+	type syncSource struct {
+		image    string
+		upstream int
+	}
+	expected := make([]map[string]syncSource, len(spec.Upstreams))
+	for i := range expected {
+		expected[i] = map[string]syncSource{}
+	}
+	for image := range images {
+		from := sourceUpstreamIndex(spec.Upstreams, imageFilters, image)
+		if from < 0 {
+			continue
+		}
+		for i := range spec.Upstreams {
+			upstream := &spec.Upstreams[i]
+			if i == from || !upstream.Sync || upstream.DiscardAlternative || imageFilters[i] == nil {
+				continue
+			}
+			dest, err := upstream.Translate(&spec.Upstreams[from], image)
+			if err != nil {
+				log.Error(err, "could not translate image for upstream sync", "image", image, "upstream", upstream.Prefix())
+				continue
+			}
+			expected[i][dest] = syncSource{image: image, upstream: from}
+		}
+	}
+
+	for i := range spec.Upstreams {
+		upstreamStatus := &upstreams[i]
+		upstreamStatus.SyncedImages = slices.DeleteFunc(upstreamStatus.SyncedImages, func(synced kuikv1alpha1.SyncedImage) bool {
+			return expected[i][synced.Image].image != synced.From
+		})
+		for dest, source := range expected[i] {
+			from := source.image
+			index := slices.IndexFunc(upstreamStatus.SyncedImages, func(synced kuikv1alpha1.SyncedImage) bool {
+				return synced.Image == dest
+			})
+			if index < 0 {
+				upstreamStatus.SyncedImages = append(upstreamStatus.SyncedImages, kuikv1alpha1.SyncedImage{
+					From:         from,
+					MirrorStatus: kuikv1alpha1.MirrorStatus{Image: dest},
+				})
+				index = len(upstreamStatus.SyncedImages) - 1
+			}
+			synced := &upstreamStatus.SyncedImages[index]
+			syncLog := log.WithValues("from", from, "to", dest)
+
+			if after, parked := retryAfter(&synced.MirrorStatus, obj.GetGeneration()); parked {
+				syncLog.V(1).Info("image failed permanently, waiting for the spec to change", "error", synced.LastError)
+				continue
+			} else if after > 0 {
+				if requeueAfter == 0 || after < requeueAfter {
+					requeueAfter = after
+				}
+				continue
+			}
+
+			// The copy runs on its own copy of the upstreams since obj is updated while it is running
+			fromUpstream, toUpstream := spec.Upstreams[source.upstream].DeepCopy(), spec.Upstreams[i].DeepCopy()
+			done, drift, err := copies.run(logf.IntoContext(ctx, syncLog), from, &synced.MirrorStatus, func(ctx context.Context, mirror *kuikv1alpha1.MirrorStatus) (string, error) {
+				return r.syncImage(ctx, namespace, fromUpstream, toUpstream, from, mirror)
+			})
+			if !done {
+				syncLog.V(1).Info("image is being synced")
+				continue
+			}
+			nextAttemptAfter := recordOutcome(obj.GetGeneration(), 0, nil, &synced.MirrorStatus, err)
+			if err != nil {
+				syncLog.Error(err, "could not sync image to upstream", "attempts", synced.Attempts, "retryAfter", nextAttemptAfter, "permanent", synced.ParkedAtGeneration != 0)
+				if nextAttemptAfter > 0 && (requeueAfter == 0 || nextAttemptAfter < requeueAfter) {
+					requeueAfter = nextAttemptAfter
+				}
+			} else if drift != "" {
+				r.Recorder.Eventf(obj, nil, corev1.EventTypeNormal, "DriftDetected", "Sync", "%s synced from %s: %s", dest, from, drift)
+			}
+		}
+		slices.SortFunc(upstreamStatus.SyncedImages, func(a, b kuikv1alpha1.SyncedImage) int {
+			return strings.Compare(a.Image, b.Image)
+		})
+	}
+
+	return requeueAfter
+}
+
+func (r *ReplicatedImageSetBaseReconciler) newCopies(obj ReplicatedObject) *copies {
+	return &copies{
+		pool:     r.CopyPool,
+		owner:    obj.DeepCopyObject().(client.Object),
+		ownerKey: replicatedResourceName(obj),
+		events:   r.copyEvents,
+		seen:     map[copyKey]struct{}{},
+	}
+}
+
+// replicatedResourceName returns the kind and the name of obj, with its
+// namespace for ReplicatedImageSets.
+func replicatedResourceName(obj ReplicatedObject) string {
+	if obj.GetNamespace() == "" {
+		return "ClusterReplicatedImageSet " + obj.GetName()
+	}
+	return "ReplicatedImageSet " + obj.GetNamespace() + "/" + obj.GetName()
+}
+
+// sourceUpstreamIndex returns the index of the first valid upstream image is
+// pulled from, or -1 if it is pulled from none of them.
+func sourceUpstreamIndex(upstreams []kuikv1alpha1.ReplicatedUpstream, imageFilters []filter.Filter, image string) int {
+	for i := range upstreams {
+		if imageFilters[i] != nil && imageFilters[i].Match(image) && upstreams[i].MatchesRewrite(image) {
+			return i
+		}
+	}
+	return -1
+}
+
+// syncImage copies from, pulled from the upstream fromUpstream, to the image of
+// to in the upstream toUpstream when it is missing from it or when the source
+// or the destination changed since the last sync. When both digests are not
+// recorded yet, the images are considered in sync if they have the same digest.
+// It returns a description of the drift, empty if the images are in sync.
+func (r *ReplicatedImageSetBaseReconciler) syncImage(ctx context.Context, namespace string, fromUpstream, toUpstream *kuikv1alpha1.ReplicatedUpstream, from string, to *kuikv1alpha1.MirrorStatus) (drift string, err error) {
+	srcSecrets, err := r.upstreamSecrets(ctx, namespace, fromUpstream)
+	if err != nil {
+		return "", err
+	}
+	destSecrets, err := r.upstreamSecrets(ctx, namespace, toUpstream)
+	if err != nil {
+		return "", err
+	}
+
+	srcDesc, _, err := registry.NewClient(nil, nil).WithPullSecrets(srcSecrets).ReadDescriptor(ctx, http.MethodHead, from)
+	if err != nil {
+		return "", err
+	}
+	srcDigest := srcDesc.Digest.String()
+
+	destDigest := ""
+	if destDesc, _, err := registry.NewClient(nil, nil).WithPullSecrets(destSecrets).ReadDescriptor(ctx, http.MethodHead, to.Image); err == nil {
+		destDigest = destDesc.Digest.String()
+	} else if !registry.ErrIsImageNotFound(err) {
+		return "", err
+	}
+
+	switch {
+	case destDigest == "":
+		drift = "image is missing from the upstream"
+	case to.SourceDigest == "" && destDigest != srcDigest:
+		drift = fmt.Sprintf("image differs from the source: %s instead of %s", destDigest, srcDigest)
+	case to.SourceDigest != "" && srcDigest != to.SourceDigest:
+		drift = fmt.Sprintf("source tag moved from %s to %s", to.SourceDigest, srcDigest)
+	case to.DestinationDigest != "" && destDigest != to.DestinationDigest:
+		drift = fmt.Sprintf("synced image changed from %s to %s", to.DestinationDigest, destDigest)
+	}
+
+	if drift == "" {
+		now := metav1.NewTime(time.Now())
+		to.LastSyncedAt = &now
+		to.SourceDigest = srcDigest
+		to.DestinationDigest = destDigest
+		return "", nil
+	}
+
+	start := time.Now()
+	result, err := copier.Copy(ctx, srcSecrets, destSecrets, from, to.Image, r.platforms, false, r.BandwidthLimiter)
+	if err != nil {
+		return drift, err
+	}
+	recordCopy(from, to, result, start)
+	return drift, nil
+}
+
+// upstreamSecrets returns the credential secret of upstream, if any. Its
+// namespace is ignored for namespaced resources, for which namespace is not
+// empty.
+func (r *ReplicatedImageSetBaseReconciler) upstreamSecrets(ctx context.Context, namespace string, upstream *kuikv1alpha1.ReplicatedUpstream) ([]corev1.Secret, error) {
+	if upstream.CredentialSecret == nil {
+		return nil, nil
+	}
+	if namespace == "" {
+		namespace = upstream.CredentialSecret.Namespace
+	}
+	secret := corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: upstream.CredentialSecret.Name}, &secret); err != nil {
+		return nil, err
+	}
+	return []corev1.Secret{secret}, nil
+}
@@ -0,0 +1,78 @@
+package kuik
+
+import (
+	"time"
+
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	"github.com/enix/kube-image-keeper/internal/registry"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// retryBaseDelay is the delay before retrying the first failed copy of an image.
+	retryBaseDelay = 10 * time.Second
+	// retryMaxDelay caps the delay between two attempts of a copy.
+	retryMaxDelay = 15 * time.Minute
+	// bestEffortRetryBaseDelay is the delay before retrying the first failed best effort copy of an image.
+	bestEffortRetryBaseDelay = time.Minute
+	// bestEffortRetryMaxDelay caps the delay between two attempts of a best effort copy.
+	bestEffortRetryMaxDelay = time.Hour
+)
+
+// retryDelay returns the delay before the next attempt of a copy that failed
+// attempts times in a row, doubling from baseDelay up to maxDelay.
+func retryDelay(attempts int, baseDelay, maxDelay time.Duration) time.Duration {
+	delay := baseDelay
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+// retryAfter returns how long to wait before the next attempt of the copy or
+// resync of mirror after a transient failure, 0 if it may run now. It reports
+// whether mirror is parked after a permanent failure at generation, the current
+// generation of the resource.
+func retryAfter(mirror *kuikv1alpha1.MirrorStatus, generation int64) (after time.Duration, parked bool) {
+	if mirror.ParkedAtGeneration != 0 && mirror.ParkedAtGeneration == generation {
+		return 0, true
+	} else if mirror.NextAttemptAt == nil {
+		return 0, false
+	}
+	return max(time.Until(mirror.NextAttemptAt.Time), 0), false
+}
+
+// recordOutcome records into mirror the outcome of its copy or resync at
+// generation, err. A permanent failure parks mirror until the generation of the
+// resource changes, while a transient one delays its next attempt with an
+// exponential backoff. The backoff of the failures of the copies of an image
+// protected by minReplicas, copied to mirrors, is longer since they are best
+// effort. It returns the delay before the next attempt, 0 if there is none.
+func recordOutcome(generation int64, minReplicas int32, mirrors []kuikv1alpha1.MirrorStatus, mirror *kuikv1alpha1.MirrorStatus, err error) time.Duration {
+	now := metav1.Now()
+	mirror.LastAttemptAt = &now
+	if err == nil {
+		mirror.LastError = ""
+		mirror.Attempts = 0
+		mirror.NextAttemptAt = nil
+		mirror.ParkedAtGeneration = 0
+		return 0
+	}
+
+	mirror.LastError = err.Error()
+	mirror.Attempts++
+	if registry.IsPermanentError(err) {
+		mirror.NextAttemptAt = nil
+		mirror.ParkedAtGeneration = generation
+		return 0
+	}
+
+	mirror.ParkedAtGeneration = 0
+	delay := retryDelay(mirror.Attempts, retryBaseDelay, retryMaxDelay)
+	if isProtected(minReplicas, mirrors) {
+		delay = retryDelay(mirror.Attempts, bestEffortRetryBaseDelay, bestEffortRetryMaxDelay)
+	}
+	nextAttemptAt := metav1.NewTime(now.Add(delay))
+	mirror.NextAttemptAt = &nextAttemptAt
+	return delay
+}
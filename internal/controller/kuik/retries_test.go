@@ -0,0 +1,66 @@
+package kuik
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// Each failed copy is retried on its own exponential backoff, longer for the
+// best effort copies of the protected images, and the copies failing
+// permanently are parked until the spec of the resource changes.
+var _ = Describe("Mirror retries", func() {
+	boom := errors.New("boom")
+	notFound := fmt.Errorf("could not get image: %w", &transport.Error{StatusCode: http.StatusNotFound})
+
+	It("doubles the delay between two attempts up to a maximum", func() {
+		Expect(retryDelay(1, retryBaseDelay, retryMaxDelay)).To(Equal(retryBaseDelay))
+		Expect(retryDelay(2, retryBaseDelay, retryMaxDelay)).To(Equal(2 * retryBaseDelay))
+		Expect(retryDelay(3, retryBaseDelay, retryMaxDelay)).To(Equal(4 * retryBaseDelay))
+		Expect(retryDelay(100, retryBaseDelay, retryMaxDelay)).To(Equal(retryMaxDelay))
+	})
+
+	It("delays the next attempt of a transient failure and resets it on success", func() {
+		mirrors := newMirrors(0)
+		Expect(recordOutcome(1, 0, mirrors, &mirrors[0], boom)).To(Equal(retryBaseDelay))
+		Expect(recordOutcome(1, 0, mirrors, &mirrors[0], boom)).To(Equal(2 * retryBaseDelay))
+		Expect(mirrors[0].LastError).To(Equal("boom"))
+		Expect(mirrors[0].Attempts).To(Equal(2))
+		Expect(mirrors[0].LastAttemptAt).NotTo(BeNil())
+		after, parked := retryAfter(&mirrors[0], 1)
+		Expect(parked).To(BeFalse())
+		Expect(after).To(BeNumerically("~", 2*retryBaseDelay, time.Second))
+
+		Expect(recordOutcome(1, 0, mirrors, &mirrors[0], nil)).To(BeZero())
+		Expect(mirrors[0].LastError).To(BeEmpty())
+		Expect(mirrors[0].Attempts).To(BeZero())
+		Expect(mirrors[0].LastAttemptAt).NotTo(BeNil())
+		Expect(retryAfter(&mirrors[0], 1)).To(BeZero())
+	})
+
+	It("backs off longer on the best effort copies of a protected image", func() {
+		mirrors := newMirrors(2)
+		Expect(recordOutcome(1, 2, mirrors, &mirrors[2], boom)).To(Equal(bestEffortRetryBaseDelay))
+		Expect(recordOutcome(1, 3, mirrors, &mirrors[2], boom)).To(Equal(2 * retryBaseDelay))
+	})
+
+	It("parks a permanent failure until the generation changes", func() {
+		mirrors := newMirrors(0)
+		Expect(recordOutcome(3, 0, mirrors, &mirrors[0], notFound)).To(BeZero())
+		Expect(mirrors[0].ParkedAtGeneration).To(BeEquivalentTo(3))
+		Expect(mirrors[0].NextAttemptAt).To(BeNil())
+
+		_, parked := retryAfter(&mirrors[0], 3)
+		Expect(parked).To(BeTrue())
+		_, parked = retryAfter(&mirrors[0], 4)
+		Expect(parked).To(BeFalse())
+
+		Expect(recordOutcome(4, 0, mirrors, &mirrors[0], boom)).To(Equal(2 * retryBaseDelay))
+		Expect(mirrors[0].ParkedAtGeneration).To(BeZero())
+	})
+})
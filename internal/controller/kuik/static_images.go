@@ -0,0 +1,37 @@
+package kuik
+
+import (
+	"context"
+
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	"github.com/enix/kube-image-keeper/internal/registry"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// resolveStaticImages returns the normalized references of the static images of
+// obj, listing the tags of the repositories with a tags pattern using the
+// secrets returned by getSecrets. Static images that cannot be resolved are
+// reported and skipped: the ones already in status stay pinned since they still
+// match the static images.
+func resolveStaticImages(ctx context.Context, recorder events.EventRecorder, obj runtime.Object, images kuikv1alpha1.StaticImages, getSecrets func(repository string) ([]corev1.Secret, error)) []string {
+	if len(images) == 0 {
+		return nil
+	}
+
+	resolved, err := images.Resolve(func(repository string) ([]string, error) {
+		secrets, err := getSecrets(repository)
+		if err != nil {
+			return nil, err
+		}
+		return registry.NewClient(nil, nil).WithPullSecrets(secrets).ListTags(ctx, repository)
+	})
+	if err != nil {
+		logf.FromContext(ctx).Error(err, "could not resolve some static images")
+		recorder.Eventf(obj, nil, corev1.EventTypeWarning, "StaticImagesUnresolved", "ResolveImages", "could not resolve some static images: %v", err)
+	}
+
+	return resolved
+}
@@ -0,0 +1,114 @@
+package kuik
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	"github.com/enix/kube-image-keeper/internal/config"
+	"github.com/enix/kube-image-keeper/internal/registry"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// usageLedger returns the usage ledger configuration, or nil if it is disabled.
+func (r *ImageSetMirrorBaseReconciler) usageLedger() *config.UsageLedger {
+	if r.Config == nil || !r.Config.Mirroring.UsageLedger.Enabled() {
+		return nil
+	}
+	return &r.Config.Mirroring.UsageLedger
+}
+
+// mirrorRegistryClient returns a client for the mirror of image, authenticated
+// with its credential secret if it has one.
+func (r *ImageSetMirrorBaseReconciler) mirrorRegistryClient(ctx context.Context, obj metav1.Object, mirrors kuikv1alpha1.Mirrors, image string) (*registry.Client, error) {
+	secrets := []corev1.Secret{}
+	if secret, err := r.getImageSecretFromMirrors(ctx, image, obj.GetNamespace(), mirrors); err != nil {
+		return nil, err
+	} else if secret != nil {
+		secrets = append(secrets, *secret)
+	}
+	return registry.NewClient(nil, nil).WithPullSecrets(secrets), nil
+}
+
+// recordUsage records in the mirror registries, when the usage ledger is
+// enabled, that this cluster uses the mirrored images in use of obj whose use
+// was not recorded for the refresh interval of the ledger. Failed records are
+// retried on the next reconciliation. It returns when the next record is due.
+func (r *ImageSetMirrorBaseReconciler) recordUsage(ctx context.Context, obj MirrorObject) (requeueAfter time.Duration) {
+	ledger := r.usageLedger()
+	if ledger == nil {
+		return 0
+	}
+	log := logf.FromContext(ctx)
+	spec, status := obj.MirrorSpec(), obj.MirrorStatus()
+
+	now := time.Now()
+	for i := range status.MatchingImages {
+		matchingImage := &status.MatchingImages[i]
+		if matchingImage.UnusedSince != nil {
+			continue
+		}
+
+		for j := range matchingImage.Mirrors {
+			mirror := &matchingImage.Mirrors[j]
+			if mirror.MirroredAt == nil {
+				continue
+			}
+
+			recordAfter := time.Duration(0)
+			if mirror.UsageRecordedAt != nil {
+				recordAfter = mirror.UsageRecordedAt.Add(ledger.RefreshInterval).Sub(now)
+			}
+			if recordAfter <= 0 {
+				recordLog := log.WithValues("image", mirror.Image)
+				client, err := r.mirrorRegistryClient(ctx, obj, spec.Mirrors, mirror.Image)
+				if err == nil {
+					err = client.RecordUsage(ctx, mirror.Image, ledger.ClusterID, now)
+				}
+				if err != nil {
+					recordLog.Error(err, "could not record image usage in the mirror registry")
+					continue
+				}
+				recordLog.V(1).Info("recorded image usage in the mirror registry")
+				recordedAt := metav1.NewTime(now)
+				mirror.UsageRecordedAt = &recordedAt
+				recordAfter = ledger.RefreshInterval
+			}
+
+			if requeueAfter == 0 || recordAfter < requeueAfter {
+				requeueAfter = recordAfter
+			}
+		}
+	}
+
+	return requeueAfter
+}
+
+// clusterReferences looks for the usages of the manifest of image, with digest
+// digest, recorded in the mirror registry by other clusters for less than the
+// TTL of ledger. It returns a description of one of the usages of image, and of
+// one of the usages of another image with the same digest, empty if there is
+// none.
+func clusterReferences(ctx context.Context, client *registry.Client, ledger *config.UsageLedger, image, digest string) (tagUser, digestUser string, err error) {
+	usages, err := client.ListUsages(ctx, image)
+	if err != nil {
+		return "", "", err
+	}
+
+	for _, usage := range usages {
+		if usage.Cluster == ledger.ClusterID || time.Since(usage.LastUsed) >= ledger.TTL {
+			continue
+		}
+		user := fmt.Sprintf("cluster %s (%s, last used at %s)", usage.Cluster, usage.Image, usage.LastUsed.Format(time.RFC3339))
+		if usage.Image == image {
+			return user, "", nil
+		} else if digestUser == "" && usage.Digest == digest {
+			digestUser = user
+		}
+	}
+
+	return "", digestUser, nil
+}
@@ -0,0 +1,84 @@
+package kuik
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
+	"github.com/enix/kube-image-keeper/internal/config"
+	"github.com/enix/kube-image-keeper/internal/registry"
+	"github.com/google/go-containerregistry/pkg/crane"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Usage ledger", func() {
+	ctx := context.Background()
+
+	It("records the usage of the mirrored images in use once per refresh interval", func() {
+		server := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+		defer server.Close()
+		host := strings.TrimPrefix(server.URL, "http://")
+
+		image, err := random.Image(256, 1)
+		Expect(err).NotTo(HaveOccurred())
+		for _, tag := range []string{"used", "unused"} {
+			Expect(crane.Push(image, host+"/mirror/app:"+tag)).To(Succeed())
+		}
+
+		cfg, err := config.LoadDefault()
+		Expect(err).NotTo(HaveOccurred())
+		cfg.Mirroring.UsageLedger.ClusterID = "local"
+		r := &ImageSetMirrorBaseReconciler{
+			Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).Build(),
+			Scheme:   scheme.Scheme,
+			Recorder: events.NewFakeRecorder(10),
+			Config:   cfg,
+		}
+
+		mirroredAt := metav1.Now()
+		ism := &kuikv1alpha1.ImageSetMirror{
+			ObjectMeta: metav1.ObjectMeta{Name: "ism", Namespace: "default"},
+			Spec: kuikv1alpha1.ImageSetMirrorSpec{ImageSetMirrorBase: kuikv1alpha1.ImageSetMirrorBase{
+				Mirrors: kuikv1alpha1.Mirrors{{Registry: host, Path: "mirror"}},
+			}},
+			Status: kuikv1alpha1.ImageSetMirrorStatus{MatchingImages: []kuikv1alpha1.MatchingImage{
+				{
+					Image:   "docker.io/library/app:used",
+					Mirrors: []kuikv1alpha1.MirrorStatus{{Image: host + "/mirror/app:used", MirroredAt: &mirroredAt}},
+				},
+				{
+					Image:       "docker.io/library/app:unused",
+					Mirrors:     []kuikv1alpha1.MirrorStatus{{Image: host + "/mirror/app:unused", MirroredAt: &mirroredAt}},
+					UnusedSince: &mirroredAt,
+				},
+			}},
+		}
+
+		Expect(r.recordUsage(ctx, ism)).To(Equal(cfg.Mirroring.UsageLedger.RefreshInterval))
+		recordedAt := ism.Status.MatchingImages[0].Mirrors[0].UsageRecordedAt
+		Expect(recordedAt).NotTo(BeNil())
+		Expect(ism.Status.MatchingImages[1].Mirrors[0].UsageRecordedAt).To(BeNil())
+
+		usages, err := registry.NewClient(nil, nil).ListUsages(ctx, host+"/mirror/app:used")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(usages).To(ConsistOf(And(HaveField("Cluster", "local"), HaveField("Image", host+"/mirror/app:used"))))
+
+		Expect(r.recordUsage(ctx, ism)).To(BeNumerically("<=", cfg.Mirroring.UsageLedger.RefreshInterval))
+		Expect(ism.Status.MatchingImages[0].Mirrors[0].UsageRecordedAt).To(Equal(recordedAt), "usage is not recorded again before the refresh interval")
+
+		ism.Status.MatchingImages[0].Mirrors[0].UsageRecordedAt = &metav1.Time{Time: time.Now().Add(-2 * cfg.Mirroring.UsageLedger.RefreshInterval)}
+		r.recordUsage(ctx, ism)
+		Expect(ism.Status.MatchingImages[0].Mirrors[0].UsageRecordedAt.Time).To(BeTemporally("~", time.Now(), time.Minute))
+	})
+})
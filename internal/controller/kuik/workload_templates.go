@@ -0,0 +1,129 @@
+package kuik
+
+import (
+	"context"
+
+	"github.com/enix/kube-image-keeper/internal/config"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// workloadKind is a kind of workload whose pod template anticipates the images
+// of pods that do not exist yet: CronJobs that have not fired, Deployments
+// scaled to zero or the next rollout of a workload.
+type workloadKind struct {
+	name    string
+	object  func() client.Object
+	newList func() client.ObjectList
+}
+
+var workloadKinds = []workloadKind{
+	{"Deployment", func() client.Object { return &appsv1.Deployment{} }, func() client.ObjectList { return &appsv1.DeploymentList{} }},
+	{"StatefulSet", func() client.Object { return &appsv1.StatefulSet{} }, func() client.ObjectList { return &appsv1.StatefulSetList{} }},
+	{"DaemonSet", func() client.Object { return &appsv1.DaemonSet{} }, func() client.ObjectList { return &appsv1.DaemonSetList{} }},
+	{"ReplicaSet", func() client.Object { return &appsv1.ReplicaSet{} }, func() client.ObjectList { return &appsv1.ReplicaSetList{} }},
+	{"Job", func() client.Object { return &batchv1.Job{} }, func() client.ObjectList { return &batchv1.JobList{} }},
+	{"CronJob", func() client.Object { return &batchv1.CronJob{} }, func() client.ObjectList { return &batchv1.CronJobList{} }},
+}
+
+// templatePod builds a pod from the pod template of a workload, so that it goes
+// through the same filters and matching images pipeline as live pods. It
+// returns nil for workloads that will not create pods anymore: finished Jobs and
+// the ReplicaSets of previous Deployment revisions.
+func templatePod(obj client.Object) *corev1.Pod {
+	var template *corev1.PodTemplateSpec
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		template = &o.Spec.Template
+	case *appsv1.StatefulSet:
+		template = &o.Spec.Template
+	case *appsv1.DaemonSet:
+		template = &o.Spec.Template
+	case *appsv1.ReplicaSet:
+		if metav1.GetControllerOf(o) != nil && o.Spec.Replicas != nil && *o.Spec.Replicas == 0 {
+			return nil
+		}
+		template = &o.Spec.Template
+	case *batchv1.Job:
+		if jobFinishedCondition(o) != nil {
+			return nil
+		}
+		template = &o.Spec.Template
+	case *batchv1.CronJob:
+		template = &o.Spec.JobTemplate.Spec.Template
+	default:
+		return nil
+	}
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        obj.GetName(),
+			Namespace:   obj.GetNamespace(),
+			Labels:      template.Labels,
+			Annotations: template.Annotations,
+		},
+		Spec: template.Spec,
+	}
+}
+
+// listTemplatePods returns the pods built from the templates of the workloads
+// of every enabled kind in namespace (all namespaces if empty).
+func listTemplatePods(ctx context.Context, c client.Reader, cfg *config.Config, namespace string) ([]corev1.Pod, error) {
+	if cfg == nil || !cfg.WorkloadTemplates.Enabled {
+		return nil, nil
+	}
+
+	pods := []corev1.Pod{}
+	for _, kind := range workloadKinds {
+		if !cfg.WorkloadTemplates.KindEnabled(kind.name) {
+			continue
+		}
+
+		list := kind.newList()
+		if err := c.List(ctx, list, &client.ListOptions{Namespace: namespace}); err != nil {
+			return nil, err
+		}
+		err := meta.EachListItem(list, func(obj runtime.Object) error {
+			if pod := templatePod(obj.(client.Object)); pod != nil {
+				pods = append(pods, *pod)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return pods, nil
+}
+
+// watchWorkloadTemplates adds a watch on every enabled workload kind, mapping
+// workloads to requests through the pod built from their template.
+func watchWorkloadTemplates(b *builder.Builder, cfg *config.Config, mapPod handler.TypedMapFunc[*corev1.Pod, reconcile.Request]) *builder.Builder {
+	if cfg == nil {
+		return b
+	}
+
+	for _, kind := range workloadKinds {
+		if !cfg.WorkloadTemplates.KindEnabled(kind.name) {
+			continue
+		}
+		b = b.Watches(kind.object(), handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
+			pod := templatePod(obj)
+			if pod == nil {
+				return nil
+			}
+			return mapPod(ctx, pod)
+		}))
+	}
+
+	return b
+}
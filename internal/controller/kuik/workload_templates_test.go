@@ -0,0 +1,119 @@
+package kuik
+
+import (
+	"context"
+
+	"github.com/enix/kube-image-keeper/internal/config"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Workload templates", func() {
+	ctx := context.Background()
+	zero, isController := int32(0), true
+
+	template := func(image string) corev1.PodTemplateSpec {
+		return corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "web"}},
+			Spec: corev1.PodSpec{
+				ServiceAccountName: "web",
+				Containers:         []corev1.Container{{Name: "app", Image: image}},
+			},
+		}
+	}
+	objectMeta := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: "default"}
+	}
+
+	Context("templatePod", func() {
+		It("builds a pod from the template of a scaled down Deployment", func() {
+			pod := templatePod(&appsv1.Deployment{
+				ObjectMeta: objectMeta("web"),
+				Spec:       appsv1.DeploymentSpec{Replicas: &zero, Template: template("nginx:1.25")},
+			})
+			Expect(pod).NotTo(BeNil())
+			Expect(pod.Namespace).To(Equal("default"))
+			Expect(pod.Labels).To(HaveKeyWithValue("app", "web"))
+			Expect(pod.Spec.ServiceAccountName).To(Equal("web"))
+			Expect(pod.Spec.Containers[0].Image).To(Equal("nginx:1.25"))
+		})
+
+		It("builds a pod from the job template of a CronJob", func() {
+			pod := templatePod(&batchv1.CronJob{
+				ObjectMeta: objectMeta("nightly"),
+				Spec: batchv1.CronJobSpec{JobTemplate: batchv1.JobTemplateSpec{
+					Spec: batchv1.JobSpec{Template: template("backup:2.0")},
+				}},
+			})
+			Expect(pod).NotTo(BeNil())
+			Expect(pod.Spec.Containers[0].Image).To(Equal("backup:2.0"))
+		})
+
+		It("ignores finished Jobs", func() {
+			job := &batchv1.Job{ObjectMeta: objectMeta("migrate"), Spec: batchv1.JobSpec{Template: template("migrate:1")}}
+			Expect(templatePod(job)).NotTo(BeNil())
+
+			job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+			Expect(templatePod(job)).To(BeNil())
+		})
+
+		It("ignores the ReplicaSets of previous Deployment revisions", func() {
+			replicaSet := &appsv1.ReplicaSet{
+				ObjectMeta: objectMeta("web-5d8f"),
+				Spec:       appsv1.ReplicaSetSpec{Replicas: &zero, Template: template("nginx:1.24")},
+			}
+			Expect(templatePod(replicaSet)).NotTo(BeNil(), "a standalone ReplicaSet scaled to zero is still a workload")
+
+			replicaSet.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: "apps/v1", Kind: "Deployment", Name: "web", UID: "uid", Controller: &isController,
+			}}
+			Expect(templatePod(replicaSet)).To(BeNil())
+		})
+	})
+
+	Context("listTemplatePods", func() {
+		objs := []client.Object{
+			&appsv1.Deployment{ObjectMeta: objectMeta("web"), Spec: appsv1.DeploymentSpec{Template: template("nginx:1.25")}},
+			&batchv1.CronJob{ObjectMeta: objectMeta("nightly"), Spec: batchv1.CronJobSpec{JobTemplate: batchv1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{Template: template("backup:2.0")},
+			}}},
+			&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "other"}, Spec: appsv1.StatefulSetSpec{Template: template("postgres:16")}},
+		}
+		images := func(pods []corev1.Pod) []string {
+			images := []string{}
+			for _, pod := range pods {
+				images = append(images, pod.Spec.Containers[0].Image)
+			}
+			return images
+		}
+
+		It("lists nothing when disabled", func() {
+			c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objs...).Build()
+			cfg := &config.Config{WorkloadTemplates: config.WorkloadTemplates{Kinds: []string{"Deployment"}}}
+
+			pods, err := listTemplatePods(ctx, c, cfg, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pods).To(BeEmpty())
+		})
+
+		It("lists the templates of the enabled kinds in the namespace", func() {
+			c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objs...).Build()
+			cfg := &config.Config{WorkloadTemplates: config.WorkloadTemplates{Enabled: true, Kinds: []string{"CronJob", "StatefulSet"}}}
+
+			pods, err := listTemplatePods(ctx, c, cfg, "default")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(images(pods)).To(ConsistOf("backup:2.0"))
+
+			pods, err = listTemplatePods(ctx, c, cfg, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(images(pods)).To(ConsistOf("backup:2.0", "postgres:16"))
+		})
+	})
+})
@@ -0,0 +1,222 @@
+// Package copier copies an image from its source registry to a mirror. It is
+// used by the mirror reconcilers to copy images in the manager, and by the copy
+// subcommand of the manager, run by the Jobs of the Job copy mode.
+package copier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/enix/kube-image-keeper/internal/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	corev1 "k8s.io/api/core/v1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Command is the name of the manager subcommand copying an image.
+const Command = "copy"
+
+const (
+	sourcePrefix      = "source-"
+	destinationPrefix = "destination-"
+)
+
+// Result is the outcome of a copy. The copy subcommand writes it as JSON to its
+// termination log so that the reconciler reads it from the status of the pod.
+type Result struct {
+	SourceDigest      string `json:"sourceDigest,omitempty"`
+	DestinationDigest string `json:"destinationDigest,omitempty"`
+	Size              int64  `json:"size,omitempty"`
+	Layers            int    `json:"layers,omitempty"`
+	UploadedBytes     int64  `json:"uploadedBytes,omitempty"`
+	Referrers         int    `json:"referrers,omitempty"`
+	Error             string `json:"error,omitempty"`
+	// Permanent is true when retrying the copy cannot fix Error.
+	Permanent bool `json:"permanent,omitempty"`
+}
+
+// Copy copies source to dest, keeping only the given platforms, along with the
+// artifacts attached to the source manifest and to the copied per-platform
+// manifests if referrers is true. The artifacts attached to a source index are
+// not copied when platforms are filtered out of it, as the index written to dest
+// is not their subject. The upload to dest is throttled by limiter, if not nil.
+func Copy(ctx context.Context, srcSecrets, destSecrets []corev1.Secret, source, dest string, platforms []v1.Platform, referrers bool, limiter *registry.BandwidthLimiter) (*Result, error) {
+	client := registry.NewClient(nil, nil).WithPullSecrets(srcSecrets)
+	srcDesc, err := client.GetDescriptor(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	// FIXME: if a platform is added or removed, already mirrored images are not updated consequently
+	stats, err := client.WithTimeout(0).WithPullSecrets(destSecrets).WithBandwidthLimiter(limiter).CopyImage(ctx, srcDesc, dest, platforms)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		SourceDigest:      srcDesc.Digest.String(),
+		DestinationDigest: stats.Digest.String(),
+		Size:              stats.Size,
+		Layers:            stats.Layers,
+		UploadedBytes:     stats.UploadedBytes,
+	}
+
+	if referrers {
+		subjects := stats.Manifests
+		if stats.Digest == srcDesc.Digest {
+			subjects = append([]v1.Hash{srcDesc.Digest}, subjects...)
+		} else {
+			// The artifacts attached to the source index would be dangling at dest, their subject is not there
+			logf.FromContext(ctx).V(1).Info("not copying the referrers of the index, platforms were filtered out of it", "source", source, "sourceDigest", srcDesc.Digest.String(), "destinationDigest", stats.Digest.String())
+		}
+		copied, err := client.CopyReferrers(ctx, registry.NewClient(nil, nil).WithPullSecrets(srcSecrets), source, dest, subjects)
+		if err != nil {
+			return nil, fmt.Errorf("could not copy the referrers: %w", err)
+		}
+		result.Referrers = len(copied)
+	}
+
+	return result, nil
+}
+
+// CredentialsData returns the data of a secret holding srcSecrets and
+// destSecrets, to be mounted in the copier pod and read back by
+// ReadCredentials. Secrets that are not docker config secrets are skipped. Keys
+// are numbered with zero padding so that their lexical order, in which they are
+// read back, is the order of the secrets.
+func CredentialsData(srcSecrets, destSecrets []corev1.Secret) map[string][]byte {
+	data := map[string][]byte{}
+	for prefix, secrets := range map[string][]corev1.Secret{sourcePrefix: srcSecrets, destinationPrefix: destSecrets} {
+		for i, secret := range secrets {
+			switch secret.Type {
+			case corev1.SecretTypeDockerConfigJson:
+				data[fmt.Sprintf("%s%03d%s", prefix, i, corev1.DockerConfigJsonKey)] = secret.Data[corev1.DockerConfigJsonKey]
+			case corev1.SecretTypeDockercfg:
+				data[fmt.Sprintf("%s%03d%s", prefix, i, corev1.DockerConfigKey)] = secret.Data[corev1.DockerConfigKey]
+			}
+		}
+	}
+	return data
+}
+
+// ReadCredentials reads the source and destination secrets written by
+// CredentialsData from the files of dir, in their original order.
+func ReadCredentials(dir string) (srcSecrets, destSecrets []corev1.Secret, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), "..") {
+			continue
+		}
+
+		secret := corev1.Secret{}
+		var key string
+		switch {
+		case strings.HasSuffix(entry.Name(), corev1.DockerConfigJsonKey):
+			secret.Type, key = corev1.SecretTypeDockerConfigJson, corev1.DockerConfigJsonKey
+		case strings.HasSuffix(entry.Name(), corev1.DockerConfigKey):
+			secret.Type, key = corev1.SecretTypeDockercfg, corev1.DockerConfigKey
+		default:
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, nil, err
+		}
+		secret.Data = map[string][]byte{key: data}
+
+		if strings.HasPrefix(entry.Name(), sourcePrefix) {
+			srcSecrets = append(srcSecrets, secret)
+		} else if strings.HasPrefix(entry.Name(), destinationPrefix) {
+			destSecrets = append(destSecrets, secret)
+		}
+	}
+
+	return srcSecrets, destSecrets, nil
+}
+
+// Args returns the arguments of the copy subcommand copying source to dest, and
+// its referrers if referrers is true, at most at maxBytesPerSecond if not 0.
+func Args(source, dest string, platforms []v1.Platform, referrers bool, credentialsDir string, maxBytesPerSecond int64) ([]string, error) {
+	platformsJSON, err := json.Marshal(platforms)
+	if err != nil {
+		return nil, err
+	}
+	return []string{
+		Command,
+		"-from=" + source,
+		"-to=" + dest,
+		"-platforms=" + string(platformsJSON),
+		"-referrers=" + strconv.FormatBool(referrers),
+		"-credentials-dir=" + credentialsDir,
+		"-max-bytes-per-second=" + strconv.FormatInt(maxBytesPerSecond, 10),
+	}, nil
+}
+
+// Run is the copy subcommand. It copies an image and writes the result to the
+// termination log, including the error if the copy failed.
+func Run(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet(Command, flag.ContinueOnError)
+	from := flags.String("from", "", "The image to copy.")
+	to := flags.String("to", "", "The mirror to copy the image to.")
+	platformsJSON := flags.String("platforms", "[]", "The platforms to copy, as a JSON list.")
+	referrers := flags.Bool("referrers", false, "Also copy the signatures, attestations and other referrers of the image.")
+	credentialsDir := flags.String("credentials-dir", "", "The directory containing the registry credentials.")
+	maxBytesPerSecond := flags.Int64("max-bytes-per-second", 0, "The maximum upload rate to the mirror, 0 for unlimited.")
+	terminationLog := flags.String("termination-log", "/dev/termination-log", "The file the result is written to.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	result, err := run(ctx, *from, *to, *platformsJSON, *referrers, *credentialsDir, *maxBytesPerSecond)
+	if err != nil {
+		result = &Result{Error: err.Error(), Permanent: registry.IsPermanentError(err)}
+	}
+
+	data, marshalErr := json.Marshal(result)
+	if marshalErr != nil {
+		return errors.Join(err, marshalErr)
+	}
+	if writeErr := os.WriteFile(*terminationLog, data, 0o644); writeErr != nil {
+		return errors.Join(err, writeErr)
+	}
+
+	return err
+}
+
+func run(ctx context.Context, from, to, platformsJSON string, referrers bool, credentialsDir string, maxBytesPerSecond int64) (*Result, error) {
+	if from == "" || to == "" {
+		return nil, errors.New("-from and -to are required")
+	}
+
+	platforms := []v1.Platform{}
+	if err := json.Unmarshal([]byte(platformsJSON), &platforms); err != nil {
+		return nil, fmt.Errorf("invalid platforms: %w", err)
+	}
+
+	var srcSecrets, destSecrets []corev1.Secret
+	if credentialsDir != "" {
+		var err error
+		if srcSecrets, destSecrets, err = ReadCredentials(credentialsDir); err != nil {
+			return nil, fmt.Errorf("could not read credentials: %w", err)
+		}
+	}
+
+	var limiter *registry.BandwidthLimiter
+	if maxBytesPerSecond > 0 {
+		limiter = registry.NewBandwidthLimiter(maxBytesPerSecond, nil)
+	}
+
+	return Copy(ctx, srcSecrets, destSecrets, from, to, platforms, referrers, limiter)
+}
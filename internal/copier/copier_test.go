@@ -0,0 +1,175 @@
+package copier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestCredentials(t *testing.T) {
+	g := NewWithT(t)
+
+	srcSecrets := []corev1.Secret{
+		{Type: corev1.SecretTypeDockerConfigJson, Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{"src.example.com":{}}}`)}},
+		{Type: corev1.SecretTypeDockercfg, Data: map[string][]byte{corev1.DockerConfigKey: []byte(`{"legacy.example.com":{}}`)}},
+		{Type: corev1.SecretTypeOpaque, Data: map[string][]byte{"token": []byte("ignored")}},
+	}
+	destSecrets := []corev1.Secret{
+		{},
+		{Type: corev1.SecretTypeDockerConfigJson, Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{"dest.example.com":{}}}`)}},
+	}
+
+	data := CredentialsData(srcSecrets, destSecrets)
+	g.Expect(data).To(HaveLen(3))
+
+	dir := t.TempDir()
+	for key, value := range data {
+		g.Expect(os.WriteFile(filepath.Join(dir, key), value, 0o600)).To(Succeed())
+	}
+
+	readSrcSecrets, readDestSecrets, err := ReadCredentials(dir)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(readSrcSecrets).To(ConsistOf(srcSecrets[0], srcSecrets[1]))
+	g.Expect(readDestSecrets).To(ConsistOf(destSecrets[1]))
+}
+
+func TestCredentialsOrder(t *testing.T) {
+	g := NewWithT(t)
+
+	srcSecrets := []corev1.Secret{}
+	for i := range 12 {
+		config := fmt.Sprintf(`{"auths":{"src%d.example.com":{}}}`, i)
+		srcSecrets = append(srcSecrets, corev1.Secret{Type: corev1.SecretTypeDockerConfigJson, Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(config)}})
+	}
+
+	dir := t.TempDir()
+	for key, value := range CredentialsData(srcSecrets, nil) {
+		g.Expect(os.WriteFile(filepath.Join(dir, key), value, 0o600)).To(Succeed())
+	}
+
+	readSrcSecrets, _, err := ReadCredentials(dir)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(readSrcSecrets).To(Equal(srcSecrets), "secrets are tried in order, source-10 must not come before source-2")
+}
+
+func TestRun(t *testing.T) {
+	g := NewWithT(t)
+
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	platform := v1.Platform{OS: "linux", Architecture: "amd64"}
+	image, err := random.Image(256, 1)
+	g.Expect(err).NotTo(HaveOccurred())
+	image, err = mutate.ConfigFile(image, &v1.ConfigFile{OS: platform.OS, Architecture: platform.Architecture})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(crane.Push(image, host+"/src/app:1.0")).To(Succeed())
+	digest, err := image.Digest()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	readResult := func(path string) Result {
+		data, err := os.ReadFile(path)
+		g.Expect(err).NotTo(HaveOccurred())
+		result := Result{}
+		g.Expect(json.Unmarshal(data, &result)).To(Succeed())
+		return result
+	}
+
+	terminationLog := filepath.Join(t.TempDir(), "termination-log")
+	args, err := Args(host+"/src/app:1.0", host+"/mirror/src/app:1.0", []v1.Platform{platform}, false, t.TempDir(), 0)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(args[0]).To(Equal(Command))
+
+	g.Expect(Run(context.Background(), append(args[1:], "-termination-log="+terminationLog))).To(Succeed())
+	result := readResult(terminationLog)
+	g.Expect(result.SourceDigest).To(Equal(digest.String()))
+	g.Expect(result.DestinationDigest).To(Equal(digest.String()))
+	g.Expect(result.Layers).To(Equal(1))
+	g.Expect(result.Size).To(BeNumerically(">", 256))
+	g.Expect(result.Error).To(BeEmpty())
+	_, err = crane.Digest(host + "/mirror/src/app:1.0")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	args, err = Args(host+"/src/missing:1.0", host+"/mirror/src/missing:1.0", []v1.Platform{platform}, false, "", 0)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(Run(context.Background(), append(args[1:], "-termination-log="+terminationLog))).NotTo(Succeed())
+	g.Expect(readResult(terminationLog).Error).To(ContainSubstring("NAME_UNKNOWN"))
+}
+
+func TestCopyReferrersOfFilteredIndex(t *testing.T) {
+	g := NewWithT(t)
+
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0)), registry.WithReferrersSupport(true)))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+	ctx := context.Background()
+
+	amd64 := v1.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := v1.Platform{OS: "linux", Architecture: "arm64"}
+	var index v1.ImageIndex = empty.Index
+	for _, platform := range []v1.Platform{amd64, arm64} {
+		image, err := random.Image(256, 1)
+		g.Expect(err).NotTo(HaveOccurred())
+		index = mutate.AppendManifests(index, mutate.IndexAddendum{Add: image, Descriptor: v1.Descriptor{Platform: &platform}})
+	}
+	srcRef, err := name.ParseReference(host + "/src/app:v1")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(remote.WriteIndex(srcRef, index)).To(Succeed())
+	indexDigest, err := index.Digest()
+	g.Expect(err).NotTo(HaveOccurred())
+	manifest, err := index.IndexManifest()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	attach := func(subject v1.Hash) {
+		subjectDesc, err := remote.Head(srcRef.Context().Digest(subject.String()))
+		g.Expect(err).NotTo(HaveOccurred())
+		artifact := mutate.ConfigMediaType(mutate.MediaType(empty.Image, types.OCIManifestSchema1), "application/vnd.dev.sigstore.bundle.v0.3+json")
+		artifact = mutate.Subject(artifact, *subjectDesc).(v1.Image)
+		digest, err := artifact.Digest()
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(remote.Write(srcRef.Context().Digest(digest.String()), artifact)).To(Succeed())
+	}
+	attach(indexDigest)
+	attach(manifest.Manifests[0].Digest)
+
+	referrersOf := func(repository string, subject v1.Hash) []v1.Descriptor {
+		index, err := remote.Referrers(srcRef.Context().Registry.Repo(repository, "app").Digest(subject.String()))
+		g.Expect(err).NotTo(HaveOccurred())
+		manifest, err := index.IndexManifest()
+		g.Expect(err).NotTo(HaveOccurred())
+		return manifest.Manifests
+	}
+
+	result, err := Copy(ctx, nil, nil, host+"/src/app:v1", host+"/filtered/app:v1", []v1.Platform{amd64}, true, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.DestinationDigest).NotTo(Equal(indexDigest.String()))
+	g.Expect(result.Referrers).To(Equal(1), "only the referrer of the amd64 manifest is copied")
+	g.Expect(referrersOf("filtered", indexDigest)).To(BeEmpty())
+	g.Expect(referrersOf("filtered", manifest.Manifests[0].Digest)).To(HaveLen(1))
+
+	result, err = Copy(ctx, nil, nil, host+"/src/app:v1", host+"/unfiltered/app:v1", []v1.Platform{amd64, arm64}, true, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.DestinationDigest).To(Equal(indexDigest.String()))
+	g.Expect(result.Referrers).To(Equal(2))
+	g.Expect(referrersOf("unfiltered", indexDigest)).To(HaveLen(1))
+}
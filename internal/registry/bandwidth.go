@@ -0,0 +1,143 @@
+package registry
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/time/rate"
+)
+
+// BandwidthLimiter bounds the rate at which bytes are uploaded to registries,
+// globally and per registry. Since layers are streamed from their source to
+// their destination while copying an image, it bounds the download rate of the
+// copies as well.
+type BandwidthLimiter struct {
+	global      *rate.Limiter
+	perRegistry func(registry string) int64
+
+	mu         sync.Mutex
+	registries map[string]*rate.Limiter
+}
+
+// NewBandwidthLimiter returns a limiter allowing maxBytesPerSecond overall, and
+// perRegistry(registry) to each registry. A limit of 0 means unlimited, and
+// perRegistry may be nil.
+func NewBandwidthLimiter(maxBytesPerSecond int64, perRegistry func(registry string) int64) *BandwidthLimiter {
+	if perRegistry == nil {
+		perRegistry = func(string) int64 { return 0 }
+	}
+	return &BandwidthLimiter{
+		global:      newBandwidthRateLimiter(maxBytesPerSecond),
+		perRegistry: perRegistry,
+		registries:  map[string]*rate.Limiter{},
+	}
+}
+
+// MaxBytesPerSecond returns the rate a single upload to registry is limited to,
+// 0 if unlimited.
+func (l *BandwidthLimiter) MaxBytesPerSecond(registry string) int64 {
+	if l == nil {
+		return 0
+	}
+	maxBytesPerSecond := int64(0)
+	for _, limiter := range l.limiters(registry) {
+		if limit := int64(limiter.Limit()); maxBytesPerSecond == 0 || limit < maxBytesPerSecond {
+			maxBytesPerSecond = limit
+		}
+	}
+	return maxBytesPerSecond
+}
+
+// limiters returns the rate limiters applying to the uploads to registry.
+func (l *BandwidthLimiter) limiters(registry string) []*rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limiter, ok := l.registries[registry]
+	if !ok {
+		limiter = newBandwidthRateLimiter(l.perRegistry(registry))
+		l.registries[registry] = limiter
+	}
+
+	limiters := []*rate.Limiter{}
+	for _, limiter := range []*rate.Limiter{l.global, limiter} {
+		if limiter != nil {
+			limiters = append(limiters, limiter)
+		}
+	}
+	return limiters
+}
+
+// newBandwidthRateLimiter returns a rate limiter allowing bytesPerSecond with a
+// burst of one second, nil if bytesPerSecond is 0.
+func newBandwidthRateLimiter(bytesPerSecond int64) *rate.Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), int(min(bytesPerSecond, math.MaxInt32)))
+}
+
+// uploadTransport wraps an http.RoundTripper to count, and throttle if
+// limiters are set, the bytes of the bodies of the requests to a registry.
+type uploadTransport struct {
+	roundTripper http.RoundTripper
+	limiters     []*rate.Limiter
+	uploaded     *atomic.Int64
+}
+
+func (t *uploadTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return t.roundTripper.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	req.Body = t.wrap(req.Context(), req.Body)
+	if getBody := req.GetBody; getBody != nil {
+		req.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			return t.wrap(req.Context(), body), nil
+		}
+	}
+
+	return t.roundTripper.RoundTrip(req)
+}
+
+func (t *uploadTransport) wrap(ctx context.Context, body io.ReadCloser) io.ReadCloser {
+	return &uploadReader{ctx: ctx, reader: body, limiters: t.limiters, uploaded: t.uploaded}
+}
+
+type uploadReader struct {
+	ctx      context.Context
+	reader   io.ReadCloser
+	limiters []*rate.Limiter
+	uploaded *atomic.Int64
+}
+
+func (r *uploadReader) Read(p []byte) (int, error) {
+	// Never read more than a limiter can let through at once
+	for _, limiter := range r.limiters {
+		if len(p) > limiter.Burst() {
+			p = p[:limiter.Burst()]
+		}
+	}
+
+	n, err := r.reader.Read(p)
+	r.uploaded.Add(int64(n))
+	for _, limiter := range r.limiters {
+		if waitErr := limiter.WaitN(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+func (r *uploadReader) Close() error {
+	return r.reader.Close()
+}
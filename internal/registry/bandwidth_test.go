@@ -0,0 +1,96 @@
+package registry
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func TestBandwidthLimiterMaxBytesPerSecond(t *testing.T) {
+	limiter := NewBandwidthLimiter(1000, func(registry string) int64 {
+		switch registry {
+		case "slow.example.com":
+			return 100
+		case "fast.example.com":
+			return 10000
+		default:
+			return 0
+		}
+	})
+
+	tests := []struct {
+		name     string
+		limiter  *BandwidthLimiter
+		registry string
+		want     int64
+	}{
+		{name: "registry limit below the global one", limiter: limiter, registry: "slow.example.com", want: 100},
+		{name: "registry limit above the global one", limiter: limiter, registry: "fast.example.com", want: 1000},
+		{name: "registry without limit", limiter: limiter, registry: "other.example.com", want: 1000},
+		{name: "registry limit only", limiter: NewBandwidthLimiter(0, func(string) int64 { return 100 }), registry: "other.example.com", want: 100},
+		{name: "unlimited", limiter: NewBandwidthLimiter(0, nil), registry: "other.example.com", want: 0},
+		{name: "no limiter", limiter: nil, registry: "other.example.com", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.limiter.MaxBytesPerSecond(tt.registry); got != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCopyImageThrottled(t *testing.T) {
+	// Distinct registries, so that the layer is uploaded instead of mounted
+	srcServer := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer srcServer.Close()
+	srcHost := strings.TrimPrefix(srcServer.URL, "http://")
+	destServer := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer destServer.Close()
+	destHost := strings.TrimPrefix(destServer.URL, "http://")
+
+	amd64 := v1.Platform{OS: "linux", Architecture: "amd64"}
+	image, err := random.Image(64*1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	image, err = mutate.ConfigFile(image, &v1.ConfigFile{OS: amd64.OS, Architecture: amd64.Architecture})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crane.Push(image, srcHost+"/src/image:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	src, err := NewClient(nil, nil).GetDescriptor(ctx, srcHost+"/src/image:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first second worth of bytes is let through at once, the remaining half
+	// of the layer takes about a second
+	limiter := NewBandwidthLimiter(0, func(string) int64 { return 32 * 1024 })
+	start := time.Now()
+	stats, err := NewClient(nil, nil).WithBandwidthLimiter(limiter).CopyImage(ctx, src, destHost+"/dest/image:v1", []v1.Platform{amd64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 750*time.Millisecond {
+		t.Errorf("expected the copy to be throttled, it took %v", elapsed)
+	}
+	if stats.UploadedBytes < stats.Size {
+		t.Errorf("expected the whole image to be uploaded, uploaded %d bytes out of %d", stats.UploadedBytes, stats.Size)
+	}
+}
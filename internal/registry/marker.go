@@ -0,0 +1,248 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+const (
+	// CopyMarkerArtifactType is the artifact type of the manifests attached to
+	// the images copied by kuik, which tell them apart from the other content of
+	// the registry.
+	CopyMarkerArtifactType = "application/vnd.enix.kuik.copy.v1+json"
+	// CopyMarkerOwnerAnnotation is the annotation of the copy markers holding the
+	// resource the image was copied for.
+	CopyMarkerOwnerAnnotation = "kuik.enix.io/owner"
+	// CopyMarkerTagAnnotation is the annotation of the copy markers holding the
+	// tag the image was copied to, since other tags may share its manifest.
+	CopyMarkerTagAnnotation = "kuik.enix.io/tag"
+
+	// UsageMarkerArtifactType is the artifact type of the manifests recording
+	// the use of a mirrored image by a cluster.
+	UsageMarkerArtifactType = "application/vnd.enix.kuik.usage.v1+json"
+	// UsageMarkerTagPrefix is the prefix of the tags of the usage markers, next
+	// to the images whose use they record.
+	UsageMarkerTagPrefix = "kuik-usage-"
+	// UsageMarkerClusterAnnotation is the annotation of the usage markers holding
+	// the ID of the cluster using the image.
+	UsageMarkerClusterAnnotation = "kuik.enix.io/cluster"
+	// UsageMarkerImageAnnotation is the annotation of the usage markers holding
+	// the image used by the cluster.
+	UsageMarkerImageAnnotation = "kuik.enix.io/image"
+	// UsageMarkerDigestAnnotation is the annotation of the usage markers holding
+	// the digest of the image used by the cluster.
+	UsageMarkerDigestAnnotation = "kuik.enix.io/digest"
+	// UsageMarkerLastUsedAnnotation is the annotation of the usage markers holding
+	// the last time the cluster was found using the image, in RFC 3339 format.
+	UsageMarkerLastUsedAnnotation = "kuik.enix.io/last-used"
+)
+
+// MarkCopy attaches to image a copy marker owned by owner, as a referrer of its
+// manifest, for the tag of image only. Registries that do not implement the
+// referrers API get the marker through the referrers tag schema. Marking the
+// same tag for the same owner twice writes the same marker.
+func (c *Client) MarkCopy(ctx context.Context, image, owner string) error {
+	return c.Execute(ctx, image, func(ref name.Reference, opts ...remote.Option) error {
+		subject, err := remote.Head(ref, opts...)
+		if err != nil {
+			return err
+		}
+
+		marker := mutate.ConfigMediaType(mutate.MediaType(empty.Image, types.OCIManifestSchema1), CopyMarkerArtifactType)
+		marker = mutate.Annotations(marker, map[string]string{
+			CopyMarkerOwnerAnnotation: owner,
+			CopyMarkerTagAnnotation:   ref.Identifier(),
+		}).(v1.Image)
+		marker = mutate.Subject(marker, *subject).(v1.Image)
+		digest, err := marker.Digest()
+		if err != nil {
+			return err
+		}
+
+		return remote.Write(ref.Context().Digest(digest.String()), marker, opts...)
+	})
+}
+
+// IsMarkedCopy reports whether image has a copy marker owned by owner for its
+// tag. Other tags of the same manifest are not marked.
+func (c *Client) IsMarkedCopy(ctx context.Context, image, owner string) (marked bool, err error) {
+	err = c.Execute(ctx, image, func(ref name.Reference, opts ...remote.Option) error {
+		markers, err := referrers(ref, CopyMarkerArtifactType, opts...)
+		if err != nil {
+			return err
+		}
+		marked = slices.ContainsFunc(markers, func(marker referrer) bool {
+			return marker.annotations[CopyMarkerOwnerAnnotation] == owner && marker.annotations[CopyMarkerTagAnnotation] == ref.Identifier()
+		})
+		return nil
+	})
+	return marked, err
+}
+
+// Usage is a record, kept in a mirror registry, of the use of a mirrored image
+// by a cluster.
+type Usage struct {
+	Cluster string
+	Image   string
+	// Digest of the image when its use was recorded.
+	Digest   string
+	LastUsed time.Time
+}
+
+// usageTag returns the tag of the usage marker of cluster for image, in the
+// repository of image.
+func usageTag(cluster, image string) string {
+	sum := sha256.Sum256([]byte(cluster + "\n" + image))
+	return UsageMarkerTagPrefix + hex.EncodeToString(sum[:16])
+}
+
+// RecordUsage records that cluster used image at lastUsed, with a usage marker
+// tagged in the repository of image. The marker of cluster for image is
+// replaced by each record.
+func (c *Client) RecordUsage(ctx context.Context, image, cluster string, lastUsed time.Time) error {
+	return c.Execute(ctx, image, func(ref name.Reference, opts ...remote.Option) error {
+		subject, err := remote.Head(ref, opts...)
+		if err != nil {
+			return err
+		}
+
+		marker := mutate.ConfigMediaType(mutate.MediaType(empty.Image, types.OCIManifestSchema1), UsageMarkerArtifactType)
+		marker = mutate.Annotations(marker, map[string]string{
+			UsageMarkerClusterAnnotation:  cluster,
+			UsageMarkerImageAnnotation:    image,
+			UsageMarkerDigestAnnotation:   subject.Digest.String(),
+			UsageMarkerLastUsedAnnotation: lastUsed.UTC().Format(time.RFC3339),
+		}).(v1.Image)
+		return remote.Write(ref.Context().Tag(usageTag(cluster, image)), marker, opts...)
+	})
+}
+
+// DeleteUsage deletes the usage marker of cluster for image, if any.
+func (c *Client) DeleteUsage(ctx context.Context, image, cluster string) error {
+	return c.Execute(ctx, image, func(ref name.Reference, opts ...remote.Option) error {
+		err := remote.Delete(ref.Context().Tag(usageTag(cluster, image)), opts...)
+		if ErrIsImageNotFound(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+// ListUsages returns the usages recorded by every cluster for the images of
+// the repository of image.
+func (c *Client) ListUsages(ctx context.Context, image string) (usages []Usage, err error) {
+	err = c.Execute(ctx, image, func(ref name.Reference, opts ...remote.Option) error {
+		tags, err := remote.List(ref.Context(), opts...)
+		if err != nil {
+			return err
+		}
+
+		usages = []Usage{}
+		for _, tag := range tags {
+			if !strings.HasPrefix(tag, UsageMarkerTagPrefix) {
+				continue
+			}
+			marker, err := remote.Image(ref.Context().Tag(tag), opts...)
+			if ErrIsImageNotFound(err) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			manifest, err := marker.Manifest()
+			if err != nil {
+				return err
+			}
+			lastUsed, err := time.Parse(time.RFC3339, manifest.Annotations[UsageMarkerLastUsedAnnotation])
+			if manifest.Config.MediaType != UsageMarkerArtifactType || err != nil {
+				continue
+			}
+			usages = append(usages, Usage{
+				Cluster:  manifest.Annotations[UsageMarkerClusterAnnotation],
+				Image:    manifest.Annotations[UsageMarkerImageAnnotation],
+				Digest:   manifest.Annotations[UsageMarkerDigestAnnotation],
+				LastUsed: lastUsed,
+			})
+		}
+		return nil
+	})
+	return usages, err
+}
+
+// referrer is a marker attached to a manifest.
+type referrer struct {
+	digest      v1.Hash
+	annotations map[string]string
+}
+
+// referrers returns the referrers of artifactType of the manifest of ref. Their
+// annotations are read from their manifest, since registries may not return
+// them in the referrers list.
+func referrers(ref name.Reference, artifactType string, opts ...remote.Option) ([]referrer, error) {
+	subject, err := remote.Head(ref, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := remote.WithFilter("artifactType", artifactType)
+	index, err := remote.Referrers(ref.Context().Digest(subject.Digest.String()), append(opts, filter)...)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	referrers := []referrer{}
+	for _, descriptor := range manifest.Manifests {
+		if descriptor.ArtifactType != artifactType {
+			continue
+		}
+		image, err := remote.Image(ref.Context().Digest(descriptor.Digest.String()), opts...)
+		if err != nil {
+			return nil, err
+		}
+		imageManifest, err := image.Manifest()
+		if err != nil {
+			return nil, err
+		}
+		referrers = append(referrers, referrer{digest: descriptor.Digest, annotations: imageManifest.Annotations})
+	}
+	return referrers, nil
+}
+
+// ListRepositories returns the repositories of the registry catalog under
+// prefix, a registry optionally followed by a path, as full repository names.
+func (c *Client) ListRepositories(ctx context.Context, prefix string) ([]string, error) {
+	registry, repositoryPath, _ := strings.Cut(prefix, "/")
+
+	// The credentials are looked up for a repository under prefix, since the
+	// catalog is not bound to any repository.
+	var repositories []string
+	err := c.Execute(ctx, path.Join(registry, repositoryPath, "catalog"), func(ref name.Reference, opts ...remote.Option) error {
+		catalog, err := remote.Catalog(ctx, ref.Context().Registry, opts...)
+		if err != nil {
+			return err
+		}
+		repositories = repositories[:0]
+		for _, repository := range catalog {
+			if repositoryPath == "" || strings.HasPrefix(repository, repositoryPath+"/") {
+				repositories = append(repositories, path.Join(registry, repository))
+			}
+		}
+		return nil
+	})
+	return repositories, err
+}
@@ -0,0 +1,158 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func TestMarkCopy(t *testing.T) {
+	for name, handler := range map[string]http.Handler{
+		"with the referrers API": registry.New(registry.WithReferrersSupport(true)),
+		"with the referrers tag": registry.New(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			host := strings.TrimPrefix(server.URL, "http://")
+
+			// shared is another tag of the manifest of marked, pushed by a user
+			for _, tags := range [][]string{{"marked", "shared"}, {"unmarked"}} {
+				image, err := random.Image(256, 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, tag := range tags {
+					if err := crane.Push(image, host+"/mirror/image:"+tag); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			client := NewClient(nil, nil)
+			ctx := context.Background()
+			for range 2 {
+				if err := client.MarkCopy(ctx, host+"/mirror/image:marked", "ImageSetMirror default/ism"); err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+			}
+
+			for _, tt := range []struct {
+				tag, owner string
+				want       bool
+			}{
+				{"marked", "ImageSetMirror default/ism", true},
+				{"marked", "ImageSetMirror default/other", false},
+				{"unmarked", "ImageSetMirror default/ism", false},
+				{"shared", "ImageSetMirror default/ism", false},
+			} {
+				marked, err := client.IsMarkedCopy(ctx, host+"/mirror/image:"+tt.tag, tt.owner)
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if marked != tt.want {
+					t.Fatalf("expected %s to be marked for %s: %v, got %v", tt.tag, tt.owner, tt.want, marked)
+				}
+			}
+		})
+	}
+}
+
+func TestListRepositories(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	image, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, repository := range []string{"mirror/a", "mirror/b/c", "mirrored/d", "other/e"} {
+		if err := crane.Push(image, host+"/"+repository+":latest"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for prefix, want := range map[string][]string{
+		host + "/mirror": {host + "/mirror/a", host + "/mirror/b/c"},
+		host:             {host + "/mirror/a", host + "/mirror/b/c", host + "/mirrored/d", host + "/other/e"},
+	} {
+		repositories, err := NewClient(nil, nil).ListRepositories(context.Background(), prefix)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		// The catalog order is up to the registry
+		slices.Sort(repositories)
+		if strings.Join(repositories, ",") != strings.Join(want, ",") {
+			t.Fatalf("expected %v under %s, got %v", want, prefix, repositories)
+		}
+	}
+}
+
+func TestRecordUsage(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	image, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []string{"1.0", "latest"} {
+		if err := crane.Push(image, host+"/mirror/image:"+tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client := NewClient(nil, nil)
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+	for _, usage := range []Usage{
+		{Cluster: "a", Image: host + "/mirror/image:1.0", LastUsed: now.Add(-time.Hour)},
+		{Cluster: "a", Image: host + "/mirror/image:1.0", LastUsed: now},
+		{Cluster: "b", Image: host + "/mirror/image:latest", LastUsed: now.Add(-time.Minute)},
+	} {
+		if err := client.RecordUsage(ctx, usage.Image, usage.Cluster, usage.LastUsed); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	digest, err := image.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	usages, err := client.ListUsages(ctx, host+"/mirror/image:1.0")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	slices.SortFunc(usages, func(a, b Usage) int {
+		return strings.Compare(a.Cluster, b.Cluster)
+	})
+	want := []Usage{
+		{Cluster: "a", Image: host + "/mirror/image:1.0", LastUsed: now},
+		{Cluster: "b", Image: host + "/mirror/image:latest", LastUsed: now.Add(-time.Minute)},
+	}
+	if len(usages) != len(want) {
+		t.Fatalf("expected %v, got %v", want, usages)
+	}
+	for i := range want {
+		if usages[i].Cluster != want[i].Cluster || usages[i].Image != want[i].Image || usages[i].Digest != digest.String() || !usages[i].LastUsed.Equal(want[i].LastUsed) {
+			t.Fatalf("expected %v, got %v", want, usages)
+		}
+	}
+
+	if err := client.DeleteUsage(ctx, host+"/mirror/image:1.0", "a"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if usages, err := client.ListUsages(ctx, host+"/mirror/image:1.0"); err != nil || len(usages) != 1 || usages[0].Cluster != "b" {
+		t.Fatalf("expected only the usage of b to be left, got %v (%v)", usages, err)
+	}
+}
@@ -0,0 +1,104 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// cosignTagSuffixes are the suffixes of the tags cosign gives to the
+// signatures, attestations and SBOMs of a manifest, after sha256-<hex>.
+var cosignTagSuffixes = []string{".sig", ".att", ".sbom"}
+
+// Referrer is an artifact attached to a manifest, copied by CopyReferrers.
+type Referrer struct {
+	// Subject is the digest of the manifest the artifact is attached to.
+	Subject v1.Hash
+	// Digest is the digest of the manifest of the artifact.
+	Digest v1.Hash
+	// Tag is the legacy cosign tag of the artifact, empty for an OCI referrer.
+	Tag string
+}
+
+// CopyReferrers copies to the repository of dest the artifacts attached to the
+// manifests with the given digests in the repository of src, read with
+// srcClient: their OCI referrers, read through the referrers tag schema from the
+// registries that do not implement the referrers API, and their signatures,
+// attestations and SBOMs tagged by cosign as sha256-<hex>.sig, .att and .sbom.
+// The artifacts attached to the copied artifacts are not copied, nor are the
+// markers written by kuik.
+func (c *Client) CopyReferrers(ctx context.Context, srcClient *Client, src, dest string, subjects []v1.Hash) ([]Referrer, error) {
+	var referrers []Referrer
+	err := srcClient.Execute(ctx, src, func(srcRef name.Reference, srcOpts ...remote.Option) error {
+		return c.Execute(ctx, dest, func(destRef name.Reference, destOpts ...remote.Option) error {
+			referrers = referrers[:0]
+			srcRepo, destRepo := srcRef.Context(), destRef.Context()
+
+			copyManifest := func(from, to name.Reference) error {
+				desc, err := remote.Get(from, srcOpts...)
+				if err != nil {
+					return err
+				}
+				if desc.MediaType.IsIndex() {
+					index, err := desc.ImageIndex()
+					if err != nil {
+						return err
+					}
+					return remote.WriteIndex(to, index, destOpts...)
+				}
+				image, err := desc.Image()
+				if err != nil {
+					return err
+				}
+				return remote.Write(to, image, destOpts...)
+			}
+
+			for _, subject := range subjects {
+				index, err := remote.Referrers(srcRepo.Digest(subject.String()), srcOpts...)
+				if err != nil {
+					return fmt.Errorf("could not list the referrers of %s: %w", subject, err)
+				}
+				manifest, err := index.IndexManifest()
+				if err != nil {
+					return err
+				}
+				for _, descriptor := range manifest.Manifests {
+					if descriptor.ArtifactType == CopyMarkerArtifactType || descriptor.ArtifactType == UsageMarkerArtifactType {
+						continue
+					}
+					digest := descriptor.Digest.String()
+					if err := copyManifest(srcRepo.Digest(digest), destRepo.Digest(digest)); err != nil {
+						return fmt.Errorf("could not copy the referrer %s of %s: %w", digest, subject, err)
+					}
+					referrers = append(referrers, Referrer{Subject: subject, Digest: descriptor.Digest})
+				}
+
+				for _, suffix := range cosignTagSuffixes {
+					tag := strings.Replace(subject.String(), ":", "-", 1) + suffix
+					desc, err := remote.Head(srcRepo.Tag(tag), srcOpts...)
+					if ErrIsImageNotFound(err) {
+						continue
+					} else if err != nil {
+						return fmt.Errorf("could not read the cosign tag %s: %w", tag, err)
+					}
+					if err := copyManifest(srcRepo.Tag(tag), destRepo.Tag(tag)); err != nil {
+						return fmt.Errorf("could not copy the cosign tag %s: %w", tag, err)
+					}
+					referrers = append(referrers, Referrer{Subject: subject, Digest: desc.Digest, Tag: tag})
+				}
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.Clip(referrers), nil
+}
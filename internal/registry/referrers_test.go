@@ -0,0 +1,143 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+func TestCopyReferrers(t *testing.T) {
+	for mode, handler := range map[string]http.Handler{
+		"with the referrers API": registry.New(registry.WithReferrersSupport(true)),
+		"with the referrers tag": registry.New(),
+	} {
+		t.Run(mode, func(t *testing.T) {
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			host := strings.TrimPrefix(server.URL, "http://")
+			ctx := context.Background()
+
+			amd64 := v1.Platform{OS: "linux", Architecture: "amd64"}
+			arm64 := v1.Platform{OS: "linux", Architecture: "arm64"}
+			index, err := random.Index(256, 1, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			manifest, err := index.IndexManifest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			platforms := []v1.Platform{amd64, arm64}
+			adds := make([]mutate.IndexAddendum, len(manifest.Manifests))
+			for i, desc := range manifest.Manifests {
+				img, err := index.Image(desc.Digest)
+				if err != nil {
+					t.Fatal(err)
+				}
+				adds[i] = mutate.IndexAddendum{Add: img, Descriptor: v1.Descriptor{Platform: &platforms[i]}}
+			}
+			index = mutate.AppendManifests(mutate.RemoveManifests(index, func(v1.Descriptor) bool { return true }), adds...)
+			indexRef, err := name.ParseReference(host + "/src/app:v1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := remote.WriteIndex(indexRef, index); err != nil {
+				t.Fatal(err)
+			}
+			indexDigest, err := index.Digest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			manifest, err = index.IndexManifest()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			attach := func(subject v1.Hash, artifactType string) v1.Hash {
+				t.Helper()
+				subjectDesc, err := remote.Head(indexRef.Context().Digest(subject.String()))
+				if err != nil {
+					t.Fatal(err)
+				}
+				artifact := mutate.ConfigMediaType(mutate.MediaType(empty.Image, types.OCIManifestSchema1), types.MediaType(artifactType))
+				artifact = mutate.Subject(artifact, *subjectDesc).(v1.Image)
+				digest, err := artifact.Digest()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := remote.Write(indexRef.Context().Digest(digest.String()), artifact); err != nil {
+					t.Fatal(err)
+				}
+				return digest
+			}
+			indexSignature := attach(indexDigest, "application/vnd.dev.sigstore.bundle.v0.3+json")
+			amd64SBOM := attach(manifest.Manifests[0].Digest, "application/spdx+json")
+			attach(manifest.Manifests[1].Digest, "application/spdx+json")
+
+			cosignSignature, err := random.Image(64, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cosignTag := strings.Replace(indexDigest.String(), ":", "-", 1) + ".sig"
+			if err := crane.Push(cosignSignature, host+"/src/app:"+cosignTag); err != nil {
+				t.Fatal(err)
+			}
+
+			client := NewClient(nil, nil)
+			if err := client.MarkCopy(ctx, host+"/src/app:v1", "ImageSetMirror default/ism"); err != nil {
+				t.Fatal(err)
+			}
+
+			src, err := client.GetDescriptor(ctx, host+"/src/app:v1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			stats, err := client.CopyImage(ctx, src, host+"/dest/app:v1", []v1.Platform{amd64})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(stats.Manifests) != 1 || stats.Manifests[0] != manifest.Manifests[0].Digest {
+				t.Fatalf("expected the amd64 manifest %s to be copied, got %v", manifest.Manifests[0].Digest, stats.Manifests)
+			}
+
+			subjects := append([]v1.Hash{src.Digest}, stats.Manifests...)
+			referrers, err := client.CopyReferrers(ctx, NewClient(nil, nil), host+"/src/app:v1", host+"/dest/app:v1", subjects)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(referrers) != 3 {
+				t.Fatalf("expected the index signature, the amd64 SBOM and the cosign signature to be copied, got %v", referrers)
+			}
+
+			destRepo := indexRef.Context().Registry.Repo("dest", "app")
+			for subject, want := range map[v1.Hash]v1.Hash{indexDigest: indexSignature, manifest.Manifests[0].Digest: amd64SBOM} {
+				index, err := remote.Referrers(destRepo.Digest(subject.String()))
+				if err != nil {
+					t.Fatal(err)
+				}
+				copied, err := index.IndexManifest()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(copied.Manifests) != 1 || copied.Manifests[0].Digest != want {
+					t.Errorf("expected %s to be the only referrer of %s, got %v", want, subject, copied.Manifests)
+				}
+			}
+			if _, err := crane.Digest(destRepo.Tag(cosignTag).String()); err != nil {
+				t.Errorf("expected the cosign signature to be copied, got %v", err)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package registry
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
@@ -9,6 +10,7 @@ import (
 	"net/http"
 	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/go-containerregistry/pkg/authn"
@@ -17,7 +19,6 @@ import (
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
-	"github.com/google/go-containerregistry/pkg/v1/types"
 	corev1 "k8s.io/api/core/v1"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
@@ -43,7 +44,10 @@ type Client struct {
 	rootCAs            *x509.CertPool
 	timeout            time.Duration
 	pullSecrets        []corev1.Secret
+	bandwidthLimiter   *BandwidthLimiter
 	headerCapture      *HeaderCapture
+	// uploaded counts the bytes of the bodies of the requests sent by the client.
+	uploaded atomic.Int64
 }
 
 func NewClient(insecureRegistries []string, rootCAs *x509.CertPool) *Client {
@@ -54,15 +58,25 @@ func NewClient(insecureRegistries []string, rootCAs *x509.CertPool) *Client {
 	}
 }
 
-func (c *Client) newTransportOption(ref name.Reference) remote.Option {
+func (c *Client) newHTTPTransport(registry string) *http.Transport {
 	transport := http.DefaultTransport.(*http.Transport).Clone()
 	transport.TLSClientConfig = &tls.Config{RootCAs: c.rootCAs}
 
-	if slices.Contains(c.insecureRegistries, ref.Context().RegistryStr()) {
+	if slices.Contains(c.insecureRegistries, registry) {
 		transport.TLSClientConfig.InsecureSkipVerify = true
 	}
 
-	c.headerCapture.roundTripper = transport
+	return transport
+}
+
+func (c *Client) newTransportOption(ref name.Reference) remote.Option {
+	transport := c.newHTTPTransport(ref.Context().RegistryStr())
+
+	uploadTransport := &uploadTransport{roundTripper: transport, uploaded: &c.uploaded}
+	if c.bandwidthLimiter != nil {
+		uploadTransport.limiters = c.bandwidthLimiter.limiters(ref.Context().RegistryStr())
+	}
+	c.headerCapture.roundTripper = uploadTransport
 
 	return remote.WithTransport(c.headerCapture)
 }
@@ -80,6 +94,12 @@ func (c *Client) WithTimeout(timeout time.Duration) *Client {
 	return c
 }
 
+// WithBandwidthLimiter throttles the uploads to the registries with limiter.
+func (c *Client) WithBandwidthLimiter(limiter *BandwidthLimiter) *Client {
+	c.bandwidthLimiter = limiter
+	return c
+}
+
 func (c *Client) WithPullSecrets(pullSecrets []corev1.Secret) *Client {
 	// TODO: rename into WithCredentialSecrets
 	c.pullSecrets = pullSecrets
@@ -131,6 +151,25 @@ func (c *Client) Execute(ctx context.Context, imageName string, action func(ref
 	return errors.Join(errs...)
 }
 
+// Ping checks that registry answers on the registry API. It does not
+// authenticate: a registry answering that authentication is required is
+// reachable.
+func (c *Client) Ping(ctx context.Context, registry string) error {
+	reg, err := name.NewRegistry(registry)
+	if err != nil {
+		return err
+	}
+
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, c.timeout, fmt.Errorf("timed out after %v", c.timeout))
+		defer cancel()
+	}
+
+	_, err = transport.Ping(ctx, reg, c.newHTTPTransport(reg.RegistryStr()))
+	return err
+}
+
 func (c *Client) ReadDescriptor(ctx context.Context, httpMethod string, imageName string) (desc *v1.Descriptor, h http.Header, err error) {
 	err = c.Execute(ctx, imageName, func(ref name.Reference, opts ...remote.Option) (e error) {
 		desc, e = getReader(httpMethod)(ref, opts...)
@@ -147,10 +186,62 @@ func (c *Client) GetDescriptor(ctx context.Context, imageName string) (*remote.D
 	})
 }
 
-func (c *Client) CopyImage(ctx context.Context, src *remote.Descriptor, dest string, platforms []v1.Platform) error {
-	return c.Execute(ctx, dest, func(destRef name.Reference, opts ...remote.Option) (err error) {
-		switch src.MediaType {
-		case types.OCIImageIndex, types.DockerManifestList:
+// CopyStats describes an image written by CopyImage.
+type CopyStats struct {
+	// Digest is the digest of the manifest written at the destination. It
+	// differs from the source digest when platforms are filtered out of an index.
+	Digest v1.Hash
+	// Size is the total size of the manifests, configs and layers of the image.
+	Size int64
+	// Layers is the number of distinct layers of the image.
+	Layers int
+	// Manifests are the digests of the per-platform manifests of the index
+	// written at the destination, empty for an image.
+	Manifests []v1.Hash
+	// UploadedBytes is the number of bytes sent to the destination, lower than
+	// Size when some blobs were already there.
+	UploadedBytes int64
+}
+
+// CopyImage copies src to dest, keeping only the given platforms. OCI artifacts
+// are copied as is, whatever the platforms.
+func (c *Client) CopyImage(ctx context.Context, src *remote.Descriptor, dest string, platforms []v1.Platform) (*CopyStats, error) {
+	stats := &CopyStats{}
+	layers := map[v1.Hash]struct{}{}
+	c.uploaded.Store(0)
+
+	err := c.Execute(ctx, dest, func(destRef name.Reference, opts ...remote.Option) (err error) {
+		clear(layers)
+		stats.Size = 0
+		stats.Manifests = nil
+
+		artifact, err := isArtifact(src)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case artifact:
+			// Artifacts such as Helm charts or WASM modules have no platform to filter: they are copied as is
+			logf.FromContext(ctx).V(1).Info("copying OCI artifact as is", "image", dest, "mediaType", src.MediaType)
+			if err := remote.Push(destRef, src, opts...); err != nil {
+				return err
+			}
+
+			stats.Digest = src.Digest
+			if src.MediaType.IsIndex() {
+				index, err := src.ImageIndex()
+				if err != nil {
+					return err
+				}
+				return addIndexStats(stats, layers, index)
+			}
+			image, err := src.Image()
+			if err != nil {
+				return err
+			}
+			return addImageStats(stats, layers, image)
+		case src.MediaType.IsIndex():
 			index, err := src.ImageIndex()
 			if err != nil {
 				return err
@@ -184,6 +275,13 @@ func (c *Client) CopyImage(ctx context.Context, src *remote.Descriptor, dest str
 			if err := remote.WriteIndex(destRef, filteredIndex, opts...); err != nil {
 				return err
 			}
+
+			if stats.Digest, err = filteredIndex.Digest(); err != nil {
+				return err
+			}
+			if err := addIndexStats(stats, layers, filteredIndex); err != nil {
+				return err
+			}
 		default:
 			image, err := src.Image()
 			if err != nil {
@@ -207,10 +305,100 @@ func (c *Client) CopyImage(ctx context.Context, src *remote.Descriptor, dest str
 			if err := remote.Write(destRef, image, opts...); err != nil {
 				return err
 			}
+
+			if stats.Digest, err = image.Digest(); err != nil {
+				return err
+			}
+			if err := addImageStats(stats, layers, image); err != nil {
+				return err
+			}
 		}
 
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Layers = len(layers)
+	stats.UploadedBytes = c.uploaded.Load()
+	return stats, nil
+}
+
+// isArtifact reports whether src is an OCI artifact, such as a Helm chart or a
+// WASM module, rather than a container image: a manifest with an artifact type
+// or whose config is not an image config, or an index with an artifact type or
+// without any platform.
+func isArtifact(src *remote.Descriptor) (bool, error) {
+	switch {
+	case src.MediaType.IsIndex():
+		index, err := v1.ParseIndexManifest(bytes.NewReader(src.Manifest))
+		if err != nil {
+			return false, err
+		}
+		return index.ArtifactType != "" || !slices.ContainsFunc(index.Manifests, func(descriptor v1.Descriptor) bool {
+			return descriptor.Platform != nil
+		}), nil
+	case src.MediaType.IsImage():
+		manifest, err := v1.ParseManifest(bytes.NewReader(src.Manifest))
+		if err != nil {
+			return false, err
+		}
+		return manifest.ArtifactType != "" || !manifest.Config.MediaType.IsConfig(), nil
+	default:
+		return false, nil
+	}
+}
+
+// addIndexStats adds the size of the manifest of index and of its images to
+// stats, along with the digests of its manifests.
+func addIndexStats(stats *CopyStats, layers map[v1.Hash]struct{}, index v1.ImageIndex) error {
+	size, err := index.Size()
+	if err != nil {
+		return err
+	}
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return err
+	}
+
+	stats.Size += size
+	for _, descriptor := range indexManifest.Manifests {
+		stats.Manifests = append(stats.Manifests, descriptor.Digest)
+		if !descriptor.MediaType.IsImage() {
+			continue
+		}
+		image, err := index.Image(descriptor.Digest)
+		if err != nil {
+			return err
+		}
+		if err := addImageStats(stats, layers, image); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addImageStats adds the size of the manifest, config and layers of image to
+// stats, counting the layers shared with the already added images only once.
+func addImageStats(stats *CopyStats, layers map[v1.Hash]struct{}, image v1.Image) error {
+	manifest, err := image.Manifest()
+	if err != nil {
+		return err
+	}
+	size, err := image.Size()
+	if err != nil {
+		return err
+	}
+
+	stats.Size += size + manifest.Config.Size
+	for _, layer := range manifest.Layers {
+		if _, ok := layers[layer.Digest]; !ok {
+			layers[layer.Digest] = struct{}{}
+			stats.Size += layer.Size
+		}
+	}
+	return nil
 }
 
 func (c *Client) DeleteImage(ctx context.Context, imageName string) error {
@@ -231,6 +419,39 @@ func (c *Client) DeleteImage(ctx context.Context, imageName string) error {
 	})
 }
 
+// ErrTagDeletionUnsupported is returned by DeleteTag when the registry does not
+// allow to delete a tag without deleting the manifest it points to.
+var ErrTagDeletionUnsupported = errors.New("registry does not support tag deletion")
+
+// DeleteTag deletes the tag of imageName, leaving the manifest it points to and
+// the other tags of this manifest in place. Registries that do not implement
+// tag deletion answer with a client error, which is returned wrapped in
+// ErrTagDeletionUnsupported: the caller is expected to have checked that the
+// tag exists, since some of them answer 404 for a tag they cannot delete.
+func (c *Client) DeleteTag(ctx context.Context, imageName string) error {
+	return c.Execute(ctx, imageName, func(ref name.Reference, opts ...remote.Option) error {
+		if _, ok := ref.(name.Tag); !ok {
+			return fmt.Errorf("%s is not a tag", imageName)
+		}
+		err := remote.Delete(ref, opts...)
+		switch TransportStatusCode(err) {
+		case http.StatusBadRequest, http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+			return fmt.Errorf("%w: %w", ErrTagDeletionUnsupported, err)
+		}
+		return err
+	})
+}
+
+// ListTags returns the tags of the given repository.
+func (c *Client) ListTags(ctx context.Context, repository string) ([]string, error) {
+	var tags []string
+	err := c.Execute(ctx, repository, func(ref name.Reference, opts ...remote.Option) (err error) {
+		tags, err = remote.List(ref.Context(), opts...)
+		return err
+	})
+	return tags, err
+}
+
 func getReader(httpMethod string) descriptorReader {
 	switch httpMethod {
 	case http.MethodGet:
@@ -267,6 +488,28 @@ func ErrIsImageNotFound(err error) bool {
 	return TransportStatusCode(err) == http.StatusNotFound
 }
 
+// permanentError is an error that retrying the same copy cannot fix.
+type permanentError struct {
+	error
+}
+
+func (e permanentError) Unwrap() error {
+	return e.error
+}
+
+// Permanent marks err as permanent for IsPermanentError, for errors that cannot
+// be classified from their type, such as those reported by a copy job.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// IsPermanentError returns true if retrying the operation that failed with err
+// cannot succeed until the source image or the configuration change: the image
+// is not found, or none of the configured platforms are available in it.
+func IsPermanentError(err error) bool {
+	return errors.As(err, &permanentError{}) || ErrIsImageNotFound(err) || errors.Is(err, ErrNoMatchingPlatform)
+}
+
 // checkPlatforms keeps the platforms that are available in the source image,
 // warns about the configured ones that are missing, and fails only when none of
 // them are available (nothing to mirror).
@@ -308,12 +551,16 @@ func platformString(platform v1.Platform) string {
 	return platform.String()
 }
 
-// noMatchingPlatformError is returned when none of the configured platforms are
+// ErrNoMatchingPlatform is returned when none of the configured platforms are
 // available in the source image, so there is nothing to mirror.
+var ErrNoMatchingPlatform = errors.New("none of the configured platforms are available in the source image")
+
+// noMatchingPlatformError wraps ErrNoMatchingPlatform with the configured
+// platforms.
 func noMatchingPlatformError(platforms []v1.Platform) error {
 	strs := make([]string, len(platforms))
 	for i, platform := range platforms {
 		strs[i] = platformString(platform)
 	}
-	return fmt.Errorf("none of the configured platforms are available in the source image: %s", strings.Join(strs, ", "))
+	return fmt.Errorf("%w: %s", ErrNoMatchingPlatform, strings.Join(strs, ", "))
 }
@@ -2,9 +2,24 @@ package registry
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 )
 
 func TestPlatformString(t *testing.T) {
@@ -107,6 +122,29 @@ func TestNoMatchingPlatformError(t *testing.T) {
 	}
 }
 
+func TestIsPermanentError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "not found", err: fmt.Errorf("could not get image: %w", &transport.Error{StatusCode: http.StatusNotFound}), want: true},
+		{name: "no matching platform", err: noMatchingPlatformError([]v1.Platform{{OS: "linux", Architecture: "amd64"}}), want: true},
+		{name: "marked as permanent", err: Permanent(errors.New("copy job failed")), want: true},
+		{name: "unauthorized", err: &transport.Error{StatusCode: http.StatusUnauthorized}, want: false},
+		{name: "server error", err: &transport.Error{StatusCode: http.StatusBadGateway}, want: false},
+		{name: "other error", err: errors.New("connection refused"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPermanentError(tt.err); got != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
 func TestCheckPlatforms(t *testing.T) {
 	var (
 		amd64 = v1.Platform{OS: "linux", Architecture: "amd64"}
@@ -148,6 +186,203 @@ func TestCheckPlatforms(t *testing.T) {
 	}
 }
 
+func TestCopyImageDestinationDigest(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	amd64 := v1.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := v1.Platform{OS: "linux", Architecture: "arm64"}
+
+	image, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	image, err = mutate.ConfigFile(image, &v1.ConfigFile{OS: amd64.OS, Architecture: amd64.Architecture})
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := random.Index(256, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	platforms := []v1.Platform{amd64, arm64}
+	adds := make([]mutate.IndexAddendum, len(manifest.Manifests))
+	for i, desc := range manifest.Manifests {
+		img, err := index.Image(desc.Digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		adds[i] = mutate.IndexAddendum{Add: img, Descriptor: v1.Descriptor{Platform: &platforms[i]}}
+	}
+	index = mutate.AppendManifests(mutate.RemoveManifests(index, func(v1.Descriptor) bool { return true }), adds...)
+
+	if err := crane.Push(image, host+"/src/image:v1"); err != nil {
+		t.Fatal(err)
+	}
+	indexRef, err := name.ParseReference(host + "/src/index:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.WriteIndex(indexRef, index); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		source     string
+		sameDigest bool
+	}{
+		{name: "image is copied as is", source: host + "/src/image:v1", sameDigest: true},
+		{name: "index is filtered to the configured platforms", source: host + "/src/index:v1", sameDigest: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			client := NewClient(nil, nil)
+			src, err := client.GetDescriptor(ctx, tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dest := strings.Replace(tt.source, "/src/", "/dest/", 1)
+			stats, err := client.CopyImage(ctx, src, dest, []v1.Platform{amd64})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			digest := stats.Digest
+			if stats.Layers != 1 || stats.Size <= 256 {
+				t.Errorf("expected the size of a single layer of 256 bytes and its manifest and config, got %d layers and %d bytes", stats.Layers, stats.Size)
+			}
+
+			written, err := client.GetDescriptor(ctx, dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if digest != written.Digest {
+				t.Errorf("expected digest %s, got %s", written.Digest, digest)
+			}
+			if (digest == src.Digest) != tt.sameDigest {
+				t.Errorf("expected digest equality with the source to be %v, source %s, destination %s", tt.sameDigest, src.Digest, digest)
+			}
+		})
+	}
+}
+
+func TestCopyImageArtifact(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	chartLayer, err := random.Layer(256, "application/vnd.cncf.helm.chart.content.v1.tar+gzip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chart, err := mutate.AppendLayers(mutate.MediaType(empty.Image, types.OCIManifestSchema1), chartLayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chart = mutate.ConfigMediaType(chart, "application/vnd.cncf.helm.config.v1+json")
+	if err := crane.Push(chart, host+"/src/chart:1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	// Indexes of random images have no platform
+	index, err := random.Index(256, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexRef, err := name.ParseReference(host + "/src/modules:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.WriteIndex(indexRef, index); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name      string
+		source    string
+		manifests int
+	}{
+		{name: "helm chart", source: host + "/src/chart:1.0.0", manifests: 0},
+		{name: "index without platforms", source: host + "/src/modules:v1", manifests: 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			client := NewClient(nil, nil)
+			src, err := client.GetDescriptor(ctx, tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dest := strings.Replace(tt.source, "/src/", "/dest/", 1)
+			stats, err := client.CopyImage(ctx, src, dest, []v1.Platform{{OS: "linux", Architecture: "amd64"}})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if stats.Digest != src.Digest {
+				t.Errorf("expected the artifact to be copied as is, with digest %s, got %s", src.Digest, stats.Digest)
+			}
+			if len(stats.Manifests) != tt.manifests || stats.Size <= 256 {
+				t.Errorf("expected %d manifests and more than 256 bytes, got %d manifests and %d bytes", tt.manifests, len(stats.Manifests), stats.Size)
+			}
+
+			written, err := client.GetDescriptor(ctx, dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if written.Digest != src.Digest {
+				t.Errorf("expected digest %s, got %s", src.Digest, written.Digest)
+			}
+		})
+	}
+}
+
+func TestListTags(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	image, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []string{"1.0.0", "1.1.0", "latest"} {
+		if err := crane.Push(image, host+"/src/image:"+tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tags, err := NewClient(nil, nil).ListTags(context.Background(), host+"/src/image")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := []string{"1.0.0", "1.1.0", "latest"}
+	if strings.Join(tags, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected %v, got %v", want, tags)
+	}
+}
+
+func TestPing(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	client := NewClient(nil, nil).WithTimeout(time.Second)
+	if err := client.Ping(context.Background(), host); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	server.Close()
+	if err := client.Ping(context.Background(), host); err == nil {
+		t.Fatal("expected an error once the registry is stopped")
+	}
+}
+
 func platformsEqual(a, b []v1.Platform) bool {
 	if len(a) != len(b) {
 		return false
@@ -159,3 +394,55 @@ func platformsEqual(a, b []v1.Platform) bool {
 	}
 	return true
 }
+
+func TestDeleteTag(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	image, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []string{"1.0.0", "latest"} {
+		if err := crane.Push(image, host+"/src/image:"+tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := NewClient(nil, nil).DeleteTag(context.Background(), host+"/src/image:1.0.0"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := crane.Head(host + "/src/image:1.0.0"); !ErrIsImageNotFound(err) {
+		t.Fatalf("expected the deleted tag to be gone, got %v", err)
+	}
+	if _, err := crane.Head(host + "/src/image:latest"); err != nil {
+		t.Fatalf("expected the other tag of the manifest to be kept, got %v", err)
+	}
+}
+
+func TestDeleteTagUnsupported(t *testing.T) {
+	handler := registry.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	image, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crane.Push(image, host+"/src/image:1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+
+	err = NewClient(nil, nil).DeleteTag(context.Background(), host+"/src/image:1.0.0")
+	if !errors.Is(err, ErrTagDeletionUnsupported) {
+		t.Fatalf("expected ErrTagDeletionUnsupported, got %v", err)
+	}
+}
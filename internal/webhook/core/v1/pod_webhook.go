@@ -1,15 +1,12 @@
 package v1
 
 import (
-	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"maps"
-	"math"
 	"net/http"
-	"path"
 	"slices"
 	"strings"
 	"time"
@@ -17,7 +14,6 @@ import (
 	"github.com/cespare/xxhash"
 	"github.com/distribution/reference"
 	kuikv1alpha1 "github.com/enix/kube-image-keeper/api/kuik/v1alpha1"
-	"github.com/enix/kube-image-keeper/internal"
 	"github.com/enix/kube-image-keeper/internal/config"
 	kuikcontroller "github.com/enix/kube-image-keeper/internal/controller/kuik"
 	"github.com/enix/kube-image-keeper/internal/filter"
@@ -118,40 +114,6 @@ type Container struct {
 	Alternatives    map[string]struct{}
 }
 
-// crTypeOrder represents the default ordering of CR types when priorities are equal.
-type crTypeOrder int
-
-const (
-	crTypeOrderOriginal crTypeOrder = iota
-	crTypeOrderCISM
-	crTypeOrderISM
-	crTypeOrderCRIS
-	crTypeOrderRIS
-)
-
-// prioritizedAlternative holds an alternative image reference along with
-// the metadata needed to sort it according to the two-level priority system.
-type prioritizedAlternative struct {
-	reference        string
-	credentialSecret *kuikv1alpha1.CredentialSecret
-	secretOwner      client.Object
-	crPriority       int         // from spec.priority (signed, default 0)
-	intraPriority    uint        // from mirror/upstream priority (unsigned, default 0)
-	typeOrder        crTypeOrder // default type ordering
-	declarationOrder int         // YAML declaration index within CR
-}
-
-// compareAlternatives defines the sort order for prioritized alternatives.
-// Sort key: (crPriority asc, typeOrder asc, intraPriority asc, declOrder asc).
-func compareAlternatives(a, b prioritizedAlternative) int {
-	return cmp.Or(
-		cmp.Compare(a.crPriority, b.crPriority),
-		cmp.Compare(a.typeOrder, b.typeOrder),
-		cmp.Compare(a.intraPriority, b.intraPriority),
-		cmp.Compare(a.declarationOrder, b.declarationOrder),
-	)
-}
-
 var _ admission.Defaulter[*corev1.Pod] = &PodCustomDefaulter{}
 
 // Default implements admission.Defaulter so a webhook will be registered for the Kind Pod.
@@ -247,100 +209,21 @@ func (d *PodCustomDefaulter) defaultPod(ctx context.Context, pod *corev1.Pod, dr
 		return nil
 	}
 
-	var cismList kuikv1alpha1.ClusterImageSetMirrorList
-	if err := d.List(ctx, &cismList); err != nil {
-		return err
-	}
-	var ismList kuikv1alpha1.ImageSetMirrorList
-	if err := d.List(ctx, &ismList, &client.ListOptions{
-		Namespace: pod.Namespace,
-	}); err != nil {
-		return err
-	}
-	var crisList kuikv1alpha1.ClusterReplicatedImageSetList
-	if err := d.List(ctx, &crisList); err != nil {
-		return err
-	}
-	var risList kuikv1alpha1.ReplicatedImageSetList
-	if err := d.List(ctx, &risList, &client.ListOptions{
-		Namespace: pod.Namespace,
-	}); err != nil {
+	imageSetMirrors, replicatedImageSets, err := kuikcontroller.MatchingImageSets(ctx, d.Client, pod.Namespace, pod)
+	if err != nil {
 		return err
 	}
-
-	imageSetMirrors := make([]kuikv1alpha1.ImageSetMirror, 0, len(cismList.Items))
-	for _, cism := range cismList.Items {
-		match, err := cism.PodMatcher()
-		if err != nil {
-			log.Error(err, "skipping ClusterImageSetMirror with invalid filter", "name", cism.Name)
-			continue
-		}
-		if !match(pod) {
-			continue
-		}
-		imageSetMirrors = append(imageSetMirrors, kuikv1alpha1.ImageSetMirror{
-			ObjectMeta: cism.ObjectMeta,
-			Spec: kuikv1alpha1.ImageSetMirrorSpec{
-				ImageSetMirrorBase: cism.Spec.ImageSetMirrorBase,
-				Filter:             cism.Spec.Filter.ToFilter(),
-			},
-			Status: kuikv1alpha1.ImageSetMirrorStatus(cism.Status),
-		})
-	}
-	clusterImageSetMirrorCount := len(imageSetMirrors)
-	for _, ism := range ismList.Items {
-		match, err := ism.PodMatcher()
-		if err != nil {
-			log.Error(err, "skipping ImageSetMirror with invalid filter", "namespace", ism.Namespace, "name", ism.Name)
-			continue
-		}
-		if !match(pod) {
-			continue
-		}
-		for i := range ism.Spec.Mirrors {
-			mirror := &ism.Spec.Mirrors[i]
-			if mirror.CredentialSecret != nil {
-				mirror.CredentialSecret.Namespace = ism.Namespace
-			}
-		}
-		imageSetMirrors = append(imageSetMirrors, ism)
-	}
-
-	replicatedImageSets := make([]kuikv1alpha1.ReplicatedImageSet, 0, len(crisList.Items))
-	for _, cris := range crisList.Items {
-		match, err := cris.PodMatcher()
-		if err != nil {
-			log.Error(err, "skipping ClusterReplicatedImageSet with invalid filter", "name", cris.Name)
-			continue
-		}
-		if !match(pod) {
-			continue
+	clusterImageSetMirrorCount := 0
+	for _, ism := range imageSetMirrors {
+		if ism.Namespace == "" {
+			clusterImageSetMirrorCount++
 		}
-		replicatedImageSets = append(replicatedImageSets, kuikv1alpha1.ReplicatedImageSet{
-			ObjectMeta: cris.ObjectMeta,
-			Spec: kuikv1alpha1.ReplicatedImageSetSpec{
-				ReplicatedImageSetBase: cris.Spec.ReplicatedImageSetBase,
-				Filter:                 cris.Spec.Filter.ToFilter(),
-			},
-		})
 	}
-	clusterReplicatedImageSetCount := len(replicatedImageSets)
-	for _, ris := range risList.Items {
-		match, err := ris.PodMatcher()
-		if err != nil {
-			log.Error(err, "skipping ReplicatedImageSet with invalid filter", "namespace", ris.Namespace, "name", ris.Name)
-			continue
-		}
-		if !match(pod) {
-			continue
-		}
-		for i := range ris.Spec.Upstreams {
-			upstream := &ris.Spec.Upstreams[i]
-			if upstream.CredentialSecret != nil {
-				upstream.CredentialSecret.Namespace = ris.Namespace
-			}
+	clusterReplicatedImageSetCount := 0
+	for _, ris := range replicatedImageSets {
+		if ris.Namespace == "" {
+			clusterReplicatedImageSetCount++
 		}
-		replicatedImageSets = append(replicatedImageSets, ris)
 	}
 
 	podCredentialSecrets := make([]*kuikv1alpha1.CredentialSecret, 0, len(pod.Spec.ImagePullSecrets))
@@ -451,124 +334,19 @@ func (d *PodCustomDefaulter) findBestAlternativeCached(ctx context.Context, imag
 
 func (d *PodCustomDefaulter) buildAlternativesList(ctx context.Context, imageSetMirrors []kuikv1alpha1.ImageSetMirror, replicatedImageSets []kuikv1alpha1.ReplicatedImageSet, container *Container) error {
 	log := logf.FromContext(ctx)
-	normalizedImage := container.NormalizedImage
-	alternatives := make([]prioritizedAlternative, 0, 1)
-
-	discardOriginal := false
-
-	// Collect from ReplicatedImageSets
-	for risIdx := range replicatedImageSets {
-		ris := &replicatedImageSets[risIdx]
-		// A malformed image filter on one upstream must not break admission nor
-		// disable the rest of the CR: skip only the offending upstream (both as a
-		// match candidate and as a routing alternative below).
-		index := -1
-		validUpstream := make([]bool, len(ris.Spec.Upstreams))
-		for i := range ris.Spec.Upstreams {
-			upstream := &ris.Spec.Upstreams[i]
-			imageFilter, err := upstream.ImageFilter.BuildWithRegistry(upstream.Registry)
-			if err != nil {
-				log.Error(err, "skipping ReplicatedImageSet upstream with invalid image filter", "namespace", ris.Namespace, "name", ris.Name, "registry", upstream.Registry)
-				continue
-			}
-			validUpstream[i] = true
-			if index == -1 && imageFilter.Match(normalizedImage) {
-				index = i
-			}
-		}
-		if index == -1 {
-			continue
-		}
-
-		match := &ris.Spec.Upstreams[index]
-		if match.DiscardAlternative {
-			// A matching upstream with DiscardAlternative enabled prevents the original registry from
-			// being used as a fallback. We set discardOriginal to true here to suppress it later.
-			discardOriginal = true
-		}
-		prefix := path.Join(match.Registry, match.Path)
-		suffix := strings.TrimPrefix(normalizedImage, prefix)
 
-		typeOrder := crTypeOrderRIS
-		if ris.Namespace == "" {
-			typeOrder = crTypeOrderCRIS
-		}
-
-		for declarationIdx, upstream := range ris.Spec.Upstreams {
-			if !validUpstream[declarationIdx] || upstream.DiscardAlternative {
-				continue
-			}
-			alternatives = append(alternatives, prioritizedAlternative{
-				reference:        path.Join(upstream.Registry, upstream.Path) + suffix,
-				credentialSecret: upstream.CredentialSecret,
-				secretOwner:      ris,
-				crPriority:       ris.Spec.Priority,
-				intraPriority:    upstream.Priority,
-				typeOrder:        typeOrder,
-				declarationOrder: declarationIdx,
-			})
-		}
-	}
-
-	if !discardOriginal {
-		// By default, containers with imagePullPolicy: Always pin the original first
-		// regardless of CR priorities; mirrors/upstreams are still appended as
-		// fallback. Set HonorPrioritiesOnAlwaysImagePullPolicy to opt into priority
-		// sorting for those containers.
-		original := prioritizedAlternative{
-			reference: normalizedImage,
-			typeOrder: crTypeOrderOriginal,
-		}
-		if container.ImagePullPolicy == corev1.PullAlways && !d.Config.Routing.HonorPrioritiesOnAlwaysImagePullPolicy {
-			original.crPriority = math.MinInt
-		}
-		alternatives = append(alternatives, original)
-	}
-
-	// Collect from ImageSetMirrors
-	for ismIdx := range imageSetMirrors {
-		ism := &imageSetMirrors[ismIdx]
-		imageFilter, err := ism.ImageFilter()
-		if err != nil {
-			log.Error(err, "skipping ImageSetMirror with invalid image filter", "namespace", ism.Namespace, "name", ism.Name)
-			continue
-		}
-
-		for _, alternative := range alternatives {
-			imgRegistry, imgPath, err := internal.RegistryAndPathFromReference(alternative.reference)
-			if err != nil {
-				return err
-			}
-
-			if !imageFilter.Match(path.Join(imgRegistry, imgPath)) {
-				// FIXME: if it doesn't match the filter, also check if it matches one of the mirrored images
-				continue
-			}
-
-			typeOrder := crTypeOrderISM
-			if ism.Namespace == "" {
-				typeOrder = crTypeOrderCISM
-			}
-
-			for declarationIdx, mirror := range ism.Spec.Mirrors {
-				alternatives = append(alternatives, prioritizedAlternative{
-					reference:        path.Join(mirror.Registry, mirror.Path, imgPath),
-					credentialSecret: mirror.CredentialSecret,
-					secretOwner:      ism,
-					crPriority:       ism.Spec.Priority,
-					intraPriority:    mirror.Priority,
-					typeOrder:        typeOrder,
-					declarationOrder: declarationIdx,
-				})
-			}
-		}
+	// By default, containers with imagePullPolicy: Always pin the original first
+	// regardless of CR priorities; mirrors/upstreams are still appended as
+	// fallback. Set HonorPrioritiesOnAlwaysImagePullPolicy to opt into priority
+	// sorting for those containers.
+	pinOriginal := container.ImagePullPolicy == corev1.PullAlways && !d.Config.Routing.HonorPrioritiesOnAlwaysImagePullPolicy
+	alternatives, err := kuikcontroller.Alternatives(ctx, imageSetMirrors, replicatedImageSets, container.NormalizedImage, pinOriginal)
+	if err != nil {
+		return err
 	}
 
-	// Stable sort by priority
-	slices.SortStableFunc(alternatives, compareAlternatives)
-
 	for _, alt := range alternatives {
-		container.addAlternative(alt.reference, alt.credentialSecret, alt.secretOwner)
+		container.addAlternative(alt.Reference, alt.CredentialSecret, alt.SecretOwner)
 	}
 
 	if err := container.loadAlternativesSecrets(ctx, d.Client); err != nil {
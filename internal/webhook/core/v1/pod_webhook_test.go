@@ -2,7 +2,6 @@ package v1
 
 import (
 	"context"
-	"slices"
 	"strings"
 	"time"
 
@@ -242,133 +241,6 @@ var _ = Describe("ensureSecret", func() {
 	})
 })
 
-var _ = Describe("compareAlternatives", func() {
-	refs := func(alternatives []prioritizedAlternative) []string {
-		result := make([]string, len(alternatives))
-		for i, alt := range alternatives {
-			result[i] = alt.reference
-		}
-		return result
-	}
-
-	Context("default behavior (all priorities 0)", func() {
-		It("should preserve default type order: CISM < ISM < CRIS < RIS", func() {
-			alternatives := []prioritizedAlternative{
-				{reference: "ris-mirror", typeOrder: crTypeOrderRIS, declarationOrder: 0},
-				{reference: "cism-mirror", typeOrder: crTypeOrderCISM, declarationOrder: 0},
-				{reference: "cris-upstream", typeOrder: crTypeOrderCRIS, declarationOrder: 0},
-				{reference: "ism-mirror", typeOrder: crTypeOrderISM, declarationOrder: 0},
-			}
-			slices.SortStableFunc(alternatives, compareAlternatives)
-			Expect(refs(alternatives)).To(Equal([]string{
-				"cism-mirror", "ism-mirror", "cris-upstream", "ris-mirror",
-			}))
-		})
-
-		It("should preserve YAML declaration order within same type", func() {
-			alternatives := []prioritizedAlternative{
-				{reference: "mirror-c", typeOrder: crTypeOrderCISM, declarationOrder: 2},
-				{reference: "mirror-a", typeOrder: crTypeOrderCISM, declarationOrder: 0},
-				{reference: "mirror-b", typeOrder: crTypeOrderCISM, declarationOrder: 1},
-			}
-			slices.SortStableFunc(alternatives, compareAlternatives)
-			Expect(refs(alternatives)).To(Equal([]string{
-				"mirror-a", "mirror-b", "mirror-c",
-			}))
-		})
-	})
-
-	Context("CR priority", func() {
-		It("should sort by CR priority ascending (negative first)", func() {
-			alternatives := []prioritizedAlternative{
-				{reference: "prio-0", crPriority: 0, typeOrder: crTypeOrderCISM, declarationOrder: 0},
-				{reference: "prio-5", crPriority: 5, typeOrder: crTypeOrderCISM, declarationOrder: 0},
-				{reference: "prio-neg10", crPriority: -10, typeOrder: crTypeOrderCISM, declarationOrder: 0},
-				{reference: "prio-neg1", crPriority: -1, typeOrder: crTypeOrderCISM, declarationOrder: 0},
-			}
-			slices.SortStableFunc(alternatives, compareAlternatives)
-			Expect(refs(alternatives)).To(Equal([]string{
-				"prio-neg10", "prio-neg1", "prio-0", "prio-5",
-			}))
-		})
-
-		It("should fall back to type order on equal CR priority", func() {
-			alternatives := []prioritizedAlternative{
-				{reference: "ism", crPriority: -1, typeOrder: crTypeOrderISM, declarationOrder: 0},
-				{reference: "cism", crPriority: -1, typeOrder: crTypeOrderCISM, declarationOrder: 0},
-			}
-			slices.SortStableFunc(alternatives, compareAlternatives)
-			Expect(refs(alternatives)).To(Equal([]string{
-				"cism", "ism",
-			}))
-		})
-	})
-
-	Context("intra-CR priority", func() {
-		It("should sort positive intra-priorities ascending (lower = higher priority)", func() {
-			alternatives := []prioritizedAlternative{
-				{reference: "prio-30", intraPriority: 30, typeOrder: crTypeOrderCISM, declarationOrder: 0},
-				{reference: "prio-10", intraPriority: 10, typeOrder: crTypeOrderCISM, declarationOrder: 1},
-				{reference: "prio-20", intraPriority: 20, typeOrder: crTypeOrderCISM, declarationOrder: 2},
-			}
-			slices.SortStableFunc(alternatives, compareAlternatives)
-			Expect(refs(alternatives)).To(Equal([]string{
-				"prio-10", "prio-20", "prio-30",
-			}))
-		})
-
-		It("should place intra-priority 0 (default) before positive values", func() {
-			alternatives := []prioritizedAlternative{
-				{reference: "prio-5", intraPriority: 5, typeOrder: crTypeOrderCISM, declarationOrder: 0},
-				{reference: "prio-1", intraPriority: 1, typeOrder: crTypeOrderCISM, declarationOrder: 1},
-				{reference: "no-prio", intraPriority: 0, typeOrder: crTypeOrderCISM, declarationOrder: 2},
-			}
-			slices.SortStableFunc(alternatives, compareAlternatives)
-			Expect(refs(alternatives)).To(Equal([]string{
-				"no-prio", "prio-1", "prio-5",
-			}))
-		})
-
-		It("should preserve YAML order among items with intra-priority 0", func() {
-			alternatives := []prioritizedAlternative{
-				{reference: "first", intraPriority: 0, typeOrder: crTypeOrderCISM, declarationOrder: 0},
-				{reference: "second", intraPriority: 0, typeOrder: crTypeOrderCISM, declarationOrder: 1},
-				{reference: "third", intraPriority: 0, typeOrder: crTypeOrderCISM, declarationOrder: 2},
-			}
-			slices.SortStableFunc(alternatives, compareAlternatives)
-			Expect(refs(alternatives)).To(Equal([]string{
-				"first", "second", "third",
-			}))
-		})
-	})
-
-	Context("combined scenario from instructions.txt", func() {
-		It("should order: ISM mirrors (prio -10) > CISM mirror (prio -1) > original (prio 0)", func() {
-			alternatives := []prioritizedAlternative{
-				{reference: "second", crPriority: -10, intraPriority: 5, typeOrder: crTypeOrderISM, declarationOrder: 0},
-				{reference: "first", crPriority: -10, intraPriority: 1, typeOrder: crTypeOrderISM, declarationOrder: 1},
-				{reference: "third", crPriority: -1, intraPriority: 0, typeOrder: crTypeOrderCISM, declarationOrder: 0},
-			}
-			slices.SortStableFunc(alternatives, compareAlternatives)
-			Expect(refs(alternatives)).To(Equal([]string{
-				"first", "second", "third",
-			}))
-		})
-
-		It("should order ReplicatedImageSet upstreams by intra-priority", func() {
-			alternatives := []prioritizedAlternative{
-				{reference: "third", crPriority: 0, intraPriority: 30, typeOrder: crTypeOrderCRIS, declarationOrder: 0},
-				{reference: "first", crPriority: 0, intraPriority: 10, typeOrder: crTypeOrderCRIS, declarationOrder: 1},
-				{reference: "second", crPriority: 0, intraPriority: 20, typeOrder: crTypeOrderCRIS, declarationOrder: 2},
-			}
-			slices.SortStableFunc(alternatives, compareAlternatives)
-			Expect(refs(alternatives)).To(Equal([]string{
-				"first", "second", "third",
-			}))
-		})
-	})
-})
-
 var _ = Describe("buildAlternativesList", func() {
 	var d *PodCustomDefaulter
 
@@ -654,6 +526,54 @@ var _ = Describe("buildAlternativesList", func() {
 		})
 	})
 
+	Context("with a rewrite rule", func() {
+		corpUpstream := func(match, replacement string) kuikv1alpha1.ReplicatedUpstream {
+			upstream := makeUpstream("registry.corp", false)
+			upstream.Path = "/dockerhub"
+			upstream.Rewrite = &kuikv1alpha1.UpstreamRewrite{Match: match, Replacement: replacement}
+			return upstream
+		}
+		dockerHubUpstream := func() kuikv1alpha1.ReplicatedUpstream {
+			upstream := makeUpstream("docker.io", false)
+			upstream.Path = "/library"
+			return upstream
+		}
+
+		It("routes to a renamed repository and tag on the rewriting upstream", func() {
+			ris := makeRIS(dockerHubUpstream(), corpUpstream(`(?P<repository>[^:]+):(?P<tag>.+)-corp`, "${repository}:${tag}-corp"))
+			c := makeContainer("docker.io/library/postgres:16.2", corev1.PullIfNotPresent)
+			Expect(d.buildAlternativesList(ctx, nil, []kuikv1alpha1.ReplicatedImageSet{ris}, c)).To(Succeed())
+			Expect(references(c)).To(Equal([]string{
+				"docker.io/library/postgres:16.2",
+				"registry.corp/dockerhub/postgres:16.2-corp",
+			}))
+		})
+
+		It("routes back from the rewriting upstream using the captured groups", func() {
+			ris := makeRIS(dockerHubUpstream(), corpUpstream(`(?P<repository>[^:]+):(?P<tag>.+)-corp`, "${repository}:${tag}-corp"))
+			c := makeContainer("registry.corp/dockerhub/postgres:16.2-corp", corev1.PullIfNotPresent)
+			Expect(d.buildAlternativesList(ctx, nil, []kuikv1alpha1.ReplicatedImageSet{ris}, c)).To(Succeed())
+			Expect(references(c)).To(Equal([]string{
+				"registry.corp/dockerhub/postgres:16.2-corp",
+				"docker.io/library/postgres:16.2",
+			}))
+		})
+
+		It("skips only the upstream whose replacement cannot be expanded", func() {
+			ris := makeRIS(dockerHubUpstream(), corpUpstream(`(?P<name>[^:]+):(?P<tag>.+)`, "${name}:${tag}"))
+			c := makeContainer("docker.io/library/postgres:16.2", corev1.PullIfNotPresent)
+			Expect(d.buildAlternativesList(ctx, nil, []kuikv1alpha1.ReplicatedImageSet{ris}, c)).To(Succeed())
+			Expect(references(c)).To(Equal([]string{"docker.io/library/postgres:16.2"}))
+		})
+
+		It("skips an upstream with an invalid rewrite rule", func() {
+			ris := makeRIS(dockerHubUpstream(), corpUpstream(`(`, "${repository}"))
+			c := makeContainer("docker.io/library/postgres:16.2", corev1.PullIfNotPresent)
+			Expect(d.buildAlternativesList(ctx, nil, []kuikv1alpha1.ReplicatedImageSet{ris}, c)).To(Succeed())
+			Expect(references(c)).To(Equal([]string{"docker.io/library/postgres:16.2"}))
+		})
+	})
+
 	Context("with imagePullPolicy: IfNotPresent", func() {
 		It("honors a CISM with negative spec.priority", func() {
 			c := makeContainer("docker.io/library/nginx:1.29", corev1.PullIfNotPresent)